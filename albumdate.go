@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Sources of the date album folders are prefixed with, accepted by
+// --album-date-source.
+const (
+	albumDateCreated       = "created"
+	albumDateEarliestTaken = "earliest-taken"
+	albumDateLatestTaken   = "latest-taken"
+)
+
+func validateAlbumDateSource(source string) error {
+	switch source {
+	case albumDateCreated, albumDateEarliestTaken, albumDateLatestTaken:
+		return nil
+	default:
+		return fmt.Errorf("invalid album date source %q (must be one of: created, earliest-taken, latest-taken)", source)
+	}
+}
+
+// setFolderDate sets album.FolderDate from the dates its photos were taken,
+// if album folders are dated that way. The dates come from each photo's
+// info, which is fetched now rather than as each photo is downloaded, so this
+// takes an API call for every photo in the album, including those that have
+// already been downloaded. Albums whose photos have no dates taken keep
+// their creation date, and albums without one, such as search results, stay
+// undated.
+func (fe *FlickrExporter) setFolderDate(album *Album) {
+	if fe.albumDateSource == albumDateCreated || album.DateCreated.IsZero() || !album.FolderDate.IsZero() {
+		return
+	}
+
+	var mu sync.Mutex
+	var date time.Time
+	fe.forEachParallel(len(album.Photos), func(worker *FlickrExporter, i int) {
+		photo := album.Photos[i]
+		if err := worker.fetchPhotoMetadata(&photo); err != nil {
+			fe.warnf("  Warning: Failed to get the date %s was taken, for dating its album's folder: %v\n", photo.Filename, err)
+			return
+		}
+		if photo.DateTaken.IsZero() {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if date.IsZero() ||
+			fe.albumDateSource == albumDateEarliestTaken && photo.DateTaken.Before(date) ||
+			fe.albumDateSource == albumDateLatestTaken && photo.DateTaken.After(date) {
+			date = photo.DateTaken
+		}
+	})
+	album.FolderDate = date
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+)
+
+// photoPage is a page of an album's photos, or the error that stopped them
+// being listed.
+type photoPage struct {
+	photos []Photo
+	err    error
+}
+
+// streamsAlbumPhotos reports whether albums' photos are downloaded page by
+// page as they're listed, rather than after the whole album has been listed.
+// Options that need every photo in the album up front prevent it: giving
+// photos unique original filenames, dating the folder by when its photos
+// were taken, and skipping albums without photos new since --since.
+func (fe *FlickrExporter) streamsAlbumPhotos() bool {
+	return !fe.originalFilenames && fe.albumDateSource == albumDateCreated && fe.newPhotoIDs == nil
+}
+
+// streamAlbum downloads album's photos while they're being listed, each
+// page as soon as it's listed, and returns how many there were.
+func (fe *FlickrExporter) streamAlbum(album Album) (int, error) {
+	if fe.maxPhotos.reached() {
+		return 0, nil
+	}
+
+	fe.logf("Downloading photos to %s as they're listed\n", filepath.Join(fe.outputDir, fe.albumDir(album)))
+
+	// One page is listed ahead of the one being downloaded.
+	pages := make(chan photoPage, 1)
+	go func() {
+		defer close(pages)
+		err := fe.listAlbumPhotos(album.ID, func(photos []Photo) {
+			pages <- photoPage{photos: photos}
+		})
+		if err != nil {
+			pages <- photoPage{err: err}
+		}
+	}()
+
+	return fe.downloadAlbumPages(album, pages)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+
+	"gopkg.in/masci/flickr.v3"
+)
+
+// albumKeywordPrefix is prepended to album titles written as keywords, to
+// tell them apart from the photo's own tags.
+const albumKeywordPrefix = "album:"
+
+// PhotoContextsResponse represents the response from
+// flickr.photos.getAllContexts
+type PhotoContextsResponse struct {
+	flickr.BasicResponse
+	Sets []PhotoContextSet `xml:"set"`
+}
+
+type PhotoContextSet struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+}
+
+// getPhotoAlbums returns the titles of every album photoID belongs to.
+func (fe *FlickrExporter) getPhotoAlbums(photoID string) ([]string, error) {
+	response := &PhotoContextsResponse{}
+	err := fe.withRetry("getting albums for "+photoID, func() error {
+		response = &PhotoContextsResponse{}
+		return fe.api.Get("flickr.photos.getAllContexts", url.Values{"photo_id": {photoID}}, true, response)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get albums for %s: %w", photoID, err)
+	}
+
+	var albums []string
+	for _, set := range response.Sets {
+		albums = append(albums, set.Title)
+	}
+	return albums, nil
+}
+
+// albumMembershipKeywords returns the keywords recording membership in albums.
+func albumMembershipKeywords(albums []string) []string {
+	var keywords []string
+	for _, album := range albums {
+		keywords = append(keywords, albumKeywordPrefix+album)
+	}
+	return keywords
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/masci/flickr.v3"
+)
+
+// flickrErrServiceUnavailable is the error code Flickr returns from any API
+// method when it's temporarily overloaded or down.
+const flickrErrServiceUnavailable = 105
+
+// FlickrAPIError is an error returned by a Flickr API method. Code is
+// Flickr's error code for the method, or -1 if the response wasn't a valid
+// API response at all (e.g. an HTML error page), in which case Msg is the
+// body of the response.
+type FlickrAPIError struct {
+	Code int
+	Msg  string
+}
+
+func (e *FlickrAPIError) Error() string {
+	return fmt.Sprintf("flickr API error %d: %s", e.Code, e.Msg)
+}
+
+// apiError converts err, returned by a Flickr API call along with response,
+// to a *FlickrAPIError if it was caused by Flickr responding with an error.
+// The flickr package only reports the message of such errors. Other errors,
+// such as network errors, are returned unchanged.
+func apiError(response flickr.FlickrResponse, err error) error {
+	if err != nil && response.HasErrors() && response.ErrorCode() != 0 {
+		return &FlickrAPIError{Code: response.ErrorCode(), Msg: response.ErrorMsg()}
+	}
+	return err
+}
+
+// isRetryableError reports whether err means Flickr is rate limiting us or is
+// temporarily unavailable, or that a download was corrupted, so the request
+// should be retried after a delay.
+func isRetryableError(err error) bool {
+	var apiErr *FlickrAPIError
+	if errors.As(err, &apiErr) && apiErr.Code == flickrErrServiceUnavailable {
+		return true
+	}
+	// Server errors, such as an HTTP 500 or 502, come back as an HTML error
+	// page in place of an API response. Other invalid responses, such as
+	// OAuth errors, are plain text and won't go away by retrying.
+	if apiErr != nil && apiErr.Code == -1 && isHTMLPage(apiErr.Msg) {
+		return true
+	}
+	var mismatch *dimensionMismatchError
+	if errors.As(err, &mismatch) {
+		return true
+	}
+	// A download cut off before its Content-Length was read.
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	// Rate limiting is reported as an HTTP 429, rather than with an API
+	// error code, both for downloads and for API calls.
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "http 429") ||
+		strings.Contains(msg, "rate limit") ||
+		strings.Contains(msg, "too many requests")
+}
+
+// isHTMLPage reports whether body looks like an HTML page.
+func isHTMLPage(body string) bool {
+	start := strings.ToLower(strings.TrimSpace(body))
+	return strings.HasPrefix(start, "<!doctype html") || strings.HasPrefix(start, "<html")
+}
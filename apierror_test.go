@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gopkg.in/masci/flickr.v3"
+)
+
+// roundTripFunc serves HTTP requests without network access.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestFlickrClientErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		wantCode      int // 0 for no error
+		wantMsg       string
+		wantRetryable bool
+	}{
+		{"ok", 200, `<rsp stat="ok"></rsp>`, 0, "", false},
+		{"not found", 200, `<rsp stat="fail"><err code="1" msg="Photo not found" /></rsp>`, 1, "Photo not found", false},
+		{"unavailable", 200, `<rsp stat="fail"><err code="105" msg="Service currently unavailable" /></rsp>`, 105, "Service currently unavailable", true},
+		{"unknown code", 200, `<rsp stat="fail"><err code="9999" msg="Something new" /></rsp>`, 9999, "Something new", false},
+		{"HTML error page", 502, "<!DOCTYPE html>\n<html><body>Bad Gateway</body></html>", -1, "<!DOCTYPE html>\n<html><body>Bad Gateway</body></html>", true},
+		{"OAuth error", 401, "oauth_problem=signature_invalid", -1, "oauth_problem=signature_invalid", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &flickrClient{apiKey: "key", apiSecret: "secret", httpClient: &http.Client{
+				Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+					if got := r.URL.Query().Get("method"); got != "flickr.test.echo" {
+						t.Errorf("called method %q, want flickr.test.echo", got)
+					}
+					return &http.Response{
+						StatusCode: tt.status,
+						Body:       io.NopCloser(strings.NewReader(tt.body)),
+						Request:    r,
+					}, nil
+				}),
+			}}
+
+			err := api.Get("flickr.test.echo", url.Values{}, false, &flickr.BasicResponse{})
+			if tt.wantCode == 0 {
+				if err != nil {
+					t.Fatalf("Get: %v", err)
+				}
+				return
+			}
+			var apiErr *FlickrAPIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("got error %v, want a *FlickrAPIError", err)
+			}
+			if apiErr.Code != tt.wantCode || apiErr.Msg != tt.wantMsg {
+				t.Errorf("got error %d %q, want %d %q", apiErr.Code, apiErr.Msg, tt.wantCode, tt.wantMsg)
+			}
+			if got := isRetryableError(err); got != tt.wantRetryable {
+				t.Errorf("isRetryableError = %v, want %v", got, tt.wantRetryable)
+			}
+		})
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"service unavailable", &FlickrAPIError{Code: flickrErrServiceUnavailable, Msg: "Service currently unavailable"}, true},
+		{"wrapped service unavailable", fmt.Errorf("failed to get photos page 2: %w", &FlickrAPIError{Code: flickrErrServiceUnavailable}), true},
+		{"not found", &FlickrAPIError{Code: 1, Msg: "Photo not found"}, false},
+		{"unknown code", &FlickrAPIError{Code: 9999, Msg: "Something new"}, false},
+		{"HTML error page", &FlickrAPIError{Code: -1, Msg: "  <html><body>502 Bad Gateway</body></html>"}, true},
+		{"invalid response", &FlickrAPIError{Code: -1, Msg: "oauth_problem=token_rejected"}, false},
+		{"download rate limited", errors.New("HTTP 429: 429 Too Many Requests"), true},
+		{"rate limit message", errors.New("Rate limit exceeded"), true},
+		{"download not found", errors.New("HTTP 404: 404 Not Found"), false},
+		{"dimension mismatch", &dimensionMismatchError{filename: "a.jpg", expectedWidth: 2, expectedHeight: 2, actualWidth: 1, actualHeight: 1}, true},
+		{"truncated download", fmt.Errorf("downloading a.jpg: %w", io.ErrUnexpectedEOF), true},
+		{"network error", errors.New("dial tcp: lookup api.flickr.com: no such host"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableError(tt.err); got != tt.want {
+				t.Errorf("isRetryableError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// zipDirectory writes the contents of dir to dir+".zip", with entries
+// nested under the directory's name. It returns false without doing anything
+// if the archive already exists and is at least as new as the directory.
+func zipDirectory(dir string) (bool, error) {
+	zipPath := dir + ".zip"
+
+	dirInfo, err := os.Stat(dir)
+	if err != nil {
+		return false, err
+	}
+	if zipInfo, err := os.Stat(zipPath); err == nil && !zipInfo.ModTime().Before(dirInfo.ModTime()) {
+		return false, nil
+	}
+
+	// Write to a temporary file first so an interrupted run never leaves a
+	// truncated archive that looks up to date.
+	tmpPath := zipPath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer os.Remove(tmpPath)
+
+	if err := writeZip(file, dir); err != nil {
+		file.Close()
+		return false, err
+	}
+	if err := file.Close(); err != nil {
+		return false, fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, zipPath); err != nil {
+		return false, fmt.Errorf("failed to move archive into place: %w", err)
+	}
+
+	return true, nil
+}
+
+func writeZip(w io.Writer, dir string) error {
+	zw := zip.NewWriter(w)
+	parent := filepath.Dir(dir)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(parent, path)
+		if err != nil {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if d.IsDir() {
+			header.Name += "/"
+			_, err := zw.CreateHeader(header)
+			return err
+		}
+		header.Method = zip.Deflate
+
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(entry, file)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	return nil
+}
+
+// archiveAlbum zips albumPath if archiving is enabled. The directory is
+// removed afterward if requested, but only when every photo in the album was
+// exported successfully, so failed photos can be retried on the next run.
+func (fe *FlickrExporter) archiveAlbum(albumPath string, complete bool) {
+	if !fe.zip {
+		return
+	}
+
+	created, err := zipDirectory(albumPath)
+	if err != nil {
+		fe.warnf("  Warning: Failed to archive %s: %v\n", albumPath, err)
+		return
+	}
+	if created {
+		fe.logf("Archived %s.zip\n", albumPath)
+	} else if fe.verbose {
+		fe.logf("  Skipping archive (already up to date): %s.zip\n", albumPath)
+	}
+
+	if fe.zipRemove && complete {
+		if err := os.RemoveAll(albumPath); err != nil {
+			fe.warnf("  Warning: Failed to remove %s after archiving: %v\n", albumPath, err)
+		}
+	}
+}
+
+// unzipDirectory restores dir from dir+".zip", written by zipDirectory. Only
+// entries nested under the directory's name are extracted.
+func unzipDirectory(dir string) error {
+	zr, err := zip.OpenReader(dir + ".zip")
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	parent := filepath.Dir(dir)
+	prefix := filepath.Base(dir) + "/"
+	for _, entry := range zr.File {
+		if !strings.HasPrefix(entry.Name, prefix) || !filepath.IsLocal(entry.Name) {
+			continue
+		}
+		path := filepath.Join(parent, filepath.FromSlash(entry.Name))
+		if entry.FileInfo().IsDir() {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := unzipFile(entry, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unzipFile(entry *zip.File, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	r, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	return file.Close()
+}
+
+// restoreArchivedAlbum restores albumPath from its archive if --zip-remove
+// removed it, before the album is exported again after changing on Flickr.
+// Its photos are then skipped as already exported rather than downloaded
+// again, and the album is archived again with all of them. If it can't be
+// restored, every photo is downloaded again.
+func (fe *FlickrExporter) restoreArchivedAlbum(albumPath string) {
+	if !fe.zipRemove {
+		return
+	}
+	if _, err := os.Stat(albumPath); !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if _, err := os.Stat(albumPath + ".zip"); err != nil {
+		return
+	}
+	if err := unzipDirectory(albumPath); err != nil {
+		fe.warnf("  Warning: Failed to restore %s from its archive, so its photos will be downloaded again: %v\n", albumPath, err)
+		return
+	}
+	if fe.verbose {
+		fe.logf("  Restored %s from its archive\n", albumPath)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const catalogCSVFilename = "catalog.csv"
+
+type catalogEntry struct {
+	Photo Photo
+	// Album is the album the photo was exported as part of; its Photos
+	// field is not populated. Unorganized photos have an empty album ID.
+	Album Album
+	// Path is the photo's location relative to the output directory.
+	Path string
+	// Downloaded is true if the photo was downloaded during this run, as
+	// opposed to being skipped because it already existed.
+	Downloaded bool
+}
+
+// catalog accumulates an entry for each photo processed during an export.
+// It is safe for concurrent use by multiple workers.
+type catalog struct {
+	mu      sync.Mutex
+	csv     bool
+	sqlite  bool
+	entries []catalogEntry
+}
+
+// newCatalog returns a catalog that will be written in each of the given
+// formats, or nil if formats is empty.
+func newCatalog(formats []string) (*catalog, error) {
+	if len(formats) == 0 {
+		return nil, nil
+	}
+
+	c := &catalog{}
+	for _, format := range formats {
+		switch format {
+		case "csv":
+			c.csv = true
+		case "sqlite":
+			c.sqlite = true
+		default:
+			return nil, fmt.Errorf("unsupported catalog format %q", format)
+		}
+	}
+
+	return c, nil
+}
+
+func (c *catalog) add(entry catalogEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = append(c.entries, entry)
+}
+
+func (c *catalog) writeCSV(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create catalog file: %w", err)
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	if err := w.Write([]string{"id", "title", "album", "date_taken", "date_uploaded", "filename", "path", "tags", "original_url", "page_url", "album_id", "position"}); err != nil {
+		return fmt.Errorf("failed to write catalog: %w", err)
+	}
+
+	for _, entry := range c.entries {
+		var dateTaken string
+		if !entry.Photo.DateTaken.IsZero() {
+			dateTaken = entry.Photo.DateTaken.Format(time.DateTime)
+		}
+		var dateUploaded string
+		if !entry.Photo.DateUploaded.IsZero() {
+			dateUploaded = entry.Photo.DateUploaded.UTC().Format(time.RFC3339)
+		}
+		var position string
+		if entry.Photo.Position > 0 {
+			position = strconv.Itoa(entry.Photo.Position)
+		}
+		record := []string{
+			entry.Photo.ID,
+			entry.Photo.Title,
+			entry.Album.Title,
+			dateTaken,
+			dateUploaded,
+			entry.Photo.Filename,
+			entry.Path,
+			strings.Join(entry.Photo.Tags, ", "),
+			entry.Photo.OriginalURL,
+			entry.Photo.PageURL,
+			entry.Album.ID,
+			position,
+		}
+		if err := w.Write(record); err != nil {
+			return fmt.Errorf("failed to write catalog: %w", err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write catalog: %w", err)
+	}
+
+	return nil
+}
+
+// recordPhoto notes that photo has been exported, adding it to the export
+// catalog if one is being kept.
+func (fe *FlickrExporter) recordPhoto(album Album, photo Photo, photoPath string, downloaded bool) {
+	fe.privacyTally.add(photo.Visibility)
+	fe.photoCopies.add(photo.ID, photoPath)
+	fe.exported.addFile(photoPath)
+
+	if fe.catalog == nil {
+		return
+	}
+	// Paths are recorded relative to the output directory so the catalog
+	// stays valid if the export is moved.
+	if rel, err := filepath.Rel(fe.outputDir, photoPath); err == nil {
+		photoPath = rel
+	}
+	album.Photos = nil
+	fe.catalog.add(catalogEntry{
+		Photo:      photo,
+		Album:      album,
+		Path:       photoPath,
+		Downloaded: downloaded,
+	})
+}
+
+func (fe *FlickrExporter) writeCatalog() {
+	if fe.catalog == nil {
+		return
+	}
+	if fe.catalog.csv {
+		if err := fe.catalog.writeCSV(filepath.Join(fe.outputDir, catalogCSVFilename)); err != nil {
+			fe.warnf("Warning: Failed to write catalog: %v\n", err)
+		}
+	}
+	if fe.catalog.sqlite {
+		if err := fe.catalog.writeSQLite(fe.outputDir); err != nil {
+			fe.warnf("Warning: Failed to update catalog database: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const catalogSQLiteFilename = "catalog.sqlite"
+
+const catalogSchema = `
+CREATE TABLE IF NOT EXISTS albums (
+	id               TEXT PRIMARY KEY,
+	title            TEXT NOT NULL,
+	description      TEXT NOT NULL,
+	date_created     TEXT,
+	last_exported_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS photos (
+	id                TEXT PRIMARY KEY,
+	title             TEXT NOT NULL,
+	description       TEXT NOT NULL,
+	date_taken        TEXT,
+	date_uploaded     TEXT,
+	tags              TEXT NOT NULL,
+	filename          TEXT NOT NULL,
+	path              TEXT NOT NULL,
+	original_url      TEXT NOT NULL,
+	page_url          TEXT NOT NULL DEFAULT '',
+	sha256            TEXT NOT NULL,
+	first_exported_at TEXT NOT NULL,
+	last_exported_at  TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS album_photos (
+	album_id TEXT NOT NULL REFERENCES albums (id),
+	photo_id TEXT NOT NULL REFERENCES photos (id),
+	path     TEXT NOT NULL,
+	position INTEGER,
+	PRIMARY KEY (album_id, photo_id)
+);
+`
+
+// catalogMigrations bring databases created by older versions up to date
+// with catalogSchema. Each is applied on every run, and "duplicate column"
+// errors from ones that were already applied are ignored.
+var catalogMigrations = []string{
+	`ALTER TABLE photos ADD COLUMN date_uploaded TEXT`,
+	`ALTER TABLE photos ADD COLUMN page_url TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE album_photos ADD COLUMN position INTEGER`,
+}
+
+// Photos that were skipped because they already exist on disk don't have
+// their description, tags, dates, or page URL fetched, so those columns keep
+// their previous values rather than being cleared.
+const upsertPhotoSQL = `
+INSERT INTO photos (id, title, description, date_taken, date_uploaded, tags, filename, path, original_url, page_url, sha256, first_exported_at, last_exported_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (id) DO UPDATE SET
+	title            = excluded.title,
+	description      = COALESCE(NULLIF(excluded.description, ''), photos.description),
+	date_taken       = COALESCE(excluded.date_taken, photos.date_taken),
+	date_uploaded    = COALESCE(excluded.date_uploaded, photos.date_uploaded),
+	tags             = COALESCE(NULLIF(excluded.tags, ''), photos.tags),
+	filename         = excluded.filename,
+	path             = excluded.path,
+	original_url     = excluded.original_url,
+	page_url         = COALESCE(NULLIF(excluded.page_url, ''), photos.page_url),
+	sha256           = COALESCE(NULLIF(excluded.sha256, ''), photos.sha256),
+	last_exported_at = excluded.last_exported_at
+`
+
+const upsertAlbumSQL = `
+INSERT INTO albums (id, title, description, date_created, last_exported_at)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (id) DO UPDATE SET
+	title            = excluded.title,
+	description      = excluded.description,
+	date_created     = excluded.date_created,
+	last_exported_at = excluded.last_exported_at
+`
+
+const upsertAlbumPhotoSQL = `
+INSERT INTO album_photos (album_id, photo_id, path, position)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (album_id, photo_id) DO UPDATE SET
+	path     = excluded.path,
+	position = COALESCE(excluded.position, album_photos.position)
+`
+
+// writeSQLite upserts the catalog's entries into the catalog database in
+// outputDir, creating it if needed.
+func (c *catalog) writeSQLite(outputDir string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	db, err := sql.Open("sqlite", filepath.Join(outputDir, catalogSQLiteFilename))
+	if err != nil {
+		return fmt.Errorf("failed to open catalog database: %w", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(catalogSchema); err != nil {
+		return fmt.Errorf("failed to create catalog schema: %w", err)
+	}
+	for _, migration := range catalogMigrations {
+		if _, err := db.Exec(migration); err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			return fmt.Errorf("failed to migrate catalog schema: %w", err)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	exportedAt := time.Now().UTC().Format(time.RFC3339)
+
+	for _, entry := range c.entries {
+		var checksum string
+		if entry.Downloaded || !hasChecksum(tx, entry.Photo.ID) {
+			checksum, err = fileSHA256(filepath.Join(outputDir, entry.Path))
+			if err != nil {
+				return fmt.Errorf("failed to checksum %s: %w", entry.Path, err)
+			}
+		}
+
+		var dateTaken any
+		if !entry.Photo.DateTaken.IsZero() {
+			dateTaken = entry.Photo.DateTaken.Format(time.DateTime)
+		}
+		var dateUploaded any
+		if !entry.Photo.DateUploaded.IsZero() {
+			dateUploaded = entry.Photo.DateUploaded.UTC().Format(time.RFC3339)
+		}
+
+		_, err = tx.Exec(upsertPhotoSQL,
+			entry.Photo.ID,
+			entry.Photo.Title,
+			entry.Photo.Description,
+			dateTaken,
+			dateUploaded,
+			strings.Join(entry.Photo.Tags, ", "),
+			entry.Photo.Filename,
+			entry.Path,
+			entry.Photo.OriginalURL,
+			entry.Photo.PageURL,
+			checksum,
+			exportedAt,
+			exportedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save photo %s: %w", entry.Photo.ID, err)
+		}
+
+		if entry.Album.ID == "" {
+			continue
+		}
+
+		var dateCreated any
+		if !entry.Album.DateCreated.IsZero() {
+			dateCreated = entry.Album.DateCreated.Format(time.DateTime)
+		}
+
+		_, err = tx.Exec(upsertAlbumSQL,
+			entry.Album.ID,
+			entry.Album.Title,
+			entry.Album.Description,
+			dateCreated,
+			exportedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save album %s: %w", entry.Album.ID, err)
+		}
+
+		var position any
+		if entry.Photo.Position > 0 {
+			position = entry.Photo.Position
+		}
+
+		_, err = tx.Exec(upsertAlbumPhotoSQL, entry.Album.ID, entry.Photo.ID, entry.Path, position)
+		if err != nil {
+			return fmt.Errorf("failed to save album membership for photo %s: %w", entry.Photo.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit catalog database: %w", err)
+	}
+
+	return nil
+}
+
+func hasChecksum(tx *sql.Tx, photoID string) bool {
+	var checksum string
+	err := tx.QueryRow("SELECT sha256 FROM photos WHERE id = ?", photoID).Scan(&checksum)
+	return err == nil && checksum != ""
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// completeAlbumFilename names the file in an album's folder recording when
+// the album was last changed on Flickr, as of the last time all of its photos
+// were exported. Flickr updates that time whenever photos are added to or
+// removed from the album, so if it hasn't changed, there's nothing new to
+// export and the album's photos needn't be listed again. The options the
+// photos were saved with are recorded on the next line.
+const completeAlbumFilename = ".flickr-exporter-album"
+
+// completeAlbumPath returns the file recording that the album exported to
+// albumPath is complete. With --zip-remove, the album's folder is removed
+// once it's archived, so the record is kept next to the archive instead, as
+// e.g. ".2018-06-02 Iceland.zip.flickr-exporter-album".
+func (fe *FlickrExporter) completeAlbumPath(albumPath string) string {
+	if fe.zipRemove {
+		return filepath.Join(filepath.Dir(albumPath), "."+filepath.Base(albumPath)+".zip"+completeAlbumFilename)
+	}
+	return filepath.Join(albumPath, completeAlbumFilename)
+}
+
+// skipsCompleteAlbums reports whether albums whose folders are up to date can
+// be skipped without listing their photos. Options that need every photo to
+// be listed, such as for the catalog or to find duplicates to link, turn
+// this off.
+func (fe *FlickrExporter) skipsCompleteAlbums() bool {
+	return !fe.relistAlbums && !fe.overwrite && fe.catalog == nil && fe.photoCopies == nil &&
+		fe.albumDateSource == albumDateCreated
+}
+
+// exportsWholeAlbums reports whether every photo in each album is exported,
+// rather than only those selected by filtering options, so that albums can
+// be recorded as complete.
+func (fe *FlickrExporter) exportsWholeAlbums() bool {
+	return fe.fromPage == 0 && fe.toPage == 0 &&
+		fe.privacy == privacyAny && !fe.filtersSafety() &&
+		fe.since.IsZero() && fe.maxPhotos == nil && len(fe.ignoredPhotos) == 0
+}
+
+// completeAlbumOptions returns the options that decide which files an
+// album's photos are saved as, recorded with complete albums. If they've
+// changed, the photos' files might not exist yet, so the album is listed.
+func (fe *FlickrExporter) completeAlbumOptions() string {
+	return fmt.Sprintf("size=%s largest-available=%t prefer-original-filename=%t replace-spaces=%q",
+		fe.size, fe.largestAvailable, fe.originalFilenames, fe.replaceSpaces)
+}
+
+// albumComplete reports whether every photo in album was exported to its
+// folder, or archive with --zip-remove, by an earlier run with the same
+// completeAlbumOptions, and the album hasn't changed on Flickr since.
+func (fe *FlickrExporter) albumComplete(album Album) bool {
+	if album.DateUpdated.IsZero() || !fe.skipsCompleteAlbums() {
+		return false
+	}
+
+	data, err := os.ReadFile(fe.completeAlbumPath(filepath.Join(fe.outputDir, fe.albumDir(album))))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			fe.warnf("  Warning: Failed to read %s for %s: %v\n", completeAlbumFilename, album.Title, err)
+		}
+		return false
+	}
+	updatedLine, options, _ := strings.Cut(strings.TrimSpace(string(data)), "\n")
+	updated, err := strconv.ParseInt(strings.TrimSpace(updatedLine), 10, 64)
+	return err == nil && updated == album.DateUpdated.Unix() &&
+		strings.TrimSpace(options) == fe.completeAlbumOptions()
+}
+
+// markAlbumComplete records that every photo in album has been exported to
+// albumPath, so that the album can be skipped until it changes on Flickr.
+func (fe *FlickrExporter) markAlbumComplete(album Album, albumPath string) {
+	if album.DateUpdated.IsZero() || !fe.exportsWholeAlbums() {
+		return
+	}
+
+	data := fmt.Sprintf("%d\n%s\n", album.DateUpdated.Unix(), fe.completeAlbumOptions())
+	if err := os.WriteFile(fe.completeAlbumPath(albumPath), []byte(data), 0644); err != nil {
+		fe.warnf("  Warning: Failed to record that %s is complete: %v\n", album.Title, err)
+	}
+}
+
+// albumDateUpdated converts a date_update timestamp from the Flickr API.
+func albumDateUpdated(timestamp int) time.Time {
+	if timestamp <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(timestamp), 0)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAlbumCompleteRecordsOptions(t *testing.T) {
+	newExporter := func(outputDir string) *FlickrExporter {
+		return &FlickrExporter{
+			outputDir:       outputDir,
+			dateFormat:      defaultDateFormat,
+			pathSeparator:   " ",
+			albumDateSource: albumDateCreated,
+			size:            sizeOriginal,
+			privacy:         privacyAny,
+			safetyLevel:     safetyRestricted,
+		}
+	}
+	album := Album{
+		ID:          "72157600000000001",
+		Title:       "Iceland",
+		DateCreated: time.Date(2018, 6, 2, 12, 0, 0, 0, time.UTC),
+		DateUpdated: time.Date(2019, 1, 5, 8, 30, 0, 0, time.UTC),
+	}
+
+	outputDir := t.TempDir()
+	fe := newExporter(outputDir)
+	albumPath := filepath.Join(outputDir, fe.albumDir(album))
+	if err := os.MkdirAll(albumPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	fe.markAlbumComplete(album, albumPath)
+	if !fe.albumComplete(album) {
+		t.Fatal("album isn't complete after being marked complete")
+	}
+
+	changed := map[string]func(*FlickrExporter){
+		"size":                     func(fe *FlickrExporter) { fe.size = "large" },
+		"largest-available":        func(fe *FlickrExporter) { fe.largestAvailable = true },
+		"prefer-original-filename": func(fe *FlickrExporter) { fe.originalFilenames = true },
+		"replace-spaces":           func(fe *FlickrExporter) { fe.replaceSpaces = "_" },
+	}
+	for name, change := range changed {
+		t.Run(name, func(t *testing.T) {
+			other := newExporter(outputDir)
+			change(other)
+			if other.albumComplete(album) {
+				t.Errorf("album exported with different %s options is complete", name)
+			}
+		})
+	}
+
+	updated := album
+	updated.DateUpdated = album.DateUpdated.Add(time.Hour)
+	if fe.albumComplete(updated) {
+		t.Error("album changed on Flickr since it was marked complete is complete")
+	}
+}
+
+func TestAlbumCompleteOldMarker(t *testing.T) {
+	// Markers written before the options were recorded only hold the time
+	// the album was updated; those albums are listed once more.
+	outputDir := t.TempDir()
+	fe := &FlickrExporter{
+		outputDir:       outputDir,
+		dateFormat:      defaultDateFormat,
+		pathSeparator:   " ",
+		albumDateSource: albumDateCreated,
+		size:            sizeOriginal,
+		privacy:         privacyAny,
+		safetyLevel:     safetyRestricted,
+	}
+	album := Album{
+		ID:          "72157600000000001",
+		Title:       "Iceland",
+		DateCreated: time.Date(2018, 6, 2, 12, 0, 0, 0, time.UTC),
+		DateUpdated: time.Date(2019, 1, 5, 8, 30, 0, 0, time.UTC),
+	}
+	albumPath := filepath.Join(outputDir, fe.albumDir(album))
+	if err := os.MkdirAll(albumPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fe.completeAlbumPath(albumPath), []byte("1546677000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if fe.albumComplete(album) {
+		t.Error("album with a marker that doesn't record its options is complete")
+	}
+}
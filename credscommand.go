@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// runCredsCommand runs command with the system shell and returns its
+// standard output, which holds the credentials. The command's standard input
+// and error are the terminal's, so that a secrets manager can prompt to
+// unlock its vault.
+func runCredsCommand(command string) ([]byte, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	var stdout bytes.Buffer
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("credentials command failed: %w", err)
+	}
+	if strings.TrimSpace(stdout.String()) == "" {
+		return nil, fmt.Errorf("credentials command printed nothing")
+	}
+	return stdout.Bytes(), nil
+}
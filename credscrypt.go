@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// encryptedCredsHeader starts the first line of an encrypted credentials
+// file. The rest of the file is the base64-encoded scrypt salt, secretbox
+// nonce, and sealed YAML.
+const encryptedCredsHeader = "flickr-exporter-encrypted-v1"
+
+// passphraseEnv names the environment variable read for the credentials
+// passphrase, so that encrypted credentials can be used non-interactively.
+const passphraseEnv = "FLICKR_EXPORTER_PASSPHRASE"
+
+const (
+	credsSaltSize  = 16
+	credsNonceSize = 24
+)
+
+// credsPassphrase is the passphrase entered for the credentials file, so
+// that it's only asked for once per run.
+var credsPassphrase []byte
+
+func isEncryptedCredentials(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedCredsHeader+"\n"))
+}
+
+// credsKey derives a secretbox key from passphrase and salt.
+func credsKey(passphrase, salt []byte) (*[32]byte, error) {
+	derived, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	var key [32]byte
+	copy(key[:], derived)
+	return &key, nil
+}
+
+// encryptCredentials encrypts the YAML in data with a passphrase, asking for
+// one if it hasn't been entered already.
+func encryptCredentials(data []byte) ([]byte, error) {
+	passphrase, err := credentialsPassphrase(true)
+	if err != nil {
+		return nil, err
+	}
+
+	var salt [credsSaltSize]byte
+	var nonce [credsNonceSize]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	key, err := credsKey(passphrase, salt[:])
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := append(salt[:], nonce[:]...)
+	sealed = secretbox.Seal(sealed, data, &nonce, key)
+	return []byte(encryptedCredsHeader + "\n" + base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+// decryptCredentials decrypts an encrypted credentials file, asking for the
+// passphrase if it hasn't been entered already.
+func decryptCredentials(data []byte) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data[len(encryptedCredsHeader)+1:])))
+	if err != nil || len(sealed) < credsSaltSize+credsNonceSize+secretbox.Overhead {
+		return nil, fmt.Errorf("encrypted credentials file is corrupt")
+	}
+
+	passphrase, err := credentialsPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := sealed[:credsSaltSize]
+	var nonce [credsNonceSize]byte
+	copy(nonce[:], sealed[credsSaltSize:])
+	key, err := credsKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, ok := secretbox.Open(nil, sealed[credsSaltSize+credsNonceSize:], &nonce, key)
+	if !ok {
+		return nil, fmt.Errorf("wrong passphrase for credentials file")
+	}
+	return plain, nil
+}
+
+// credentialsPassphrase returns the passphrase for the credentials file: the
+// one already entered, the value of $FLICKR_EXPORTER_PASSPHRASE, or one read
+// from the terminal. A new passphrase is asked for twice to confirm it.
+func credentialsPassphrase(confirm bool) ([]byte, error) {
+	if credsPassphrase != nil {
+		return credsPassphrase, nil
+	}
+	if env := os.Getenv(passphraseEnv); env != "" {
+		credsPassphrase = []byte(env)
+		return credsPassphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("credentials passphrase is required; set %s to provide it non-interactively", passphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, "Credentials passphrase: ")
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase must not be empty")
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "Confirm passphrase: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		if !bytes.Equal(passphrase, again) {
+			return nil, fmt.Errorf("passphrases don't match")
+		}
+	}
+
+	credsPassphrase = passphrase
+	return credsPassphrase, nil
+}
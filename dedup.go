@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// photoCopies tracks where each photo has been exported, by photo ID, so that
+// photos in several albums can be linked rather than downloaded again. It is
+// safe for concurrent use, and its methods are no-ops on a nil *photoCopies.
+type photoCopies struct {
+	mu    sync.Mutex
+	paths map[string]string
+}
+
+// add records path as a copy of the photo with the given ID, unless one has
+// already been recorded.
+func (c *photoCopies) add(photoID, path string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paths == nil {
+		c.paths = make(map[string]string)
+	}
+	if _, ok := c.paths[photoID]; !ok {
+		c.paths[photoID] = path
+	}
+}
+
+// get returns the path of an exported copy of the photo with the given ID.
+func (c *photoCopies) get(photoID string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	path, ok := c.paths[photoID]
+	return path, ok
+}
+
+// linkDuplicate creates photoPath as a hard link to a copy of photo that has
+// already been exported during this run, falling back to copying the file if
+// the filesystem doesn't support hard links. It returns false if there is no
+// earlier copy or it couldn't be linked, in which case the photo should be
+// downloaded as usual.
+//
+// Two workers may still both download a photo if they reach it at the same
+// time; this only avoids downloading photos that have already finished.
+func (fe *FlickrExporter) linkDuplicate(photo Photo, photoPath string) bool {
+	src, ok := fe.photoCopies.get(photo.ID)
+	if !ok {
+		return false
+	}
+
+	if err := linkOrCopy(src, photoPath); err != nil {
+		if fe.verbose {
+			fe.logf("  Could not link %s to existing copy %s, downloading instead: %v\n", photo.Filename, src, err)
+		}
+		return false
+	}
+
+	if fe.verbose {
+		fe.logf("  Linked to existing copy: %s\n", src)
+	}
+	return true
+}
+
+// linkOrCopy hard links dst to src, or copies src to dst if that fails.
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// Copy to a temporary file first so an interrupted copy is never
+	// mistaken for a complete photo on the next run.
+	tmpPath := dst + ".tmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to copy: %w", err)
+	}
+
+	return os.Rename(tmpPath, dst)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/barasher/go-exiftool"
+	"github.com/spf13/cobra"
+	"gopkg.in/masci/flickr.v3"
+	"gopkg.in/masci/flickr.v3/test"
+)
+
+// doctorTimeout bounds each network request doctor makes when --http-timeout
+// isn't set, so that an unreachable host fails the check instead of hanging.
+const doctorTimeout = 30 * time.Second
+
+// Error codes Flickr returns from any API method for bad credentials.
+const (
+	flickrErrInvalidSignature = 96
+	flickrErrInvalidAuthToken = 98
+	flickrErrInvalidAPIKey    = 100
+)
+
+// flickrAPIRateLimit is how many API calls Flickr allows per key per hour.
+const flickrAPIRateLimit = 3600
+
+// doctorHosts are the hosts the exporter connects to: the API, and the
+// servers photos are downloaded from.
+var doctorHosts = []string{
+	"https://api.flickr.com/services/rest/",
+	"https://live.staticflickr.com/",
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that everything needed for an export is set up",
+	Long: `Check that exiftool is installed, the credentials are valid, the output
+directory is writable, Flickr is reachable, and the API key isn't being
+rate limited, and print how to fix any problems found.
+
+Every check runs even if an earlier one fails. The exit status is 1 if any
+check fails.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		timeout := httpTimeout
+		if !cmd.Flags().Changed("http-timeout") {
+			timeout = doctorTimeout
+		}
+		httpClient := newHTTPClient(timeout, proxyURL)
+
+		checks := []doctorCheck{
+			checkExiftool(),
+			checkOutputDirWritable(outputDir),
+			checkNetwork(httpClient),
+		}
+		credsErr := loadCredsIfProvided()
+		checks = append(checks,
+			checkCredentials(credsErr, httpClient),
+			checkRateLimit(credsErr, httpClient),
+		)
+
+		failed := 0
+		for _, check := range checks {
+			check.print()
+			if check.status == doctorFail {
+				failed++
+			}
+		}
+
+		fmt.Println()
+		if failed > 0 {
+			fmt.Printf("%d of %d checks failed\n", failed, len(checks))
+			os.Exit(exitFatal)
+		}
+		fmt.Println("Everything looks good")
+	},
+}
+
+type doctorStatus string
+
+const (
+	doctorPass doctorStatus = "PASS"
+	doctorFail doctorStatus = "FAIL"
+	doctorSkip doctorStatus = "SKIP"
+)
+
+// doctorCheck is the result of one of doctor's checks. hint says how to fix
+// a failure.
+type doctorCheck struct {
+	name   string
+	status doctorStatus
+	detail string
+	hint   string
+}
+
+func (c doctorCheck) print() {
+	fmt.Printf("[%s] %s: %s\n", c.status, c.name, c.detail)
+	if c.hint != "" {
+		fmt.Printf("       %s\n", c.hint)
+	}
+}
+
+func checkExiftool() doctorCheck {
+	check := doctorCheck{name: "exiftool"}
+	if noMetadata {
+		check.status = doctorSkip
+		check.detail = "not needed with --no-metadata"
+		return check
+	}
+
+	path, err := exec.LookPath("exiftool")
+	if err != nil {
+		check.status = doctorFail
+		check.detail = "not found on the PATH"
+		check.hint = "Install it from https://exiftool.org or your package manager, or use --no-metadata to download photos without metadata."
+		return check
+	}
+	out, err := exec.Command(path, "-ver").Output()
+	if err != nil {
+		check.status = doctorFail
+		check.detail = fmt.Sprintf("%s doesn't run: %v", path, err)
+		check.hint = "Reinstall exiftool; it needs a working Perl installation."
+		return check
+	}
+
+	// Exports run exiftool in its batch mode, so make sure that works too.
+	et, err := exiftool.NewExiftool()
+	if err != nil {
+		check.status = doctorFail
+		check.detail = fmt.Sprintf("%s can't be started in batch mode: %v", path, err)
+		check.hint = "Update exiftool to a recent version from https://exiftool.org."
+		return check
+	}
+	et.Close()
+
+	check.status = doctorPass
+	check.detail = fmt.Sprintf("version %s (%s)", strings.TrimSpace(string(out)), path)
+	return check
+}
+
+// checkOutputDirWritable checks that photos can be written to dir, without
+// creating it: if it doesn't exist yet, its nearest existing parent must be
+// writable.
+func checkOutputDirWritable(dir string) doctorCheck {
+	check := doctorCheck{name: "Output directory"}
+	if dir == streamOutput {
+		// Photos are staged in a temporary directory until they're
+		// streamed.
+		dir = os.TempDir()
+	}
+
+	existing := dir
+	for {
+		info, err := os.Stat(existing)
+		if err == nil {
+			if !info.IsDir() {
+				check.status = doctorFail
+				check.detail = fmt.Sprintf("%s isn't a directory", existing)
+				check.hint = "Choose another output directory with -o."
+				return check
+			}
+			break
+		}
+		parent := filepath.Dir(existing)
+		if !errors.Is(err, os.ErrNotExist) || parent == existing {
+			check.status = doctorFail
+			check.detail = fmt.Sprintf("can't access %s: %v", existing, err)
+			check.hint = "Check the permissions of the output directory, or choose another with -o."
+			return check
+		}
+		existing = parent
+	}
+
+	probe, err := os.CreateTemp(existing, ".flickr-exporter-probe-*")
+	if err != nil {
+		check.status = doctorFail
+		check.detail = fmt.Sprintf("%s isn't writable: %v", existing, err)
+		check.hint = "Check the permissions of the output directory, or choose another with -o."
+		return check
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	check.status = doctorPass
+	if existing == dir {
+		check.detail = fmt.Sprintf("%s is writable", dir)
+	} else {
+		check.detail = fmt.Sprintf("%s will be created in %s", dir, existing)
+	}
+	if free, ok := freeSpace(existing); ok {
+		check.detail += fmt.Sprintf(", with %d MB free", free>>20)
+	}
+	return check
+}
+
+// checkNetwork checks that each of doctorHosts responds to HTTP requests.
+func checkNetwork(httpClient *http.Client) doctorCheck {
+	check := doctorCheck{name: "Network"}
+	var reached []string
+	for _, host := range doctorHosts {
+		resp, err := httpClient.Head(host)
+		if err != nil {
+			check.status = doctorFail
+			check.detail = fmt.Sprintf("can't reach %s: %v", host, err)
+			check.hint = "Check your internet connection and firewall, or set a proxy with --proxy or HTTPS_PROXY."
+			return check
+		}
+		resp.Body.Close()
+		reached = append(reached, resp.Request.URL.Host)
+	}
+
+	check.status = doctorPass
+	check.detail = "reached " + strings.Join(reached, " and ")
+	return check
+}
+
+// checkCredentials checks that the credentials are valid, by logging in to
+// Flickr with them. credsErr is the error loading them, if any.
+func checkCredentials(credsErr error, httpClient *http.Client) doctorCheck {
+	check := doctorCheck{name: "Credentials"}
+	switch {
+	case credsErr != nil:
+		check.status = doctorFail
+		check.detail = credsErr.Error()
+		check.hint = "Fix the credentials file (-c) or --creds-command."
+		return check
+	case apiKey == "" || apiSecret == "":
+		check.status = doctorFail
+		check.detail = "no API key and secret"
+		check.hint = "Provide them via flags, a credentials file (-c), or --creds-command."
+		return check
+	case oauthToken == "" || oauthTokenSecret == "":
+		check.status = doctorFail
+		check.detail = "no OAuth token"
+		check.hint = "Run 'flickr-exporter auth' to authenticate."
+		return check
+	}
+
+	api := &flickrClient{
+		apiKey:           apiKey,
+		apiSecret:        apiSecret,
+		oauthToken:       oauthToken,
+		oauthTokenSecret: oauthTokenSecret,
+		httpClient:       httpClient,
+	}
+	login := &test.LoginResponse{}
+	err := api.Get("flickr.test.login", nil, true, login)
+	if err != nil {
+		check.status = doctorFail
+		check.detail = fmt.Sprintf("logging in failed: %v", err)
+		var apiErr *FlickrAPIError
+		switch {
+		case errors.As(err, &apiErr) && apiErr.Code == flickrErrInvalidAPIKey:
+			check.hint = "Check the API key, or get a new one at https://www.flickr.com/services/apps/create/."
+		case errors.As(err, &apiErr) && (apiErr.Code == flickrErrInvalidAuthToken || apiErr.Code == flickrErrInvalidSignature):
+			check.hint = "The OAuth token may have expired or been revoked, or not match the API key; run 'flickr-exporter refresh -c <file>' to get a new one."
+		case isRetryableError(err):
+			check.hint = "Flickr is unavailable or rate limiting this API key; try again later."
+		default:
+			check.hint = "Check the network check above, and that the API secret and OAuth token secret are correct."
+		}
+		return check
+	}
+
+	check.status = doctorPass
+	check.detail = fmt.Sprintf("logged in as %s (%s)", login.User.Username, login.User.ID)
+	return check
+}
+
+// checkRateLimit checks that Flickr isn't rate limiting the API key. Flickr
+// doesn't report how many calls are left, so this can only tell whether the
+// limit has been reached already.
+func checkRateLimit(credsErr error, httpClient *http.Client) doctorCheck {
+	check := doctorCheck{name: "Rate limit"}
+	if credsErr != nil || apiKey == "" || apiSecret == "" {
+		check.status = doctorSkip
+		check.detail = "needs an API key and secret"
+		return check
+	}
+
+	api := &flickrClient{apiKey: apiKey, apiSecret: apiSecret, httpClient: httpClient}
+	err := api.Get("flickr.test.echo", nil, false, &flickr.BasicResponse{})
+	if err != nil && isRetryableError(err) {
+		check.status = doctorFail
+		check.detail = fmt.Sprintf("Flickr is rate limiting this API key, or is unavailable: %v", err)
+		check.hint = fmt.Sprintf("Flickr allows %d API calls per hour per key; wait an hour, and make sure no other exports are running with the same key.", flickrAPIRateLimit)
+		return check
+	}
+	if err != nil {
+		check.status = doctorFail
+		check.detail = fmt.Sprintf("calling the API failed: %v", err)
+		check.hint = "See the credentials and network checks above."
+		return check
+	}
+
+	check.status = doctorPass
+	check.detail = fmt.Sprintf("not rate limited (Flickr allows %d API calls per hour per key, but doesn't report how many are left)", flickrAPIRateLimit)
+	return check
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// contentHashesFilename names the file in the output directory recording the
+// SHA-256 of each photo downloaded with --report-duplicates, as downloaded
+// from Flickr, before its metadata was written. Each line is a photo ID, its
+// hash, and its path relative to the output directory, separated by tabs.
+// Hashes are kept across exports, so photos downloaded by earlier runs are
+// still compared.
+const contentHashesFilename = ".flickr-exporter-content-hashes"
+
+// duplicatesReportFilename names the report of photos with identical content
+// written to the output directory with --report-duplicates.
+const duplicatesReportFilename = "duplicates.txt"
+
+// contentHashes records the content hash of each downloaded photo, by photo
+// ID. It is safe for concurrent use, and a nil *contentHashes records
+// nothing.
+type contentHashes struct {
+	mu     sync.Mutex
+	photos map[string]contentHash
+}
+
+type contentHash struct {
+	sum  string
+	path string
+}
+
+// loadContentHashes reads the hashes recorded in dir by earlier exports.
+func loadContentHashes(dir string) (*contentHashes, error) {
+	h := &contentHashes{photos: make(map[string]contentHash)}
+	f, err := os.Open(filepath.Join(dir, contentHashesFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content hashes: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		h.photos[fields[0]] = contentHash{sum: fields[1], path: fields[2]}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read content hashes: %w", err)
+	}
+	return h, nil
+}
+
+// add records sum as the content hash of the photo with the given ID,
+// downloaded to path, relative to the output directory.
+func (h *contentHashes) add(photoID, sum, path string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.photos[photoID] = contentHash{sum: sum, path: path}
+}
+
+// save writes every recorded hash to dir, replacing the file.
+func (h *contentHashes) save(dir string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ids := make([]string, 0, len(h.photos))
+	for id := range h.photos {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	var b strings.Builder
+	for _, id := range ids {
+		fmt.Fprintf(&b, "%s\t%s\t%s\n", id, h.photos[id].sum, h.photos[id].path)
+	}
+
+	// Written to a temporary file first, so an interrupted write doesn't
+	// lose the hashes of earlier exports.
+	path := filepath.Join(dir, contentHashesFilename)
+	if err := os.WriteFile(path+".tmp", []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// duplicatePhoto is one of a group of photos with identical content.
+type duplicatePhoto struct {
+	id   string
+	path string
+}
+
+// duplicates returns the groups of photos whose content hashes match, by
+// hash, with each group's photos sorted by ID.
+func (h *contentHashes) duplicates() map[string][]duplicatePhoto {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	bySum := make(map[string][]duplicatePhoto)
+	for id, hash := range h.photos {
+		bySum[hash.sum] = append(bySum[hash.sum], duplicatePhoto{id: id, path: hash.path})
+	}
+	for sum, photos := range bySum {
+		if len(photos) < 2 {
+			delete(bySum, sum)
+			continue
+		}
+		slices.SortFunc(photos, func(a, b duplicatePhoto) int { return strings.Compare(a.id, b.id) })
+	}
+	return bySum
+}
+
+// reportDuplicates saves the content hashes recorded so far, then writes a
+// report of the photos with identical content to the output directory.
+// Nothing is removed, so that duplicates can be reviewed and deleted on
+// Flickr.
+func (fe *FlickrExporter) reportDuplicates() {
+	if fe.contentHashes == nil {
+		return
+	}
+	if err := fe.contentHashes.save(fe.outputDir); err != nil {
+		fe.warnf("Warning: Failed to record content hashes: %v\n", err)
+	}
+
+	groups := fe.contentHashes.duplicates()
+	reportPath := filepath.Join(fe.outputDir, duplicatesReportFilename)
+	if len(groups) == 0 {
+		fe.logf("No photos with identical content found\n")
+		if err := os.Remove(reportPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fe.warnf("Warning: Failed to remove outdated duplicates report: %v\n", err)
+		}
+		return
+	}
+
+	// Groups are listed by their first photo's ID, so that the report
+	// stays in the same order from run to run.
+	sums := make([]string, 0, len(groups))
+	for sum := range groups {
+		sums = append(sums, sum)
+	}
+	slices.SortFunc(sums, func(a, b string) int { return strings.Compare(groups[a][0].id, groups[b][0].id) })
+
+	var b strings.Builder
+	photos := 0
+	for _, sum := range sums {
+		fmt.Fprintf(&b, "SHA-256 %s (%d photos):\n", sum, len(groups[sum]))
+		for _, photo := range groups[sum] {
+			fmt.Fprintf(&b, "  %s  https://www.flickr.com/photo.gne?id=%s  %s\n", photo.id, photo.id, photo.path)
+		}
+		b.WriteString("\n")
+		photos += len(groups[sum])
+	}
+	if err := os.WriteFile(reportPath, []byte(b.String()), 0644); err != nil {
+		fe.warnf("Warning: Failed to write duplicates report: %v\n", err)
+		return
+	}
+	fe.logf("Found %d groups of photos with identical content (%d photos); they're listed in %s\n", len(groups), photos, reportPath)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Output formats accepted by --output-format.
+const (
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+)
+
+// Event types written in the JSON output format.
+const (
+	eventAlbumStarted    = "album_started"
+	eventAlbumFinished   = "album_finished"
+	eventPhotoDownloaded = "photo_downloaded"
+	eventPhotoSkipped    = "photo_skipped"
+	eventPhotoFailed     = "photo_failed"
+	eventSummary         = "summary"
+)
+
+// Reasons given for photo_skipped events.
+const (
+	skipExists    = "exists"
+	skipDuplicate = "duplicate"
+	skipNotNew    = "not_new"
+	skipSafety    = "safety_level"
+	skipIgnored   = "ignored"
+)
+
+func validateOutputFormat(format string) error {
+	switch format {
+	case outputFormatText, outputFormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("invalid output format %q (must be one of: text, json)", format)
+	}
+}
+
+// exportEvent is one line of JSON output. Fields that don't apply to an
+// event's type are omitted.
+type exportEvent struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	AlbumID string    `json:"album_id,omitempty"`
+	Album   string    `json:"album,omitempty"`
+	PhotoID string    `json:"photo_id,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	// Photos is the number of photos in an album, for album_started.
+	Photos int `json:"photos,omitempty"`
+	// Duration is the time since the run started, in seconds, for
+	// summary.
+	Duration float64 `json:"duration_seconds,omitempty"`
+	*eventCounts
+}
+
+// eventCounts tallies photo outcomes, for album_finished and summary events.
+type eventCounts struct {
+	Downloaded int `json:"downloaded"`
+	Skipped    int `json:"skipped"`
+	Failed     int `json:"failed"`
+}
+
+// eventLog writes newline-delimited JSON events describing the export, and
+// collects the outcome of each album and photo for the --json result. Its
+// methods are safe for concurrent use, and are no-ops on a nil *eventLog so
+// callers needn't check whether JSON output is enabled.
+type eventLog struct {
+	mu sync.Mutex
+	// enc is nil if only the result is collected, for --json.
+	enc     *json.Encoder
+	started time.Time
+	total   eventCounts
+	bytes   int64
+	// albums tallies the photos in each album being exported, keyed by
+	// the album's directory.
+	albums map[string]*eventCounts
+	// finished and failures are the albums exported and the photos that
+	// failed so far, for the result.
+	finished []albumResult
+	failures []photoFailure
+}
+
+// newEventLog returns an event log writing events to w, or only collecting
+// the result if w is nil.
+func newEventLog(w io.Writer) *eventLog {
+	l := &eventLog{
+		started: time.Now(),
+		albums:  make(map[string]*eventCounts),
+	}
+	if w != nil {
+		l.enc = json.NewEncoder(w)
+	}
+	return l
+}
+
+func (l *eventLog) albumStarted(album Album, albumPath string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.albums[albumPath] = &eventCounts{}
+	l.write(exportEvent{
+		Type:    eventAlbumStarted,
+		AlbumID: album.ID,
+		Album:   album.Title,
+		Path:    albumPath,
+		Photos:  len(album.Photos),
+	})
+}
+
+func (l *eventLog) albumFinished(album Album, albumPath string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	counts := l.albums[albumPath]
+	if counts == nil {
+		counts = &eventCounts{}
+	}
+	delete(l.albums, albumPath)
+	l.finished = append(l.finished, albumResult{
+		ID:          album.ID,
+		Title:       album.Title,
+		Path:        albumPath,
+		eventCounts: *counts,
+	})
+	l.write(exportEvent{
+		Type:        eventAlbumFinished,
+		AlbumID:     album.ID,
+		Album:       album.Title,
+		Path:        albumPath,
+		eventCounts: counts,
+	})
+}
+
+func (l *eventLog) photoDownloaded(album Album, photo Photo, photoPath string) {
+	if l == nil {
+		return
+	}
+	l.photo(album, photo, photoPath, exportEvent{Type: eventPhotoDownloaded}, func(c *eventCounts) { c.Downloaded++ })
+}
+
+// photoSkipped records that a photo wasn't downloaded, for one of the skip
+// reasons above.
+func (l *eventLog) photoSkipped(album Album, photo Photo, photoPath, reason string) {
+	if l == nil {
+		return
+	}
+	l.photo(album, photo, photoPath, exportEvent{Type: eventPhotoSkipped, Reason: reason}, func(c *eventCounts) { c.Skipped++ })
+}
+
+func (l *eventLog) photoFailed(album Album, photo Photo, photoPath string, err error) {
+	if l == nil {
+		return
+	}
+	l.photo(album, photo, photoPath, exportEvent{Type: eventPhotoFailed, Error: err.Error()}, func(c *eventCounts) { c.Failed++ })
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failures = append(l.failures, photoFailure{
+		AlbumID: album.ID,
+		Album:   album.Title,
+		PhotoID: photo.ID,
+		Path:    photoPath,
+		Error:   err.Error(),
+	})
+}
+
+// addBytes records n bytes downloaded, for the result.
+func (l *eventLog) addBytes(n int64) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bytes += n
+}
+
+// photo writes a photo event and counts it toward its album and the run.
+func (l *eventLog) photo(album Album, photo Photo, photoPath string, e exportEvent, count func(*eventCounts)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	count(&l.total)
+	if counts := l.albums[filepath.Dir(photoPath)]; counts != nil {
+		count(counts)
+	}
+	e.AlbumID = album.ID
+	e.Album = album.Title
+	e.PhotoID = photo.ID
+	e.Path = photoPath
+	l.write(e)
+}
+
+// summary writes the totals for the run so far. Commands that export several
+// items write one after each, so the last covers the whole run.
+func (l *eventLog) summary() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	total := l.total
+	l.write(exportEvent{
+		Type:        eventSummary,
+		Duration:    time.Since(l.started).Seconds(),
+		eventCounts: &total,
+	})
+}
+
+// write encodes e as a line of JSON, unless only the result is collected;
+// l.mu must be held.
+func (l *eventLog) write(e exportEvent) {
+	if l.enc == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	_ = l.enc.Encode(e)
+}
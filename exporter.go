@@ -1,25 +1,394 @@
 package main
 
 import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/barasher/go-exiftool"
+	"golang.org/x/net/http/httpproxy"
 	"gopkg.in/masci/flickr.v3"
 	"gopkg.in/masci/flickr.v3/photosets"
 )
 
+// unorganizedAlbumTitle names the photos that aren't in any album, and by
+// default the folder they're exported to.
+const unorganizedAlbumTitle = "Unorganized Photos"
+
 type FlickrExporter struct {
-	client    *flickr.FlickrClient
-	outputDir string
-	et        *exiftool.Exiftool
-	verbose   bool
+	api             FlickrAPI
+	httpClient      *http.Client
+	outputDir       string
+	et              *exiftool.Exiftool
+	verbose         bool
+	html            bool
+	catalog         *catalog
+	zip             bool
+	zipRemove       bool
+	writeUploadDate bool
+	preferEXIFDate  bool
+	includeNotes    bool
+	includeStats    bool
+	albumKeywords   bool
+	tagPrefix       string
+	copyright       string
+	photoCopies     *photoCopies
+	photoInfo       *photoInfoCache
+	concurrency     int
+	includeAlbums   []string
+	excludeAlbums   []string
+	ignoredAlbums   []string
+	ignoredPhotos   []string
+	// ignoredPhotoCount counts photos skipped for being in the ignore
+	// file. It is shared with workers.
+	ignoredPhotoCount *atomic.Int64
+	privacy           string
+	privacyTally      *privacyTally
+	safetyLevel       string
+	// safetyExcluded counts photos skipped for being above safetyLevel.
+	// It is shared with workers.
+	safetyExcluded *atomic.Int64
+	maxRetries     int
+	retryBackoff   time.Duration
+	noMetadata     bool
+	metadataSchema string
+	size           string
+	// originalFilenames names photos after their titles, which are
+	// usually the names of the uploaded files.
+	originalFilenames bool
+	overwrite         bool
+	relistAlbums      bool
+	largestAvailable  bool
+	checkSpace        bool
+	noOriginal        *noOriginalPhotos
+	maxPhotos         *photoLimit
+	// exported is nil unless pruning is enabled.
+	exported *exportedFiles
+	// verifyDimensions checks that each downloaded image has the
+	// dimensions Flickr reported.
+	verifyDimensions bool
+	// asciiFilenames and lowercaseFilenames make folder names safe for
+	// filesystems that are picky about characters or case.
+	asciiFilenames      bool
+	lowercaseFilenames  bool
+	maxFolderNameLength int
+	dateFormat          string
+	pathSeparator       string
+	replaceSpaces       string
+	albumDateSource     string
+	pathMap             map[string]string
+	fromPage            int
+	toPage              int
+	nestCollections     bool
+	progress            *progressReporter
+	tally               *photoTally
+	quiet               bool
+	// events is nil unless the JSON output format is enabled, in which
+	// case it owns stdout and human-readable messages go to logOutput, or
+	// the result is collected for --json.
+	events    *eventLog
+	logOutput io.Writer
+	since     time.Time
+	// newPhotoIDs holds the IDs of photos uploaded since the --since time,
+	// or is nil if every photo should be exported.
+	newPhotoIDs map[string]bool
+	// unorganizedDir is the folder, relative to outputDir, that photos
+	// that aren't in any album are exported to, or "" for outputDir
+	// itself.
+	unorganizedDir string
+	// skipUnorganized leaves photos that aren't in any album out of
+	// ExportAllPhotos.
+	skipUnorganized bool
+	// userID is the NSID of the user whose photos are exported, or
+	// currentUser for the authenticated user's own.
+	userID string
+	// users caches the NSIDs of users looked up by name or URL.
+	users *userCache
+	// photoWorkers are shared by forEachParallel for the whole export,
+	// while one album's photos are downloaded at a time. They're nil for
+	// workers, which process their photos one at a time.
+	photoWorkers []*FlickrExporter
+	// newExiftool, if set, starts each worker's exiftool process in place
+	// of startExiftool, so that tests can make it fail.
+	newExiftool func() (*exiftool.Exiftool, error)
+	// metadataErrors lists the photos whose metadata can't be written.
+	// It is nil when streaming, since the list and the photos wouldn't be
+	// kept.
+	metadataErrors *metadataErrors
+	// keepOnMetadataError keeps photos whose metadata can't be written,
+	// instead of removing them.
+	keepOnMetadataError bool
+	// unchangedAlbums counts albums skipped for being unchanged since
+	// they were last exported in full. It is shared with workers.
+	unchangedAlbums *atomic.Int64
+	// tarStream is nil unless the export is streamed as a tar archive, in
+	// which case outputDir only stages photos until they're written to it.
+	tarStream *tarStream
+	// listedTags takes tags from listings as Flickr normalizes them.
+	listedTags bool
+	// runLog is nil unless messages are copied to a log file.
+	runLog *runLog
+	// contentHashes is nil unless duplicates are reported.
+	contentHashes *contentHashes
+}
+
+// ExporterOptions controls where photos are written and how network
+// requests are made during an export.
+type ExporterOptions struct {
+	OutputDir string
+	Verbose   bool
+	// HTML enables writing a browsable index.html for each album and for
+	// the output directory as a whole.
+	HTML bool
+	// Catalog selects the formats of a catalog listing every exported photo,
+	// written to the output directory at the end of the export. Supported
+	// formats are "csv" and "sqlite".
+	Catalog []string
+	// Zip enables packaging each album directory as a ZIP archive next to
+	// it once the album has been exported.
+	Zip bool
+	// ZipRemove removes each album directory after it has been archived.
+	ZipRemove bool
+	// WriteUploadDate stores the date each photo was uploaded to Flickr in
+	// XMP:DateTimeDigitized.
+	WriteUploadDate bool
+	// PreferEXIFDate leaves the date taken recorded in a downloaded file's
+	// EXIF:DateTimeOriginal, if it has one, rather than writing Flickr's,
+	// and writes Flickr's date taken to EXIF:DateTimeOriginal if it
+	// doesn't.
+	PreferEXIFDate bool
+	// IncludeNotes writes each photo's Flickr notes as XMP image regions.
+	IncludeNotes bool
+	// IncludeStats writes each photo's view and favorite counts to the
+	// XMP-flickr namespace. Favorites take an extra API call per photo.
+	IncludeStats bool
+	// AlbumKeywords writes the title of every album each photo belongs to
+	// as a keyword prefixed with "album:".
+	AlbumKeywords bool
+	// TagPrefix is prepended to each of the photo's Flickr tags when they're
+	// written as keywords, e.g. "flickr:" to tell them apart from tags
+	// added elsewhere.
+	TagPrefix string
+	// Copyright is the template for the copyright notice written to each
+	// photo, in which {year} is replaced by the year it was taken and
+	// {name} by its owner's name. Empty means no notice is written.
+	Copyright string
+	// DedupHardlink downloads photos that are in several albums only once,
+	// hard linking (or, failing that, copying) the first copy into each
+	// other album's folder.
+	DedupHardlink bool
+	// Concurrency is the number of albums, or photos within an album,
+	// processed at once.
+	Concurrency int
+	// IncludeAlbums and ExcludeAlbums select which albums are exported by
+	// ExportAllPhotos. Each entry is an album ID or a case-insensitive glob
+	// matched against album titles. If IncludeAlbums is empty, all albums
+	// not matched by ExcludeAlbums are exported.
+	IncludeAlbums []string
+	ExcludeAlbums []string
+	// IgnoredAlbums and IgnoredPhotos are the albums and photos listed in
+	// the ignore file, each as an ID or a case-insensitive glob matched
+	// against titles. Ignored albums are skipped like ExcludeAlbums, and
+	// ignored photos are skipped wherever they're exported from.
+	IgnoredAlbums []string
+	IgnoredPhotos []string
+	// Privacy limits the export to photos at one privacy level: "public",
+	// "private", "friends", or "family". Empty or "any" exports everything.
+	Privacy string
+	// SafetyLevel is the most restricted Flickr safety level exported:
+	// "safe", "moderate", or "restricted". Empty or "restricted" exports
+	// everything.
+	SafetyLevel string
+	// NoMetadata skips fetching each photo's details from Flickr and
+	// writing them to the downloaded file, so exiftool isn't needed.
+	NoMetadata bool
+	// RequireMetadata makes NewFlickrExporter fail if exiftool can't be
+	// started. Otherwise, the export continues as if NoMetadata were set.
+	RequireMetadata bool
+	// MetadataSchema selects which tag families are written: "iptc",
+	// "xmp", or "both". Empty means "both".
+	MetadataSchema string
+	// Size selects the size of photo downloaded: "original", or a smaller
+	// JPEG such as "large2048", which is looked up for each photo with
+	// flickr.photos.getSizes. Empty means "original".
+	Size string
+	// OriginalFilenames names each photo after its title, which
+	// Flickr sets to the uploaded file's name unless it's changed, rather
+	// than after its download URL.
+	OriginalFilenames bool
+	// Overwrite downloads photos again even if they already exist in the
+	// output directory, replacing them.
+	Overwrite bool
+	// RelistAlbums lists the photos in every album, rather than skipping
+	// albums that haven't changed on Flickr since they were last exported
+	// in full.
+	RelistAlbums bool
+	// LargestAvailable downloads the largest available size of photos whose
+	// original can't be downloaded, instead of skipping them.
+	LargestAvailable bool
+	// CheckSpace checks that the output directory has room for the photos
+	// to be downloaded before downloading any, which takes a request per
+	// photo. Only ExportAlbum and ExportAllPhotos check.
+	CheckSpace bool
+	// MaxPhotos stops the export once this many photos have been
+	// downloaded, not counting those that already exist. Zero means no
+	// limit.
+	MaxPhotos int
+	// TrackExportedFiles records the files written by the export, so that
+	// OrphanedFiles can be called afterward.
+	TrackExportedFiles bool
+	// VerifyDimensions checks that each downloaded JPEG, PNG, or GIF has
+	// the dimensions Flickr reported, retrying the download if not.
+	VerifyDimensions bool
+	// ASCIIFilenames transliterates folder names to ASCII and makes them
+	// valid on Windows. The default only replaces path separators and
+	// other characters that are invalid on common filesystems.
+	ASCIIFilenames bool
+	// LowercaseFilenames lowercases folder names, so that names differing
+	// only in case don't collide on case-insensitive filesystems.
+	LowercaseFilenames bool
+	// MaxFolderNameLength limits the length in bytes of album folder
+	// names. Longer names are truncated and given a short hash suffix to
+	// keep them unique. Zero means no limit.
+	MaxFolderNameLength int
+	// DateFormat is the Go time layout, or the name of a preset such as
+	// "compact" or "year-month", of the creation date album folders are
+	// prefixed with. Empty means "2006-01-02".
+	DateFormat string
+	// PathSeparator goes between the date prefix of album folders and
+	// their title. Empty means a space.
+	PathSeparator string
+	// ReplaceSpaces, if set, replaces each run of spaces in folder names,
+	// and in filenames taken from titles, including a space PathSeparator.
+	ReplaceSpaces string
+	// AlbumDateSource selects the date album folders are prefixed with:
+	// "created", when the album was created on Flickr, or
+	// "earliest-taken" or "latest-taken", from the dates its photos were
+	// taken, which takes an API call per photo. Empty means "created".
+	AlbumDateSource string
+	// UnorganizedDir names the folder that photos that aren't in any album
+	// are exported to, or is empty to export them directly into OutputDir.
+	UnorganizedDir string
+	// SkipUnorganized leaves photos that aren't in any album out of
+	// ExportAllPhotos, which then only exports albums.
+	SkipUnorganized bool
+	// KeepOnMetadataError keeps downloaded photos whose metadata can't be
+	// written, instead of removing them to be downloaded again by the next
+	// export. Either way, they're listed in the metadata errors file for
+	// RetryMetadataErrors.
+	KeepOnMetadataError bool
+	// UserID is the NSID, username, or photostream URL of the user whose
+	// photos, albums, collections, and galleries are exported. Only their
+	// public photos can be exported, and only the authenticated user's
+	// photos that aren't in any album. Empty means the authenticated user.
+	UserID string
+	// FromPage and ToPage limit the photos listed from each album to the
+	// pages (of 500 photos) between them, inclusive. Zero means no limit.
+	FromPage int
+	ToPage   int
+	// NestCollections exports the albums in a collection into nested
+	// folders named after the collection and the collections within it,
+	// rather than directly into OutputDir.
+	NestCollections bool
+	// PathMap maps album IDs to the folders, relative to OutputDir, that
+	// those albums are exported to instead of the default date and title.
+	PathMap map[string]string
+	// Progress shows a live progress bar instead of logging each album and
+	// photo, if stdout is a terminal.
+	Progress bool
+	// Quiet suppresses everything but warnings and errors, which are
+	// written to stderr.
+	Quiet bool
+	// OutputFormat is "text" (the default) or "json". JSON writes
+	// newline-delimited events for each album and photo to stdout, and
+	// human-readable messages to stderr.
+	OutputFormat string
+	// CollectResult collects the outcome of each album and photo, for the
+	// result printed with --json, without writing events.
+	CollectResult bool
+	// HTTPTimeout bounds each HTTP request, including reading the body.
+	// Zero means no timeout.
+	HTTPTimeout time.Duration
+	// Proxy is the URL of an HTTP proxy to use for all requests. If empty,
+	// the HTTP_PROXY and HTTPS_PROXY environment variables are honored.
+	Proxy string
+	// HTTPClient, if set, makes every request, to both the Flickr API and
+	// its file servers, in place of a client built from HTTPTimeout and
+	// Proxy, which are then ignored. Tests use it to serve requests
+	// without network access.
+	HTTPClient *http.Client
+	// FlickrAPI, if set, makes every Flickr API call in place of Flickr
+	// itself, and the OAuth tokens aren't needed. Tests use it to serve
+	// canned responses.
+	FlickrAPI FlickrAPI
+	// MaxRetries is the number of times a rate-limited request is retried
+	// before giving up.
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry; it doubles after
+	// each subsequent attempt.
+	RetryBackoff time.Duration
+	// TarStream, if set, receives each exported photo as a tar entry named
+	// by its path relative to OutputDir, once the photo has been
+	// downloaded and had its metadata written, and the photo is removed
+	// from OutputDir. OutputDir then only stages photos, and options that
+	// need the export to stay on disk can't be used. The caller closes
+	// TarStream after the export.
+	TarStream *tar.Writer
+	// Since limits ExportAllPhotos to photos uploaded to Flickr at or after
+	// this time. Photos already in the export are still listed in galleries
+	// and catalogs. The zero time exports every photo.
+	Since time.Time
+	// ListedTags takes photos' tags from the listings of albums and photos,
+	// which give them normalized, e.g. "newyork" for "New York", rather
+	// than looking up each photo with tags for its tags as entered.
+	ListedTags bool
+	// LogFile, if set, receives a copy of every message the exporter
+	// prints, with each line timestamped, including those Quiet and
+	// Progress keep off the console.
+	LogFile io.Writer
+	// ReportDuplicates records the SHA-256 of each photo as it's
+	// downloaded, and writes a report of photos with identical content to
+	// OutputDir at the end of the export.
+	ReportDuplicates bool
+}
+
+// PartialExportError is returned when an export ran to completion, but some
+// photos or albums in it failed. Other errors mean the export couldn't be
+// carried out at all.
+type PartialExportError struct {
+	msg string
+	// Failures holds the error of each album that failed, where the
+	// export reports them separately.
+	Failures []error
+}
+
+func partialExportErrorf(format string, args ...any) error {
+	return &PartialExportError{msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *PartialExportError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns Failures, so that errors.Is and errors.As look through
+// them.
+func (e *PartialExportError) Unwrap() []error {
+	return e.Failures
 }
 
 type Photo struct {
@@ -27,9 +396,53 @@ type Photo struct {
 	Title       string
 	Description string
 	Tags        []string
+	// MachineTags holds the photo's machine tags, such as
+	// "geo:locality=paris", which aren't included in Tags.
+	MachineTags []string
 	OriginalURL string
-	Filename    string
-	DateTaken   time.Time
+	// PageURL is the photo's page on Flickr. It is only known once the
+	// photo's info has been fetched.
+	PageURL string
+	// Owner is the name of the photo's owner: their real name, or their
+	// username if they haven't given one. It is only known once the
+	// photo's info has been fetched.
+	Owner     string
+	Filename  string
+	DateTaken time.Time
+	// DateUploaded is when the photo was posted to Flickr, which can be
+	// decades after DateTaken for scanned photos.
+	DateUploaded time.Time
+	Notes        []PhotoNote
+	// Albums holds the titles of every album the photo belongs to. It is
+	// only fetched if album keywords are enabled.
+	Albums []string
+	// License is the zero value if the photo's license is unknown.
+	License    License
+	Visibility Visibility
+	// SafetyLevel is Flickr's safety_level for the photo: 0 (safe),
+	// 1 (moderate), or 2 (restricted).
+	SafetyLevel int
+	// Width and Height are the dimensions of the original as reported by
+	// Flickr, or zero if they weren't reported.
+	Width  int
+	Height int
+	// Views and Favorites are the photo's view and favorite counts. Favorites
+	// are only fetched if stats are included.
+	Views     int
+	Favorites int
+	// Position is the photo's 1-based position in the album or gallery it
+	// was listed from, counting photos skipped by --privacy. It is 0 for
+	// photos that weren't listed from an album.
+	Position int
+	// NoOriginal is set if the original can't be downloaded, so the largest
+	// available size is downloaded instead. OriginalURL is empty.
+	NoOriginal bool
+	// OwnerID is the NSID of the photo's owner, if its listing gave it.
+	OwnerID string
+	// InfoListed is set if the photo's listing gave all of its info that
+	// flickr.photos.getInfo would, other than notes and its safety level,
+	// so that it doesn't need to be fetched.
+	InfoListed bool
 }
 
 type Album struct {
@@ -37,7 +450,31 @@ type Album struct {
 	Title       string
 	Description string
 	DateCreated time.Time
-	Photos      []Photo
+	// DateUpdated is when the album was last changed on Flickr, such as by
+	// adding or removing photos, or the zero time if it isn't known.
+	DateUpdated time.Time
+	// FolderDate, if set, is used in place of DateCreated to date the
+	// album's folder.
+	FolderDate time.Time
+	Photos     []Photo
+	// PhotoCount is the number of photos and videos in the album, as
+	// reported when albums are listed, or zero if it isn't known. It's
+	// used to estimate the size of the export before the album's photos
+	// are listed.
+	PhotoCount int
+	// Folder is the directory, relative to the output directory, that the
+	// album's folder is created in. It's empty unless collections are
+	// nested on disk.
+	Folder string
+}
+
+// expectedPhotos returns the number of photos expected to be exported from
+// album: the number listed, if they have been, or else its PhotoCount.
+func (album Album) expectedPhotos() int {
+	if album.Photos != nil {
+		return len(album.Photos)
+	}
+	return album.PhotoCount
 }
 
 type CollectionSet struct {
@@ -49,9 +486,10 @@ type CollectionSet struct {
 }
 
 type CollectionNode struct {
-	ID    string          `xml:"id,attr"`
-	Title string          `xml:"title,attr"`
-	Sets  []CollectionSet `xml:"set"`
+	ID          string           `xml:"id,attr"`
+	Title       string           `xml:"title,attr"`
+	Sets        []CollectionSet  `xml:"set"`
+	Collections []CollectionNode `xml:"collection"`
 }
 
 type CollectionsResponse struct {
@@ -59,29 +497,386 @@ type CollectionsResponse struct {
 	Collections []CollectionNode `xml:"collections>collection"`
 }
 
-func NewFlickrExporter(apiKey, apiSecret, oauthToken, oauthTokenSecret, outputDir string, verbose bool) (*FlickrExporter, error) {
-	client := flickr.NewFlickrClient(apiKey, apiSecret)
+func NewFlickrExporter(apiKey, apiSecret, oauthToken, oauthTokenSecret string, opts ExporterOptions) (*FlickrExporter, error) {
+	if opts.Concurrency < 1 {
+		return nil, fmt.Errorf("concurrency must be at least 1")
+	}
 
-	// If OAuth tokens are provided, set them
-	if oauthToken != "" && oauthTokenSecret != "" {
-		client.OAuthToken = oauthToken
-		client.OAuthTokenSecret = oauthTokenSecret
-		fmt.Println("Using provided OAuth tokens for authentication")
-	} else {
-		return nil, fmt.Errorf("OAuth tokens are required. Please run 'flickr-exporter auth' first to authenticate")
+	for _, patterns := range [][]string{opts.IncludeAlbums, opts.ExcludeAlbums} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid album pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	for _, patterns := range [][]string{opts.IgnoredAlbums, opts.IgnoredPhotos} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid ignore file pattern %q: %w", pattern, err)
+			}
+		}
+	}
+
+	if opts.Privacy == "" {
+		opts.Privacy = privacyAny
+	}
+	if err := validatePrivacy(opts.Privacy); err != nil {
+		return nil, err
+	}
+
+	if opts.MetadataSchema == "" {
+		opts.MetadataSchema = metadataSchemaBoth
+	}
+	if err := validateMetadataSchema(opts.MetadataSchema); err != nil {
+		return nil, err
+	}
+
+	if opts.Size == "" {
+		opts.Size = sizeOriginal
+	}
+	if err := validateSize(opts.Size); err != nil {
+		return nil, err
+	}
+
+	if err := validateMaxFolderNameLength(opts.MaxFolderNameLength); err != nil {
+		return nil, err
+	}
+
+	dateFormat, err := dateFormatLayout(opts.DateFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.PathSeparator == "" {
+		opts.PathSeparator = " "
+	}
+	if err := validateNamePart("path separator", opts.PathSeparator); err != nil {
+		return nil, err
+	}
+	if err := validateNamePart("space replacement", opts.ReplaceSpaces); err != nil {
+		return nil, err
+	}
+
+	if opts.AlbumDateSource == "" {
+		opts.AlbumDateSource = albumDateCreated
+	}
+	if err := validateAlbumDateSource(opts.AlbumDateSource); err != nil {
+		return nil, err
+	}
+
+	if name := strings.TrimSpace(opts.UnorganizedDir); name == "." || name == ".." {
+		return nil, fmt.Errorf("invalid unorganized photos folder %q", opts.UnorganizedDir)
+	}
+
+	if err := validatePathMap(opts.PathMap); err != nil {
+		return nil, err
+	}
+
+	if opts.FromPage < 0 || opts.ToPage < 0 {
+		return nil, fmt.Errorf("page numbers must be positive")
+	}
+	if opts.ToPage > 0 && opts.ToPage < max(opts.FromPage, 1) {
+		return nil, fmt.Errorf("--to-page (%d) must not be before --from-page (%d)", opts.ToPage, opts.FromPage)
+	}
+	if (opts.FromPage > 0 || opts.ToPage > 0) && opts.ZipRemove {
+		return nil, fmt.Errorf("--from-page and --to-page can't be used with --zip-remove, since each album would be re-archived with only some of its photos")
+	}
+
+	if opts.SafetyLevel == "" {
+		opts.SafetyLevel = safetyRestricted
+	}
+	if err := validateSafetyLevel(opts.SafetyLevel); err != nil {
+		return nil, err
+	}
+
+	if opts.OutputFormat == "" {
+		opts.OutputFormat = outputFormatText
+	}
+	if err := validateOutputFormat(opts.OutputFormat); err != nil {
+		return nil, err
+	}
+	if opts.TarStream != nil {
+		if err := validateStreamOptions(opts); err != nil {
+			return nil, err
+		}
+	}
+	var logOutput io.Writer = os.Stdout
+	if opts.OutputFormat == outputFormatJSON || opts.TarStream != nil {
+		logOutput = os.Stderr
+	}
+	runLog := newRunLog(opts.LogFile)
+	if runLog != nil {
+		logOutput = io.MultiWriter(logOutput, runLog)
+	}
+
+	if !opts.Since.IsZero() && opts.ZipRemove {
+		return nil, fmt.Errorf("--since can't be used with --zip-remove, since each album would be re-archived with only its new photos")
+	}
+
+	// Photos left out of the listing would look like orphaned files.
+	if opts.TrackExportedFiles && (opts.FromPage > 0 || opts.ToPage > 0) {
+		return nil, fmt.Errorf("--prune can't be used with --from-page or --to-page, since photos on other pages would be reported as orphaned")
+	}
+	if opts.TrackExportedFiles && opts.Privacy != "" && opts.Privacy != privacyAny {
+		return nil, fmt.Errorf("--prune can't be used with --privacy, since photos at other privacy levels would be reported as orphaned")
+	}
+
+	if opts.MaxPhotos < 0 {
+		return nil, fmt.Errorf("--max-photos must not be negative")
+	}
+	if opts.MaxPhotos > 0 && opts.ZipRemove {
+		return nil, fmt.Errorf("--max-photos can't be used with --zip-remove, since albums would be archived with only some of their photos")
+	}
+	if opts.MaxPhotos > 0 && opts.TrackExportedFiles {
+		return nil, fmt.Errorf("--max-photos can't be used with --prune, since photos that weren't downloaded would be reported as orphaned")
+	}
+
+	if opts.CheckSpace && opts.Size != sizeOriginal {
+		return nil, fmt.Errorf("--check-space can only be used with --size original, since only the sizes of originals are known in advance")
+	}
+
+	if err := checkOutputDir(opts.OutputDir); err != nil {
+		return nil, err
+	}
+
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = newHTTPClient(opts.HTTPTimeout, opts.Proxy)
+	}
+	api := opts.FlickrAPI
+	if api == nil {
+		// If OAuth tokens are provided, use them
+		if oauthToken != "" && oauthTokenSecret != "" {
+			if !opts.Quiet {
+				fmt.Fprintln(logOutput, "Using provided OAuth tokens for authentication")
+			}
+		} else {
+			return nil, fmt.Errorf("OAuth tokens are required. Please run 'flickr-exporter auth' first to authenticate")
+		}
+		api = &flickrClient{
+			apiKey:           apiKey,
+			apiSecret:        apiSecret,
+			oauthToken:       oauthToken,
+			oauthTokenSecret: oauthTokenSecret,
+			httpClient:       httpClient,
+		}
+	}
+
+	cat, err := newCatalog(opts.Catalog)
+	if err != nil {
+		return nil, err
+	}
+
+	fe := &FlickrExporter{
+		api:                 api,
+		httpClient:          httpClient,
+		outputDir:           opts.OutputDir,
+		verbose:             opts.Verbose,
+		html:                opts.HTML,
+		catalog:             cat,
+		zip:                 opts.Zip,
+		zipRemove:           opts.ZipRemove,
+		writeUploadDate:     opts.WriteUploadDate,
+		preferEXIFDate:      opts.PreferEXIFDate,
+		includeNotes:        opts.IncludeNotes,
+		includeStats:        opts.IncludeStats,
+		albumKeywords:       opts.AlbumKeywords,
+		tagPrefix:           opts.TagPrefix,
+		copyright:           opts.Copyright,
+		concurrency:         opts.Concurrency,
+		includeAlbums:       opts.IncludeAlbums,
+		excludeAlbums:       opts.ExcludeAlbums,
+		ignoredAlbums:       opts.IgnoredAlbums,
+		ignoredPhotos:       opts.IgnoredPhotos,
+		ignoredPhotoCount:   &atomic.Int64{},
+		privacy:             opts.Privacy,
+		privacyTally:        &privacyTally{},
+		photoInfo:           &photoInfoCache{},
+		safetyLevel:         opts.SafetyLevel,
+		safetyExcluded:      &atomic.Int64{},
+		maxRetries:          opts.MaxRetries,
+		retryBackoff:        opts.RetryBackoff,
+		noMetadata:          opts.NoMetadata,
+		quiet:               opts.Quiet,
+		logOutput:           logOutput,
+		metadataSchema:      opts.MetadataSchema,
+		size:                opts.Size,
+		originalFilenames:   opts.OriginalFilenames,
+		overwrite:           opts.Overwrite,
+		relistAlbums:        opts.RelistAlbums,
+		unchangedAlbums:     &atomic.Int64{},
+		largestAvailable:    opts.LargestAvailable,
+		checkSpace:          opts.CheckSpace,
+		noOriginal:          &noOriginalPhotos{},
+		maxPhotos:           newPhotoLimit(opts.MaxPhotos),
+		verifyDimensions:    opts.VerifyDimensions,
+		asciiFilenames:      opts.ASCIIFilenames,
+		lowercaseFilenames:  opts.LowercaseFilenames,
+		maxFolderNameLength: opts.MaxFolderNameLength,
+		dateFormat:          dateFormat,
+		pathSeparator:       opts.PathSeparator,
+		replaceSpaces:       opts.ReplaceSpaces,
+		albumDateSource:     opts.AlbumDateSource,
+		pathMap:             opts.PathMap,
+		fromPage:            opts.FromPage,
+		toPage:              opts.ToPage,
+		nestCollections:     opts.NestCollections,
+		since:               opts.Since,
+		listedTags:          opts.ListedTags,
+		runLog:              runLog,
+		tally:               newPhotoTally(),
+	}
+
+	// Named like album folders, so the naming options must be set first.
+	fe.unorganizedDir = strings.TrimSpace(fe.folderName(opts.UnorganizedDir))
+	fe.skipUnorganized = opts.SkipUnorganized
+
+	fe.users = newUserCache()
+	fe.keepOnMetadataError = opts.KeepOnMetadataError
+	if opts.TarStream == nil {
+		fe.metadataErrors = &metadataErrors{dir: opts.OutputDir}
+	}
+	fe.userID = currentUser
+	if user := strings.TrimSpace(opts.UserID); user != "" {
+		fe.userID, err = fe.resolveUser(user)
+		if err != nil {
+			return nil, err
+		}
+		if fe.userID != user {
+			fe.logf("Exporting photos of %s (%s)\n", user, fe.userID)
+		}
+	}
+
+	if opts.DedupHardlink {
+		fe.photoCopies = &photoCopies{}
+	}
+	if opts.TrackExportedFiles {
+		fe.exported = newExportedFiles()
+	}
+	if opts.OutputFormat == outputFormatJSON {
+		fe.events = newEventLog(os.Stdout)
+	} else if opts.CollectResult {
+		fe.events = newEventLog(nil)
+	}
+	if opts.TarStream != nil {
+		fe.tarStream = &tarStream{tw: opts.TarStream, stageDir: opts.OutputDir}
+	}
+	if opts.ReportDuplicates {
+		fe.contentHashes, err = loadContentHashes(opts.OutputDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fe.et, err = fe.startExiftool()
+	if err != nil {
+		if opts.RequireMetadata {
+			return nil, err
+		}
+		fe.warnf("WARNING: %v\n", err)
+		fe.warnf("WARNING: Continuing without metadata: titles, descriptions, tags, and other details will NOT be written to downloaded photos.\n")
+		fe.warnf("WARNING: Install exiftool (macOS: brew install exiftool; Debian/Ubuntu: sudo apt-get install libimage-exiftool-perl) or use --require-metadata to make this an error.\n")
+		fe.noMetadata = true
+	}
+
+	if fe.et != nil && fe.writesXMP() {
+		if err := useFlickrXMPConfig(); err != nil {
+			fe.warnf("Warning: Machine tags won't be written to XMP-flickr:MachineTags: %v\n", err)
+		}
+	}
+
+	fe.warnIfLowOnSpace()
+
+	// The progress bar is drawn on stdout, so it can't be shown alongside
+	// JSON events.
+	if opts.Progress && !opts.Quiet && fe.events == nil {
+		fe.progress = newProgressReporter()
+	}
+
+	return fe, nil
+}
+
+// startExiftool starts an exiftool process for writing metadata, or returns
+// nil if metadata writing is disabled.
+func (fe *FlickrExporter) startExiftool() (*exiftool.Exiftool, error) {
+	if fe.noMetadata {
+		return nil, nil
+	}
+
+	// Machine tags are also written to XMP-flickr, but aren't worth
+	// failing over; NewFlickrExporter warns if they can't be.
+	if err := useFlickrXMPConfig(); err != nil && fe.includeStats {
+		return nil, err
 	}
 
 	et, err := exiftool.NewExiftool()
 	if err != nil {
-		return nil, fmt.Errorf("could not initialize exiftool: %w", err)
+		return nil, fmt.Errorf("could not start exiftool, which is required to write photo metadata (install it from https://exiftool.org, or use --no-metadata to download photos without metadata): %w", err)
 	}
 
-	return &FlickrExporter{
-		client:    client,
-		outputDir: outputDir,
-		et:        et,
-		verbose:   verbose,
-	}, nil
+	return et, nil
+}
+
+// newWorker returns a copy of fe that can be used from a separate goroutine.
+// The caller owns et.
+func (fe *FlickrExporter) newWorker(et *exiftool.Exiftool) *FlickrExporter {
+	worker := *fe
+	worker.et = et
+	// Workers already run in parallel with each other, so each processes
+	// its photos one at a time.
+	worker.concurrency = 1
+	worker.photoWorkers = nil
+	return &worker
+}
+
+// startWorkers returns up to n workers, each with its own exiftool process.
+// If only some can be started, it continues with those; it returns an error
+// only if none can be. The caller must close them with closeWorkers.
+func (fe *FlickrExporter) startWorkers(n int) ([]*FlickrExporter, error) {
+	start := fe.startExiftool
+	if fe.newExiftool != nil {
+		start = fe.newExiftool
+	}
+	var workers []*FlickrExporter
+	for len(workers) < n {
+		workerET, err := start()
+		if err != nil {
+			if len(workers) == 0 {
+				return nil, err
+			}
+			fe.warnf("Warning: Could not start worker %d, continuing with %d workers: %v\n", len(workers)+1, len(workers), err)
+			break
+		}
+		workers = append(workers, fe.newWorker(workerET))
+	}
+	return workers, nil
+}
+
+func closeWorkers(workers []*FlickrExporter) {
+	for _, worker := range workers {
+		worker.Close()
+	}
+}
+
+// startPhotoWorkers starts the workers forEachParallel spreads a single
+// album's photos across, so that their exiftool processes are started once
+// for the whole export rather than for each page of photos. It returns a
+// function that closes them. If they're already started, or can't be, it
+// does nothing, and photos are processed one at a time in the latter case.
+func (fe *FlickrExporter) startPhotoWorkers() (stop func()) {
+	if fe.concurrency <= 1 || fe.photoWorkers != nil {
+		return func() {}
+	}
+	workers, err := fe.startWorkers(fe.concurrency)
+	if err != nil {
+		fe.warnf("Warning: Could not start workers, continuing without them: %v\n", err)
+		return func() {}
+	}
+	fe.photoWorkers = workers
+	return func() {
+		closeWorkers(workers)
+		fe.photoWorkers = nil
+	}
 }
 
 func (fe *FlickrExporter) Close() {
@@ -92,22 +887,38 @@ func (fe *FlickrExporter) Close() {
 
 func (fe *FlickrExporter) ExportAlbum(albumID string) error {
 	defer fe.Close()
+	// Started here rather than by runExport, so they're also used to date
+	// the album's folder for --check-space.
+	defer fe.startPhotoWorkers()()
 
-	fmt.Printf("Exporting album %s...\n", albumID)
+	fe.logf("Exporting album %s...\n", albumID)
 
 	album, err := fe.getAlbumInfo(albumID)
 	if err != nil {
 		return fmt.Errorf("failed to get album info: %w", err)
 	}
 
-	photos, err := fe.getAlbumPhotos(albumID)
-	if err != nil {
-		return fmt.Errorf("failed to get album photos: %w", err)
-	}
+	if fe.checkSpace {
+		album.Photos, err = fe.getAlbumPhotos(albumID)
+		if err != nil {
+			return fmt.Errorf("failed to get album photos: %w", err)
+		}
 
-	album.Photos = photos
+		fe.setFolderDate(&album)
+		albumPath := filepath.Join(fe.outputDir, fe.albumDir(album))
+		err := fe.checkFreeSpace(album.Photos, func(photo Photo) bool {
+			_, err := os.Stat(filepath.Join(albumPath, photo.Filename))
+			return err == nil && !fe.overwrite
+		})
+		if err != nil {
+			return err
+		}
+	}
 
-	return fe.downloadAlbum(album)
+	if errors := fe.runExport([]Album{album}, false); len(errors) > 0 {
+		return errors[0]
+	}
+	return nil
 }
 
 func (fe *FlickrExporter) ExportCollection(collectionID string) error {
@@ -120,144 +931,341 @@ func (fe *FlickrExporter) ExportCollection(collectionID string) error {
 
 	// Log the collection name if we have it
 	if collectionName != "" {
-		fmt.Printf("Collection: %s\n", collectionName)
+		fe.logf("Collection: %s\n", collectionName)
 	}
 
-	for _, album := range albums {
-		fmt.Printf("Processing album: %s\n", album.Title)
-		photos, err := fe.getAlbumPhotos(album.ID)
+	errs := fe.runExport(albums, false)
+	if len(errs) == 0 {
+		return nil
+	}
+	// Albums that failed partway, with some of their photos exported,
+	// return a PartialExportError of their own.
+	var partial *PartialExportError
+	exported := len(albums) - len(errs)
+	for _, err := range errs {
+		fe.warnf("Warning: %v\n", err)
+		if errors.As(err, &partial) {
+			exported++
+		}
+	}
+	if exported == 0 {
+		return fmt.Errorf("failed to export any of the %d albums", len(albums))
+	}
+	return &PartialExportError{
+		msg:      fmt.Sprintf("failed to export %d of %d albums", len(errs), len(albums)),
+		Failures: errs,
+	}
+}
+
+func (fe *FlickrExporter) ExportAllPhotos() error {
+	defer fe.Close()
+
+	started := time.Now()
+
+	if !fe.since.IsZero() {
+		newPhotos, err := fe.getAllPhotos()
 		if err != nil {
-			fmt.Printf("Warning: Failed to get photos for album %s: %v\n", album.ID, err)
-			continue
+			return fmt.Errorf("failed to get photos uploaded since %s: %w", fe.since.Format(time.RFC3339), err)
 		}
-		album.Photos = photos
+		if len(newPhotos) == 0 {
+			fe.logf("No photos uploaded since %s\n", fe.since.Format(time.RFC3339))
+			fe.finishExport()
+			fe.saveLastRun(started)
+			return nil
+		}
+
+		fe.newPhotoIDs = make(map[string]bool, len(newPhotos))
+		for _, photo := range newPhotos {
+			fe.newPhotoIDs[photo.ID] = true
+		}
+		fe.logf("Found %d photos uploaded since %s\n", len(newPhotos), fe.since.Format(time.RFC3339))
+	}
 
-		if err := fe.downloadAlbum(album); err != nil {
-			fmt.Printf("Warning: Failed to download album %s: %v\n", album.ID, err)
+	if fe.checkSpace {
+		if err := fe.checkFreeSpaceForAll(); err != nil {
+			return err
 		}
 	}
 
+	// Flickr only lists the authenticated user's own photos that aren't in
+	// any album.
+	unorganized := fe.isCurrentUser() && !fe.skipUnorganized
+	if !fe.isCurrentUser() && !fe.skipUnorganized {
+		fe.logf("Skipping photos that aren't in any album, which can only be listed for your own account\n")
+	}
+
+	// Albums are exported as each page of them is listed, so that large
+	// accounts don't wait for every album to be listed before the first
+	// download.
+	var listErr error
+	var found, excluded int
+	errors := fe.exportStream(fe.concurrency, func(queue func(Album)) error {
+		fe.logf("Exporting albums as they're listed, with %d concurrent workers...\n", fe.concurrency)
+		listErr = fe.listAllAlbums(func(albums []Album) {
+			albums, excludedAlbums := fe.filterAlbums(albums)
+			found += len(albums)
+			excluded += len(excludedAlbums)
+			for _, album := range albums {
+				fe.addToTotal(album.expectedPhotos())
+			}
+			for _, album := range albums {
+				queue(album)
+			}
+		})
+		if listErr == nil {
+			fe.logf("Found %d albums\n", found)
+			if excluded > 0 {
+				fe.logf("Skipping %d albums excluded by --include-album/--exclude-album or the ignore file\n", excluded)
+			}
+		}
+		return listErr
+	}, unorganized)
+	if listErr != nil {
+		return fmt.Errorf("failed to get all albums: %w", listErr)
+	}
+	if len(errors) > 0 {
+		fe.warnf("Completed with %d errors\n", len(errors))
+		for _, err := range errors {
+			fe.warnf("  Error: %v\n", err)
+		}
+		return &PartialExportError{
+			msg:      fmt.Sprintf("export completed with %d errors", len(errors)),
+			Failures: errors,
+		}
+	}
+
+	// Photos left undownloaded by --max-photos would otherwise be skipped
+	// by the next --since last-run export.
+	if fe.maxPhotos.reached() {
+		return nil
+	}
+
+	fe.logf("All photos processed successfully!\n")
+	fe.saveLastRun(started)
 	return nil
 }
 
-func (fe *FlickrExporter) ExportAllPhotos() error {
+// ExportUnorganizedPhotos exports only the photos that aren't in any album,
+// into the unorganized photos folder.
+func (fe *FlickrExporter) ExportUnorganizedPhotos() error {
 	defer fe.Close()
 
-	albums, err := fe.getAllAlbums()
+	if !fe.isCurrentUser() {
+		return fmt.Errorf("photos that aren't in any album can only be listed for your own account, not with a user ID")
+	}
+
+	if errors := fe.runExport(nil, true); len(errors) > 0 {
+		return errors[0]
+	}
+	return nil
+}
+
+// runExport is the engine behind each export command. It exports albums,
+// listing the photos of any that haven't been listed yet, followed by the
+// photos that aren't in any album if unorganized is set, then writes the
+// reports covering the whole export. It returns an error for each album, or
+// the unorganized photos, that failed.
+//
+// Several albums are shared between workers, each downloading one photo at
+// a time; the photos of a single album are downloaded in parallel instead.
+func (fe *FlickrExporter) runExport(albums []Album, unorganized bool) []error {
+	if len(albums) <= 1 && !unorganized {
+		defer fe.finishExport()
+		defer fe.startPhotoWorkers()()
+		for _, album := range albums {
+			fe.addToTotal(album.expectedPhotos())
+		}
+		defer fe.reportProgress(progressInterval)()
+
+		for _, album := range albums {
+			if err := fe.exportAlbum(album, ""); err != nil {
+				return []error{err}
+			}
+		}
+		return nil
+	}
+
+	n := fe.concurrency
+	if !unorganized {
+		n = min(n, len(albums))
+	}
+	return fe.exportStream(n, func(queue func(Album)) error {
+		// Albums' photo counts are known before their photos are
+		// listed, so overall progress can be reported from the start.
+		for _, album := range albums {
+			fe.addToTotal(album.expectedPhotos())
+		}
+		if len(albums) > 0 {
+			fe.logf("Found %d albums, processing with %d concurrent workers...\n", len(albums), n)
+		}
+		for _, album := range albums {
+			queue(album)
+		}
+		return nil
+	}, unorganized)
+}
+
+// exportStream runs an export like runExport, sharing albums between n
+// workers as list queues them, so that albums can be exported while more
+// are still being listed. If list fails, its error is returned along with
+// those of the albums queued before it failed, and unorganized photos
+// aren't exported.
+func (fe *FlickrExporter) exportStream(n int, list func(queue func(Album)) error, unorganized bool) []error {
+	defer fe.finishExport()
+	defer fe.reportProgress(progressInterval)()
+
+	// The same workers, each with its own exiftool process, are used for
+	// both albums and unorganized photos. They're all started before any
+	// work is queued, so a worker that fails to start can't leave queued
+	// albums undrained; the workers that did start share the whole queue.
+	workers, err := fe.startWorkers(n)
 	if err != nil {
-		return fmt.Errorf("failed to get all albums: %w", err)
+		return []error{fmt.Errorf("failed to start workers: %w", err)}
 	}
+	defer closeWorkers(workers)
 
-	fmt.Printf("Found %d albums, processing with 4 concurrent workers...\n", len(albums))
+	errors, listErr := fe.exportAlbums(workers, list)
+	if listErr != nil {
+		return append(errors, listErr)
+	}
 
-	// Track downloaded filenames across all workers
-	downloadedFiles := make(map[string]bool)
-	var downloadedFilesMutex sync.Mutex
+	if unorganized {
+		// Download unorganized photos (photos not in any photoset)
+		fe.logf("\nProcessing unorganized photos...\n")
+		if err := fe.downloadUnorganizedPhotos(workers); err != nil {
+			errors = append(errors, err)
+		}
+	}
 
-	// Create a work queue for albums
-	albumChan := make(chan Album, len(albums))
-	errorChan := make(chan error, len(albums))
+	return errors
+}
 
-	// Start 4 worker goroutines, each with their own exporter instance
-	var wg sync.WaitGroup
-	const numWorkers = 4
+// exportAlbums exports the albums queued by list, sharing them between
+// workers as they're queued, and returns the errors for those that failed,
+// along with list's error.
+func (fe *FlickrExporter) exportAlbums(workers []*FlickrExporter, list func(queue func(Album)) error) ([]error, error) {
+	// Albums are queued as they're listed; a full queue holds up listing
+	// until a worker is free.
+	albumChan := make(chan Album, len(workers))
+
+	var mu sync.Mutex
+	var errors []error
 
-	for i := 0; i < numWorkers; i++ {
+	// Start worker goroutines, each with their own exporter instance
+	var wg sync.WaitGroup
+	for i, workerExporter := range workers {
 		wg.Add(1)
-		go func(workerID int) {
+		go func(workerID int, workerExporter *FlickrExporter) {
 			defer wg.Done()
-			// Create a separate exporter for this worker to avoid race conditions
-			workerET, err := exiftool.NewExiftool()
-			if err != nil {
-				errorChan <- fmt.Errorf("worker %d: could not initialize exiftool: %w", workerID, err)
-				return
-			}
-			defer workerET.Close()
-			
-			workerExporter := &FlickrExporter{
-				client:    flickr.NewFlickrClient(fe.client.ApiKey, fe.client.ApiSecret),
-				outputDir: fe.outputDir,
-				et:        workerET,
-				verbose:   fe.verbose,
+			for album := range albumChan {
+				err := workerExporter.exportAlbum(album, fmt.Sprintf("[Worker %d] ", workerID))
+				if err != nil {
+					mu.Lock()
+					errors = append(errors, fmt.Errorf("worker %d: %w", workerID, err))
+					mu.Unlock()
+				}
 			}
-			workerExporter.client.OAuthToken = fe.client.OAuthToken
-			workerExporter.client.OAuthTokenSecret = fe.client.OAuthTokenSecret
-
-			fe.albumWorkerWithTracking(workerID, workerExporter, albumChan, errorChan, downloadedFiles, &downloadedFilesMutex)
-		}(i)
+		}(i, workerExporter)
 	}
 
 	// Send albums to workers
-	for _, album := range albums {
+	listErr := list(func(album Album) {
 		albumChan <- album
-	}
+	})
 	close(albumChan)
 
 	// Wait for all workers to complete
 	wg.Wait()
-	close(errorChan)
+	return errors, listErr
+}
 
-	// Collect and report errors
-	var errors []error
-	for err := range errorChan {
-		if err != nil {
-			errors = append(errors, err)
-		}
-	}
+// exportAlbum lists album's photos, unless they've been listed already, and
+// downloads them. Log messages are prefixed with logPrefix.
+func (fe *FlickrExporter) exportAlbum(album Album, logPrefix string) error {
+	// The album's expected photos were counted by runExport, and are
+	// replaced by those actually downloaded, if any, by downloadAlbum.
+	fe.addToTotal(-album.expectedPhotos())
 
-	// Download unorganized photos (photos not in any photoset)
-	fmt.Println("\nProcessing unorganized photos...")
-	unorganizedErr := fe.downloadUnorganizedPhotos(downloadedFiles)
-	if unorganizedErr != nil {
-		errors = append(errors, unorganizedErr)
+	if fe.maxPhotos.reached() {
+		return nil
 	}
 
-	if len(errors) > 0 {
-		fmt.Printf("Completed with %d errors\n", len(errors))
-		for _, err := range errors {
-			fmt.Printf("  Error: %v\n", err)
+	if album.Photos == nil && fe.albumComplete(album) {
+		fe.unchangedAlbums.Add(1)
+		if fe.verbose {
+			fe.logf("%sSkipping album (unchanged since it was exported): %s\n", logPrefix, album.Title)
 		}
-		return fmt.Errorf("export completed with %d errors", len(errors))
-	} else {
-		fmt.Println("All photos processed successfully!")
+		return nil
 	}
 
-	return nil
-}
+	fe.logf("%sProcessing album: %s\n", logPrefix, album.Title)
 
-func (fe *FlickrExporter) albumWorkerWithTracking(workerID int, workerExporter *FlickrExporter, albumChan <-chan Album, errorChan chan<- error, downloadedFiles map[string]bool, mutex *sync.Mutex) {
-	for album := range albumChan {
-		fmt.Printf("[Worker %d] Processing album: %s\n", workerID, album.Title)
+	if album.Photos == nil && fe.streamsAlbumPhotos() {
+		count, err := fe.streamAlbum(album)
+		if err != nil {
+			return fmt.Errorf("failed to download album %s: %w", album.Title, err)
+		}
+		fe.logf("%sCompleted album: %s (%d photos)\n", logPrefix, album.Title, count)
+		return nil
+	}
 
-		// Get photos for this album using the worker's exporter
-		photos, err := workerExporter.getAlbumPhotos(album.ID)
+	if album.Photos == nil {
+		photos, err := fe.getAlbumPhotos(album.ID)
 		if err != nil {
-			errorChan <- fmt.Errorf("worker %d: failed to get photos for album %s: %w", workerID, album.Title, err)
-			continue
+			return fmt.Errorf("failed to get photos for album %s: %w", album.Title, err)
 		}
 		album.Photos = photos
+	}
 
-		// Track filenames before downloading
-		mutex.Lock()
-		for _, photo := range photos {
-			downloadedFiles[photo.Filename] = true
+	if !fe.hasNewPhotos(album.Photos) {
+		if fe.verbose {
+			fe.logf("%sSkipping album (no new photos): %s\n", logPrefix, album.Title)
 		}
-		mutex.Unlock()
+		return nil
+	}
 
-		// Download the album using the worker's exporter
-		err = workerExporter.downloadAlbum(album)
-		if err != nil {
-			errorChan <- fmt.Errorf("worker %d: failed to download album %s: %w", workerID, album.Title, err)
-			continue
+	if err := fe.downloadAlbum(album); err != nil {
+		return fmt.Errorf("failed to download album %s: %w", album.Title, err)
+	}
+
+	fe.logf("%sCompleted album: %s (%d photos)\n", logPrefix, album.Title, len(album.Photos))
+	return nil
+}
+
+// filterAlbums splits albums into those selected by the include and exclude
+// album filters and the ignore file and those that are not.
+func (fe *FlickrExporter) filterAlbums(albums []Album) (included, excluded []Album) {
+	for _, album := range albums {
+		if len(fe.includeAlbums) > 0 && !albumMatches(album, fe.includeAlbums) || albumMatches(album, fe.excludeAlbums) || albumMatches(album, fe.ignoredAlbums) {
+			excluded = append(excluded, album)
+		} else {
+			included = append(included, album)
 		}
+	}
+	return included, excluded
+}
 
-		fmt.Printf("[Worker %d] Completed album: %s (%d photos)\n", workerID, album.Title, len(photos))
-		errorChan <- nil // Signal successful completion
+// albumMatches reports whether any pattern is equal to the album's ID or is
+// a glob matching its title, ignoring case.
+func albumMatches(album Album, patterns []string) bool {
+	title := strings.ToLower(album.Title)
+	for _, pattern := range patterns {
+		if pattern == album.ID {
+			return true
+		}
+		if matched, _ := path.Match(strings.ToLower(pattern), title); matched {
+			return true
+		}
 	}
+	return false
 }
 
 func (fe *FlickrExporter) getAlbumInfo(albumID string) (Album, error) {
-	response, err := photosets.GetInfo(fe.client, false, albumID, "")
+	response := &photosets.PhotosetResponse{}
+	err := fe.withRetry("getting album info for "+albumID, func() error {
+		response = &photosets.PhotosetResponse{}
+		return fe.api.Get("flickr.photosets.getInfo", url.Values{"photoset_id": {albumID}}, false, response)
+	})
 	if err != nil {
 		return Album{}, err
 	}
@@ -281,76 +1289,112 @@ func (fe *FlickrExporter) getAlbumInfo(albumID string) (Album, error) {
 		Title:       title,
 		Description: description,
 		DateCreated: dateCreated,
+		DateUpdated: albumDateUpdated(response.Set.DateUpdate),
+		PhotoCount:  response.Set.Photos + response.Set.Videos,
 	}, nil
 }
 
+// albumPhotoExtras are the extra fields requested for each photo listed from
+// an album, including the URLs of its sizes.
+const albumPhotoExtras = "original_format,url_c,url_m,url_n,url_o,url_q,url_s,url_sq,url_t"
+
+// getAlbumPhotos lists the photos in an album, limited to the pages between
+// fe.fromPage and fe.toPage if they're set.
 func (fe *FlickrExporter) getAlbumPhotos(albumID string) ([]Photo, error) {
 	var photos []Photo
-	page := 1
-	
+	err := fe.listAlbumPhotos(albumID, func(page []Photo) {
+		photos = append(photos, page...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return photos, nil
+}
+
+// listAlbumPhotos lists the photos in an album like getAlbumPhotos, calling
+// onPage with the photos to export from each page as soon as it's listed.
+func (fe *FlickrExporter) listAlbumPhotos(albumID string, onPage func(photos []Photo)) error {
+	page := max(fe.fromPage, 1)
+
 	for {
 		// Get photos in the album with original URLs
-		response, err := photosets.GetPhotos(fe.client, false, albumID, "", page)
+		response := &AlbumPhotosResponse{}
+		err := fe.withRetry(fmt.Sprintf("getting photos page %d of album %s", page, albumID), func() error {
+			args := url.Values{}
+			args.Set("photoset_id", albumID)
+			args.Set("extras", fe.listingExtras(albumPhotoExtras))
+			args.Set("page", strconv.Itoa(page))
+
+			response = &AlbumPhotosResponse{}
+			return fe.api.Get("flickr.photosets.getPhotos", args, false, response)
+		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to get photos page %d: %w", page, err)
+			return fmt.Errorf("failed to get photos page %d: %w", page, err)
+		}
+
+		if page > 1 && page > response.Photoset.Pages {
+			fe.warnf("Warning: Album %s only has %d pages of photos; nothing to export from page %d\n", albumID, response.Photoset.Pages, page)
+			break
 		}
 
 		// Parse the response using the typed structure
-		for _, photoData := range response.Photoset.Photos {
-			photo, err := fe.parsePhotoFromStruct(photoData)
+		var photos []Photo
+		for i, photoData := range response.Photoset.Photos {
+			photo, err := fe.parsePhotoFromStruct(photoData.Photo)
+			photo.Position = (page-1)*response.Photoset.Perpage + i + 1
 			if err != nil {
-				fmt.Printf("Warning: Failed to get metadata for photo %s: %v\n", photoData.Id, err)
+				fe.warnf("Warning: Failed to get metadata for photo %s: %v\n", photoData.Id, err)
 				continue // Skip this photo but continue with others
 			}
-			if photo.OriginalURL != "" {
+			fe.setListedInfo(&photo, photoData.listedInfo, response.Photoset.Owner)
+			if matchesPrivacy(photo.Visibility, fe.privacy) && fe.isDownloadable(&photo) {
 				photos = append(photos, photo)
 			}
 		}
+		onPage(photos)
 
 		// Check if we've got all pages
-		if page >= response.Photoset.Pages {
+		if page >= response.Photoset.Pages || fe.toPage > 0 && page >= fe.toPage {
 			break
 		}
 		page++
-		
+
 		// Rate limiting between API calls
 		time.Sleep(100 * time.Millisecond)
 	}
 
-	return photos, nil
+	return nil
 }
 
 func (fe *FlickrExporter) getCollectionAlbums(collectionID string) ([]Album, string, error) {
 	// Use the collections.getTree API to get albums in a collection
-	fe.client.Init()
-	fe.client.Args.Set("method", "flickr.collections.getTree")
-	fe.client.Args.Set("collection_id", collectionID)
-
-	// Sign the request (collections might need OAuth)
-	fe.client.OAuthSign()
-
 	response := &CollectionsResponse{}
-	err := flickr.DoGet(fe.client, response)
+	err := fe.withRetry("getting collection "+collectionID, func() error {
+		args := url.Values{}
+		args.Set("collection_id", collectionID)
+		if !fe.isCurrentUser() {
+			args.Set("user_id", fe.userID)
+		}
+
+		// Sign the request (collections might need OAuth)
+		response = &CollectionsResponse{}
+		return fe.api.Get("flickr.collections.getTree", args, true, response)
+	})
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to get collection tree: %w", err)
 	}
 
-	if response.HasErrors() {
-		return nil, "", fmt.Errorf("flickr API error: %s", response.ErrorMsg())
-	}
-
 	var albums []Album
 	var collectionName string
+	seen := make(map[string]bool)
 
-	// Parse the response - collections can contain sets
+	// Parse the response - collections can contain sets and other
+	// collections
 	for _, collection := range response.Collections {
 		if collectionName == "" {
 			collectionName = collection.Title
 		}
-		for _, set := range collection.Sets {
-			album := fe.parseAlbumFromCollectionSet(set)
-			albums = append(albums, album)
-		}
+		albums = append(albums, fe.collectionTreeAlbums(collection, "", seen)...)
 	}
 
 	if len(albums) == 0 {
@@ -360,33 +1404,47 @@ func (fe *FlickrExporter) getCollectionAlbums(collectionID string) ([]Album, str
 	return albums, collectionName, nil
 }
 
-func (fe *FlickrExporter) getAllAlbums() ([]Album, error) {
-	var albums []Album
+// listAllAlbums lists the user's albums, calling onPage with each page of
+// them as soon as it's listed.
+func (fe *FlickrExporter) listAllAlbums(onPage func(albums []Album)) error {
 	page := 1
-	
+
 	for {
-		response, err := photosets.GetList(fe.client, true, "", page)
+		response := &photosets.PhotosetsListResponse{}
+		err := fe.withRetry(fmt.Sprintf("getting albums page %d", page), func() error {
+			args := url.Values{}
+			// The authenticated user's by default
+			if !fe.isCurrentUser() {
+				args.Set("user_id", fe.userID)
+			}
+			args.Set("page", strconv.Itoa(page))
+
+			response = &photosets.PhotosetsListResponse{}
+			return fe.api.Get("flickr.photosets.getList", args, true, response)
+		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to get photosets page %d: %w", page, err)
+			return fmt.Errorf("failed to get photosets page %d: %w", page, err)
 		}
 
 		// Parse the response using the typed structure
+		var albums []Album
 		for _, photosetData := range response.Photosets.Items {
 			album := fe.parseAlbumFromStruct(photosetData)
 			albums = append(albums, album)
 		}
+		onPage(albums)
 
 		// Check if we've got all pages
 		if page >= response.Photosets.Pages {
 			break
 		}
 		page++
-		
+
 		// Rate limiting between API calls
 		time.Sleep(100 * time.Millisecond)
 	}
 
-	return albums, nil
+	return nil
 }
 
 func (fe *FlickrExporter) parsePhotoFromStruct(photoData photosets.Photo) (Photo, error) {
@@ -394,14 +1452,29 @@ func (fe *FlickrExporter) parsePhotoFromStruct(photoData photosets.Photo) (Photo
 		ID:          photoData.Id,
 		Title:       photoData.Title,
 		OriginalURL: photoData.URLO,
+		Visibility: Visibility{
+			IsPublic: photoData.IsPublic == "1",
+			IsFriend: photoData.IsFriend == "1",
+			IsFamily: photoData.IsFamily == "1",
+		},
+	}
+
+	photo.Width, _ = strconv.Atoi(photoData.WidthO)
+	photo.Height, _ = strconv.Atoi(photoData.HeightO)
+	// Listings sometimes leave out the URL of an original that can be
+	// downloaded, but give what's needed to build it.
+	if photo.OriginalURL == "" {
+		photo.OriginalURL = originalPhotoURL(strconv.Itoa(photoData.Server), photo.ID, photoData.OriginalSecret, photoData.OriginalFormat)
 	}
 
 	// Extract filename from URL
 	if photo.OriginalURL != "" {
 		parts := strings.Split(photo.OriginalURL, "/")
 		if len(parts) > 0 {
-			photo.Filename = parts[len(parts)-1]
+			photo.Filename = fe.photoFilename(parts[len(parts)-1], photo.Title)
 		}
+	} else {
+		fe.noOriginalFilename(&photo, photoData.URLC)
 	}
 
 	// Don't fetch metadata here - we'll do it later only if needed
@@ -413,6 +1486,8 @@ func (fe *FlickrExporter) parseAlbumFromStruct(photosetData photosets.Photoset)
 		ID:          photosetData.Id,
 		Title:       photosetData.Title,
 		Description: photosetData.Description,
+		PhotoCount:  photosetData.Photos + photosetData.Videos,
+		DateUpdated: albumDateUpdated(photosetData.DateUpdate),
 	}
 
 	// Parse date created from timestamp (it's an int in the struct)
@@ -428,119 +1503,368 @@ func (fe *FlickrExporter) parseAlbumFromStruct(photosetData photosets.Photoset)
 	return album
 }
 
+// collectionTreeAlbums returns the albums in collection and, recursively, in
+// the collections within it. If collections are nested on disk, each album's
+// Folder is set to the path of collection folders leading to it, starting
+// from parent. An album can be in several collections; albums whose IDs are
+// in seen are skipped, and the others are added to it, so each is only
+// exported once, under the first collection it's found in.
+func (fe *FlickrExporter) collectionTreeAlbums(collection CollectionNode, parent string, seen map[string]bool) []Album {
+	var folder string
+	if fe.nestCollections {
+		folder = filepath.Join(parent, truncateName(fe.folderName(collection.Title), fe.maxFolderNameLength))
+	}
+
+	var albums []Album
+	for _, set := range collection.Sets {
+		if seen[set.ID] {
+			continue
+		}
+		seen[set.ID] = true
+		album := fe.parseAlbumFromCollectionSet(set)
+		album.Folder = folder
+		albums = append(albums, album)
+	}
+	for _, child := range collection.Collections {
+		albums = append(albums, fe.collectionTreeAlbums(child, folder, seen)...)
+	}
+	return albums
+}
+
 func (fe *FlickrExporter) parseAlbumFromCollectionSet(set CollectionSet) Album {
 	// Collections API doesn't include full album metadata, so fetch it separately
 	albumInfo, err := fe.getAlbumInfo(set.ID)
 	if err != nil {
-		fmt.Printf("Warning: Failed to get full album info for %s: %v\n", set.Title, err)
-		// Fallback to basic info from collection
-		return Album{
+		// Fall back to the basic info from the collection, which has
+		// the album's dates, but not its photo count.
+		album := Album{
 			ID:          set.ID,
 			Title:       set.Title,
 			Description: set.Description,
-			DateCreated: time.Unix(0, 0), // Use epoch as fallback
+			DateCreated: time.Unix(int64(set.DateCreate), 0),
+			DateUpdated: albumDateUpdated(set.DateUpdate),
+		}
+		fe.warnf("Warning: Failed to get full album info for %s (%s), using the collection's info instead; its folder is dated %s: %v\n",
+			set.Title, set.ID, album.DateCreated.Format(fe.dateFormat), err)
+		return album
+	}
+
+	// Use the full album info which has the correct creation date
+	return albumInfo
+}
+
+func (fe *FlickrExporter) downloadAlbum(album Album) error {
+	if fe.maxPhotos.reached() {
+		return nil
+	}
+
+	fe.setFolderDate(&album)
+	if fe.originalFilenames {
+		uniqueFilenames(album.Photos)
+	}
+
+	fe.logf("Downloading %d photos to %s\n", len(album.Photos), filepath.Join(fe.outputDir, fe.albumDir(album)))
+
+	pages := make(chan photoPage, 1)
+	pages <- photoPage{photos: album.Photos}
+	close(pages)
+	album.Photos = nil
+	_, err := fe.downloadAlbumPages(album, pages)
+	return err
+}
+
+// downloadAlbumPages downloads the photos of album received from pages,
+// starting on each page as soon as it's received, and appends them to
+// album.Photos, returning how many there were. It stops at the first page
+// with an error, which it returns, leaving the album incomplete. pages is
+// drained even if the album can't be downloaded.
+func (fe *FlickrExporter) downloadAlbumPages(album Album, pages <-chan photoPage) (int, error) {
+	defer func() {
+		for range pages {
+		}
+	}()
+
+	albumPath := filepath.Join(fe.outputDir, fe.albumDir(album))
+	fe.restoreArchivedAlbum(albumPath)
+	if err := os.MkdirAll(albumPath, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create album directory: %w", err)
+	}
+	fe.exported.addDir(albumPath)
+
+	var failedDownloads []string
+	var failedDownloadsMutex sync.Mutex
+
+	fe.progress.setAlbum(album.Title)
+	fe.events.albumStarted(album, albumPath)
+
+	var listErr error
+	for page := range pages {
+		if page.err != nil {
+			listErr = page.err
+			break
+		}
+		// Each page is downloaded before the next is appended, so the
+		// photos being downloaded are never moved.
+		start := len(album.Photos)
+		album.Photos = append(album.Photos, page.photos...)
+		fe.addToTotal(len(page.photos))
+		fe.forEachParallel(len(page.photos), func(worker *FlickrExporter, j int) {
+			i := start + j
+			if err := worker.downloadAlbumPhoto(album, i, albumPath); err != nil {
+				failedDownloadsMutex.Lock()
+				failedDownloads = append(failedDownloads, album.Photos[i].Filename)
+				failedDownloadsMutex.Unlock()
+				fe.events.photoFailed(album, album.Photos[i], filepath.Join(albumPath, album.Photos[i].Filename), err)
+			}
+			fe.photoDone()
+		})
+	}
+	fe.events.albumFinished(album, albumPath)
+
+	if listErr != nil {
+		return len(album.Photos), fmt.Errorf("failed to get photos: %w", listErr)
+	}
+
+	if fe.html {
+		if err := writeAlbumGallery(fe.outputDir, albumPath, album); err != nil {
+			fe.warnf("  Warning: Failed to write gallery for %s: %v\n", album.Title, err)
 		}
 	}
 
-	// Use the full album info which has the correct creation date
-	return albumInfo
-}
-
-func (fe *FlickrExporter) downloadAlbum(album Album) error {
-	// Create album directory with date prefix
-	datePrefix := album.DateCreated.Format("2006-01-02")
-	albumDir := fmt.Sprintf("%s %s", datePrefix, sanitizeFilename(album.Title))
-	albumPath := filepath.Join(fe.outputDir, albumDir)
+	// Recorded before archiving, so that the archive isn't older than the
+	// folder it was made from.
+	if len(failedDownloads) == 0 {
+		fe.markAlbumComplete(album, albumPath)
+	}
+
+	fe.archiveAlbum(albumPath, len(failedDownloads) == 0)
+
+	if len(failedDownloads) > 0 {
+		return len(album.Photos), partialExportErrorf("failed to download %d photos: %v", len(failedDownloads), failedDownloads)
+	}
+
+	return len(album.Photos), nil
+}
+
+// downloadAlbumPhoto downloads the i'th photo in album to albumPath and writes
+// its metadata. On success, album.Photos[i] is updated with the photo's full
+// metadata. Failures are logged as they happen, and the returned error only
+// signals that the photo was not exported.
+func (fe *FlickrExporter) downloadAlbumPhoto(album Album, i int, albumPath string) error {
+	photo := album.Photos[i]
+	if fe.verbose {
+		fe.logf("Downloading photo %d/%d: %s\n", i+1, len(album.Photos), photo.Title)
+	}
+
+	photoPath := filepath.Join(albumPath, photo.Filename)
+
+	if fe.ignoresPhoto(photo) {
+		// It's still on Flickr, so a copy from an earlier export isn't
+		// pruned.
+		fe.exported.addFile(photoPath)
+		fe.events.photoSkipped(album, photo, photoPath, skipIgnored)
+		return nil
+	}
+
+	// Check if photo already exists to avoid redownloading
+	if _, err := os.Stat(photoPath); err == nil && !fe.overwrite {
+		if fe.verbose {
+			fe.logf("  Skipping (already exists): %s\n", photo.Filename)
+		}
+		fe.recordPhoto(album, photo, photoPath, false)
+		fe.events.photoSkipped(album, photo, photoPath, skipExists)
+		return nil
+	}
+
+	if !fe.isNewPhoto(photo) {
+		fe.events.photoSkipped(album, photo, photoPath, skipNotNew)
+		return nil
+	}
+
+	if fe.linkDuplicate(photo, photoPath) {
+		fe.recordPhoto(album, photo, photoPath, false)
+		fe.events.photoSkipped(album, photo, photoPath, skipDuplicate)
+		return nil
+	}
 
-	if err := os.MkdirAll(albumPath, 0755); err != nil {
-		return fmt.Errorf("failed to create album directory: %w", err)
+	if !fe.maxPhotos.take() {
+		return nil
 	}
+	downloaded := false
+	defer func() { fe.maxPhotos.finish(downloaded) }()
 
-	fmt.Printf("Downloading %d photos to %s\n", len(album.Photos), albumPath)
+	// Fetch metadata only when we need to download. The safety level is
+	// only known from the photo's metadata, so fetch it to filter on that
+	// even if it won't be written.
+	if !fe.noMetadata || fe.filtersSafety() {
+		if err := fe.fetchPhotoMetadata(&photo); err != nil {
+			fe.warnf("  Warning: Failed to get metadata for %s: %v\n", photo.Filename, err)
+			return err
+		}
+		album.Photos[i] = photo
+		if !fe.allowsSafety(photo) {
+			fe.events.photoSkipped(album, photo, photoPath, skipSafety)
+			return nil
+		}
+	}
 
-	var failedDownloads []string
+	if err := fe.downloadPhoto(photo, photoPath); err != nil {
+		fe.warnf("  Warning: Failed to download %s: %v\n", photo.Filename, err)
+		return err
+	}
 
-	for i, photo := range album.Photos {
-		if fe.verbose {
-			fmt.Printf("Downloading photo %d/%d: %s\n", i+1, len(album.Photos), photo.Title)
+	if err := fe.writeMetadata(photoPath, photo); err != nil {
+		fe.warnf("  Error: Failed to write metadata for %s: %v\n", photo.Filename, err)
+		if err := fe.keepWithoutMetadata(photo, photoPath, err); err != nil {
+			return err
 		}
+	}
 
-		photoPath := filepath.Join(albumPath, photo.Filename)
+	if err := fe.tarStream.add(photoPath); err != nil {
+		fe.warnf("  Error: Failed to stream %s: %v\n", photo.Filename, err)
+		return err
+	}
 
-		// Check if photo already exists to avoid redownloading
-		if _, err := os.Stat(photoPath); err == nil {
-			if fe.verbose {
-				fmt.Printf("  Skipping (already exists): %s\n", photo.Filename)
-			}
-			continue
-		}
+	downloaded = true
+	fe.recordPhoto(album, photo, photoPath, true)
+	fe.events.photoDownloaded(album, photo, photoPath)
 
-		// Fetch metadata only when we need to download
-		if err := fe.fetchPhotoMetadata(&photo); err != nil {
-			fmt.Printf("  Warning: Failed to get metadata for %s: %v\n", photo.Filename, err)
-			failedDownloads = append(failedDownloads, photo.Filename)
-			continue
-		}
+	// Rate limiting: sleep 100ms between downloads
+	time.Sleep(100 * time.Millisecond)
 
-		if err := fe.downloadPhoto(photo, photoPath); err != nil {
-			fmt.Printf("  Warning: Failed to download %s: %v\n", photo.Filename, err)
-			failedDownloads = append(failedDownloads, photo.Filename)
-			continue
+	return nil
+}
+
+// forEachParallel calls fn once for each index in [0, n), spread across the
+// workers started by startPhotoWorkers. Each worker is passed an exporter
+// with its own exiftool instance and Flickr client. Without workers, fn is
+// called with fe, one index at a time.
+func (fe *FlickrExporter) forEachParallel(n int, fn func(worker *FlickrExporter, i int)) {
+	if len(fe.photoWorkers) == 0 || n <= 1 {
+		for i := 0; i < n; i++ {
+			fn(fe, i)
 		}
+		return
+	}
+	workers := fe.photoWorkers[:min(len(fe.photoWorkers), n)]
+
+	indexes := make(chan int, n)
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
 
-		// Write metadata - this is critical, remove photo if it fails
-		if err := fe.writeMetadata(photoPath, photo); err != nil {
-			fmt.Printf("  Error: Failed to write metadata for %s: %v\n", photo.Filename, err)
-			// Remove the downloaded photo since we can't write metadata
-			if removeErr := os.Remove(photoPath); removeErr != nil {
-				fmt.Printf("  Error: Also failed to remove incomplete photo %s: %v\n", photo.Filename, removeErr)
+	var wg sync.WaitGroup
+	for _, worker := range workers {
+		wg.Add(1)
+		go func(worker *FlickrExporter) {
+			defer wg.Done()
+			for i := range indexes {
+				fn(worker, i)
 			}
-			failedDownloads = append(failedDownloads, photo.Filename)
-			continue
-		}
+		}(worker)
+	}
+	wg.Wait()
+}
 
-		// Rate limiting: sleep 100ms between downloads
-		if i < len(album.Photos)-1 { // Don't sleep after the last photo
-			time.Sleep(100 * time.Millisecond)
+// finishExport writes the reports that cover the export as a whole.
+func (fe *FlickrExporter) finishExport() {
+	fe.progress.finish()
+	fe.writeGallery()
+	fe.writeCatalog()
+	fe.reportDuplicates()
+	fe.events.summary()
+
+	// Skipped photos are reported even with --quiet, since they're missing
+	// from the export.
+	if kept, removed := fe.metadataErrors.counts(); kept+removed > 0 {
+		listed := filepath.Join(fe.outputDir, metadataErrorsFilename)
+		if kept > 0 {
+			fe.warnf("Kept %d photos whose metadata couldn't be written; they're listed in %s\n", kept, listed)
+		}
+		if removed > 0 {
+			fe.warnf("Removed %d photos whose metadata couldn't be written; they're listed in %s\n", removed, listed)
 		}
+		fe.warnf("Run 'flickr-exporter retry' to try writing their metadata again\n")
+	}
+	if ids := fe.noOriginal.ids(false); len(ids) > 0 {
+		fe.warnf("Skipped %d photos whose original isn't available for download (use --largest-available to download them at a smaller size): %s\n", len(ids), strings.Join(ids, ", "))
 	}
 
-	if len(failedDownloads) > 0 {
-		return fmt.Errorf("failed to download %d photos: %v", len(failedDownloads), failedDownloads)
+	if fe.quiet {
+		return
+	}
+	if fe.maxPhotos.reached() {
+		fmt.Fprintf(fe.logOutput, "Reached --max-photos limit (%d)\n", fe.maxPhotos.max)
+	}
+	if summary := fe.privacyTally.String(); summary != "" {
+		fmt.Fprintf(fe.logOutput, "Photos by privacy level: %s\n", summary)
 	}
+	if unchanged := fe.unchangedAlbums.Load(); unchanged > 0 {
+		fmt.Fprintf(fe.logOutput, "Skipped %d albums unchanged on Flickr since they were last exported (use --relist to list them anyway)\n", unchanged)
+	}
+	if ignored := fe.ignoredPhotoCount.Load(); ignored > 0 {
+		fmt.Fprintf(fe.logOutput, "Skipped %d photos listed in the ignore file\n", ignored)
+	}
+	if excluded := fe.safetyExcluded.Load(); excluded > 0 {
+		fmt.Fprintf(fe.logOutput, "Excluded %d photos above safety level %q\n", excluded, fe.safetyLevel)
+	}
+	if ids := fe.noOriginal.ids(true); len(ids) > 0 {
+		fmt.Fprintf(fe.logOutput, "Used the largest available size for %d photos whose original isn't available: %s\n", len(ids), strings.Join(ids, ", "))
+	}
+}
 
-	return nil
+// writeGallery regenerates the top-level gallery index if HTML output is
+// enabled.
+func (fe *FlickrExporter) writeGallery() {
+	if !fe.html {
+		return
+	}
+	if err := writeGalleryIndex(fe.outputDir); err != nil {
+		fe.warnf("Warning: Failed to write gallery index: %v\n", err)
+	}
 }
 
 func (fe *FlickrExporter) downloadPhoto(photo Photo, outputPath string) error {
-	// First attempt
-	err := fe.downloadPhotoAttempt(photo.OriginalURL, outputPath)
-	if err == nil {
-		return nil
+	size, err := fe.sizedPhoto(photo)
+	if err != nil {
+		return err
 	}
-
-	// Check if it's a 429 (Too Many Requests) error
-	if strings.Contains(err.Error(), "HTTP 429") {
-		if fe.verbose {
-			fmt.Printf("  Rate limited, waiting 5 seconds before retry...\n")
+	// The content is hashed as it's downloaded, before metadata is
+	// written, so that copies of a photo uploaded more than once match.
+	var sum hash.Hash
+	if fe.contentHashes != nil {
+		sum = sha256.New()
+	}
+	err = fe.withRetry("downloading "+photo.Filename, func() error {
+		if sum != nil {
+			sum.Reset()
 		}
-		time.Sleep(5 * time.Second)
-
-		// Retry once
-		retryErr := fe.downloadPhotoAttempt(photo.OriginalURL, outputPath)
-		if retryErr == nil {
-			return nil
+		if err := fe.downloadPhotoAttempt(size.Source, outputPath, sum); err != nil {
+			return err
 		}
-		// Return the retry error if both attempts failed
-		return fmt.Errorf("failed after retry: %w", retryErr)
+		if fe.verifyDimensions {
+			return fe.checkDimensions(outputPath, photo.Filename, size.Width, size.Height)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-
-	// Return original error if it wasn't a 429
-	return err
+	if sum != nil {
+		relPath := outputPath
+		if rel, err := filepath.Rel(fe.outputDir, outputPath); err == nil {
+			relPath = rel
+		}
+		fe.contentHashes.add(photo.ID, hex.EncodeToString(sum.Sum(nil)), relPath)
+	}
+	return nil
 }
 
-func (fe *FlickrExporter) downloadPhotoAttempt(url, outputPath string) error {
-	resp, err := http.Get(url)
+// downloadPhotoAttempt downloads url to outputPath, also writing it to sum if
+// it isn't nil.
+func (fe *FlickrExporter) downloadPhotoAttempt(url, outputPath string, sum hash.Hash) error {
+	resp, err := fe.httpClient.Get(url)
 	if err != nil {
 		return err
 	}
@@ -556,10 +1880,79 @@ func (fe *FlickrExporter) downloadPhotoAttempt(url, outputPath string) error {
 	}
 	defer file.Close()
 
-	_, err = io.Copy(file, resp.Body)
+	var w io.Writer = file
+	if sum != nil {
+		w = io.MultiWriter(file, sum)
+	}
+	n, err := io.Copy(w, resp.Body)
+	fe.progress.addBytes(n)
+	fe.events.addBytes(n)
+	if err != nil {
+		// A partial file would be taken for the photo on the next run.
+		file.Close()
+		os.Remove(outputPath)
+	}
+	return err
+}
+
+// newHTTPClient returns an HTTP client that sends requests through proxyURL,
+// or through the proxy named by HTTP_PROXY/HTTPS_PROXY if proxyURL is empty.
+// Hosts listed in NO_PROXY bypass the proxy either way.
+func newHTTPClient(timeout time.Duration, proxyURL string) *http.Client {
+	proxyConfig := httpproxy.FromEnvironment()
+	if proxyURL != "" {
+		proxyConfig.HTTPProxy = proxyURL
+		proxyConfig.HTTPSProxy = proxyURL
+	}
+	proxyFunc := proxyConfig.ProxyFunc()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+}
+
+// withRetry calls fn, an API call or download, until it succeeds or fails
+// with an error that isn't caused by rate limiting or Flickr being
+// unavailable, retrying up to fe.maxRetries times with exponential backoff
+// and jitter.
+func (fe *FlickrExporter) withRetry(desc string, fn func() error) error {
+	return fe.retry(desc, fe.maxRetries, fe.retryBackoff, fn)
+}
+
+func (fe *FlickrExporter) retry(desc string, maxRetries int, backoff time.Duration, fn func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = fn()
+		if err == nil || !isRetryableError(err) || attempt >= maxRetries {
+			break
+		}
+		delay := backoffDelay(backoff, attempt)
+		if fe.verbose {
+			fe.logf("Rate limited or unavailable %s, retrying in %v (attempt %d/%d)\n", desc, delay, attempt+1, maxRetries)
+		}
+		time.Sleep(delay)
+	}
+	if err != nil && isRetryableError(err) && maxRetries > 0 {
+		return fmt.Errorf("failed after %d retries: %w", maxRetries, err)
+	}
 	return err
 }
 
+// backoffDelay returns how long to wait before retry number attempt+1: base
+// doubled for each previous attempt, then randomized to between half and
+// one and a half times that, so that workers rate limited at the same time
+// don't all retry at the same time too.
+func backoffDelay(base time.Duration, attempt int) time.Duration {
+	delay := base * time.Duration(1<<attempt)
+	return delay/2 + time.Duration(rand.Int63n(int64(delay)+1))
+}
+
 func (fe *FlickrExporter) writeMetadata(photoPath string, photo Photo) error {
 	if fe.et == nil {
 		return nil // ExifTool not available
@@ -569,19 +1962,62 @@ func (fe *FlickrExporter) writeMetadata(photoPath string, photo Photo) error {
 	fm := exiftool.EmptyFileMetadata()
 	fm.File = photoPath
 
+	var keywords []string
+	for _, tag := range photo.Tags {
+		keywords = append(keywords, fe.tagPrefix+tag)
+	}
+	keywords = append(keywords, albumMembershipKeywords(photo.Albums)...)
+
+	// Flickr titles and descriptions may contain HTML
+	photo.Title = htmlToText(photo.Title)
+	photo.Description = htmlToText(photo.Description)
+
+	onlyXMP := holdsOnlyXMP(photoPath)
+	writeDateTaken := !photo.DateTaken.IsZero()
+	if writeDateTaken && fe.preferEXIFDate {
+		if existing, ok := fe.existingDateTaken(photoPath); ok {
+			if fe.verbose {
+				fe.logf("  Keeping the date taken in the file, %s, rather than Flickr's\n", existing)
+			}
+			writeDateTaken = false
+		} else if onlyXMP {
+			fm.SetString("XMP-exif:DateTimeOriginal", photo.DateTaken.Format("2006:01:02 15:04:05"))
+		} else {
+			fm.SetString("EXIF:DateTimeOriginal", photo.DateTaken.Format("2006:01:02 15:04:05"))
+		}
+	}
+
 	// Only set fields if they have content from Flickr
 	// Set IPTC metadata - only if not empty
-	if photo.Title != "" {
-		fm.SetString("IPTC:ObjectName", photo.Title) // IPTC - Status / Title
-	}
-	if photo.Description != "" {
-		fm.SetString("IPTC:Caption-Abstract", photo.Description) // IPTC - Content / Description
+	if fe.writesIPTC() && !onlyXMP {
+		if photo.Title != "" {
+			fe.setIPTCText(&fm, photo, "IPTC:ObjectName", "XMP-dc:Title", photo.Title, iptcObjectNameMax) // IPTC - Status / Title
+		}
+		if photo.Description != "" {
+			fe.setIPTCText(&fm, photo, "IPTC:Caption-Abstract", "XMP-dc:Description", photo.Description, iptcCaptionAbstractMax) // IPTC - Content / Description
+		}
+		if len(keywords) > 0 {
+			fm.SetStrings("IPTC:Keywords", keywords)
+		}
+		if photo.Owner != "" {
+			fe.setIPTCText(&fm, photo, "IPTC:By-line", "XMP-dc:Creator", photo.Owner, iptcBylineMax)
+		}
+		if notice := fe.copyrightNotice(photo); notice != "" {
+			fe.setIPTCText(&fm, photo, "IPTC:CopyrightNotice", "XMP-dc:Rights", notice, iptcCopyrightNoticeMax)
+		}
+		if writeDateTaken {
+			date, timeOfDay := iptcDateCreated(photo.DateTaken)
+			fm.SetString("IPTC:DateCreated", date)
+			fm.SetString("IPTC:TimeCreated", timeOfDay)
+		}
 	}
 
-	// Add keywords - only if we have tags
-	if len(photo.Tags) > 0 {
-		fm.SetStrings("IPTC:Keywords", photo.Tags)
-		fm.SetStrings("XMP:Subject", photo.Tags)
+	if fe.writesXMP() || onlyXMP {
+		fe.setXMPMetadata(&fm, photoPath, photo, keywords)
+	}
+	if onlyXMP && writeDateTaken {
+		// In place of the IPTC tags, which can't be written.
+		fm.SetString("XMP-photoshop:DateCreated", photo.DateTaken.Format("2006:01:02 15:04:05"))
 	}
 
 	// Use overwrite_original to preserve existing metadata while adding our fields
@@ -598,67 +2034,138 @@ func (fe *FlickrExporter) writeMetadata(photoPath string, photo Photo) error {
 	return nil
 }
 
-func (fe *FlickrExporter) downloadUnorganizedPhotos(downloadedFiles map[string]bool) error {
-	fmt.Println("Getting all photos from your Flickr account...")
+// iptcDateCreated returns the values of IPTC:DateCreated and
+// IPTC:TimeCreated for a photo taken at t, which ExifTool converts to IPTC's
+// CCYYMMDD and HHMMSS±HHMM. Flickr gives the date taken as the time on the
+// camera's clock, without a time zone, but IPTC requires an offset, so
+// +00:00 is always written. The time is the one shown on Flickr, whatever
+// t's location; the offset only means it isn't known.
+func iptcDateCreated(t time.Time) (date, timeOfDay string) {
+	return t.Format("2006:01:02"), t.Format("15:04:05") + "+00:00"
+}
+
+// setIPTCText sets tag, an IPTC tag limited to max bytes, to value. A value
+// that's too long is truncated, and so that it isn't lost, also written in
+// full to xmpTag if XMP tags aren't being written anyway.
+func (fe *FlickrExporter) setIPTCText(fm *exiftool.FileMetadata, photo Photo, tag, xmpTag, value string, max int) {
+	truncated := truncateIPTC(value, max)
+	fm.SetString(tag, truncated)
+	if truncated == value {
+		return
+	}
 
-	// Get all photos from the user's account
-	allPhotos, err := fe.getAllPhotos()
-	if err != nil {
-		return fmt.Errorf("failed to get all photos: %w", err)
+	if !fe.writesXMP() {
+		fm.SetString(xmpTag, value)
+	}
+	if fe.verbose {
+		fe.logf("  %s of %s is longer than IPTC allows (%d bytes); truncated it, with the full text in %s\n", tag, photo.Filename, max, xmpTag)
+	}
+}
+
+// setXMPMetadata adds photo's XMP tags to fm.
+func (fe *FlickrExporter) setXMPMetadata(fm *exiftool.FileMetadata, photoPath string, photo Photo, keywords []string) {
+	if photo.Title != "" {
+		fm.SetString("XMP-dc:Title", photo.Title)
+	}
+	if photo.Description != "" {
+		fm.SetString("XMP-dc:Description", photo.Description)
+	}
+	if len(keywords) > 0 {
+		fm.SetStrings("XMP:Subject", keywords)
+	}
+
+	if photo.Owner != "" {
+		fm.SetString("XMP-dc:Creator", photo.Owner)
+	}
+
+	if photo.PageURL != "" {
+		fm.SetString("XMP-dc:Source", photo.PageURL)
+	}
+
+	if rights := fe.rightsStatement(photo); rights != "" {
+		fm.SetString("XMP-dc:Rights", rights)
+	}
+	if photo.License.Name != "" {
+		fm.SetString("XMP-xmpRights:UsageTerms", photo.License.UsageTerms())
+		if photo.License.URL != "" {
+			fm.SetString("XMP-cc:License", photo.License.URL)
+		}
+	}
+
+	if fe.writeUploadDate && !photo.DateUploaded.IsZero() {
+		fm.SetString("XMP:DateTimeDigitized", photo.DateUploaded.UTC().Format("2006:01:02 15:04:05-07:00"))
+	}
+
+	if len(photo.MachineTags) > 0 && useFlickrXMPConfig() == nil {
+		fm.SetStrings("XMP-flickr:MachineTags", photo.MachineTags)
+	}
+
+	if fe.includeStats {
+		fm.SetInt("XMP-flickr:Views", int64(photo.Views))
+		fm.SetInt("XMP-flickr:Favorites", int64(photo.Favorites))
 	}
 
-	// Filter out photos that were already downloaded in photosets
-	var unorganizedPhotos []Photo
-	for _, photo := range allPhotos {
-		if !downloadedFiles[photo.Filename] {
-			unorganizedPhotos = append(unorganizedPhotos, photo)
+	if fe.includeNotes && len(photo.Notes) > 0 {
+		regionInfo, err := noteRegionInfo(photoPath, photo.Notes)
+		if err != nil {
+			fe.warnf("  Warning: Failed to write notes for %s: %v\n", photo.Filename, err)
+		} else {
+			fm.SetString("XMP-mwg-rs:RegionInfo", regionInfo)
 		}
 	}
+}
+
+// downloadUnorganizedPhotos downloads the photos that aren't in any album
+// into the unorganized photos folder, using workers to download them in
+// parallel. Flickr lists these photos directly, so the result doesn't depend
+// on which albums were exported or what their files are named.
+func (fe *FlickrExporter) downloadUnorganizedPhotos(workers []*FlickrExporter) error {
+	if fe.maxPhotos.reached() {
+		return nil
+	}
+
+	fe.logf("Getting photos that aren't in any album...\n")
+
+	unorganizedPhotos, err := fe.getPhotosNotInSet()
+	if err != nil {
+		return fmt.Errorf("failed to get unorganized photos: %w", err)
+	}
 
 	if len(unorganizedPhotos) == 0 {
-		fmt.Println("No unorganized photos found - all photos are in photosets!")
+		fe.logf("No unorganized photos found - all photos are in photosets!\n")
 		return nil
 	}
 
-	fmt.Printf("Found %d unorganized photos to download, processing with 4 concurrent workers...\n", len(unorganizedPhotos))
+	fe.logf("Found %d unorganized photos to download, processing with %d concurrent workers...\n", len(unorganizedPhotos), len(workers))
 
 	// Create "Unorganized Photos" directory
-	unorganizedDir := filepath.Join(fe.outputDir, "Unorganized Photos")
+	unorganizedDir := filepath.Join(fe.outputDir, fe.unorganizedDir)
 	if err := os.MkdirAll(unorganizedDir, 0755); err != nil {
 		return fmt.Errorf("failed to create unorganized photos directory: %w", err)
 	}
+	fe.exported.addDir(unorganizedDir)
+
+	if fe.originalFilenames {
+		uniqueFilenames(unorganizedPhotos)
+	}
+	unorganizedAlbum := Album{Title: unorganizedAlbumTitle, Photos: unorganizedPhotos}
+
+	fe.addToTotal(len(unorganizedPhotos))
+	fe.progress.setAlbum(unorganizedAlbumTitle)
+	fe.events.albumStarted(unorganizedAlbum, unorganizedDir)
 
 	// Create a work queue for photos
 	photoChan := make(chan Photo, len(unorganizedPhotos))
 	errorChan := make(chan error, len(unorganizedPhotos))
 
-	// Start 4 worker goroutines
+	// Start worker goroutines
 	var wg sync.WaitGroup
-	const numWorkers = 4
-
-	for i := 0; i < numWorkers; i++ {
+	for i, workerExporter := range workers {
 		wg.Add(1)
-		go func(workerID int) {
+		go func(workerID int, workerExporter *FlickrExporter) {
 			defer wg.Done()
-			// Create a separate exporter for this worker to avoid race conditions
-			workerET, err := exiftool.NewExiftool()
-			if err != nil {
-				errorChan <- fmt.Errorf("worker %d: could not initialize exiftool: %w", workerID, err)
-				return
-			}
-			defer workerET.Close()
-			
-			workerExporter := &FlickrExporter{
-				client:    flickr.NewFlickrClient(fe.client.ApiKey, fe.client.ApiSecret),
-				outputDir: fe.outputDir,
-				et:        workerET,
-				verbose:   fe.verbose,
-			}
-			workerExporter.client.OAuthToken = fe.client.OAuthToken
-			workerExporter.client.OAuthTokenSecret = fe.client.OAuthTokenSecret
-
 			fe.unorganizedPhotoWorker(workerID, workerExporter, photoChan, errorChan, unorganizedDir)
-		}(i)
+		}(i, workerExporter)
 	}
 
 	// Send photos to workers
@@ -670,6 +2177,15 @@ func (fe *FlickrExporter) downloadUnorganizedPhotos(downloadedFiles map[string]b
 	// Wait for all workers to complete
 	wg.Wait()
 	close(errorChan)
+	fe.events.albumFinished(unorganizedAlbum, unorganizedDir)
+
+	// Photos exported into the output directory itself have no folder of
+	// their own to write a gallery for or archive.
+	if fe.html && fe.unorganizedDir != "" {
+		if err := writeAlbumGallery(fe.outputDir, unorganizedDir, unorganizedAlbum); err != nil {
+			fe.warnf("Warning: Failed to write gallery for unorganized photos: %v\n", err)
+		}
+	}
 
 	// Collect and report errors
 	var errors []error
@@ -682,98 +2198,167 @@ func (fe *FlickrExporter) downloadUnorganizedPhotos(downloadedFiles map[string]b
 		}
 	}
 
+	if fe.unorganizedDir != "" {
+		fe.archiveAlbum(unorganizedDir, len(errors) == 0)
+	}
+
 	if len(errors) > 0 {
-		fmt.Printf("Downloaded %d unorganized photos with %d errors\n", successCount, len(errors))
+		fe.warnf("Downloaded %d unorganized photos with %d errors\n", successCount, len(errors))
 		for _, err := range errors {
-			fmt.Printf("  Error: %v\n", err)
+			fe.warnf("  Error: %v\n", err)
 		}
-		return fmt.Errorf("failed to download %d unorganized photos", len(errors))
+		return partialExportErrorf("failed to download %d unorganized photos", len(errors))
 	}
 
-	fmt.Printf("Successfully downloaded %d unorganized photos\n", successCount)
+	fe.logf("Successfully downloaded %d unorganized photos\n", successCount)
 	return nil
 }
 
 func (fe *FlickrExporter) unorganizedPhotoWorker(workerID int, workerExporter *FlickrExporter, photoChan <-chan Photo, errorChan chan<- error, unorganizedDir string) {
 	for photo := range photoChan {
-		if workerExporter.verbose {
-			fmt.Printf("[Worker %d] Downloading unorganized photo: %s\n", workerID, photo.Title)
+		err := workerExporter.downloadUnorganizedPhoto(workerID, photo, unorganizedDir)
+		if err != nil {
+			fe.events.photoFailed(Album{Title: unorganizedAlbumTitle}, photo, filepath.Join(unorganizedDir, photo.Filename), err)
 		}
+		errorChan <- err
+		fe.photoDone()
+	}
+}
 
-		photoPath := filepath.Join(unorganizedDir, photo.Filename)
+func (fe *FlickrExporter) downloadUnorganizedPhoto(workerID int, photo Photo, unorganizedDir string) error {
+	if fe.verbose {
+		fe.logf("[Worker %d] Downloading unorganized photo: %s\n", workerID, photo.Title)
+	}
 
-		// Check if photo already exists
-		if _, err := os.Stat(photoPath); err == nil {
-			if workerExporter.verbose {
-				fmt.Printf("[Worker %d] Skipping (already exists): %s\n", workerID, photo.Filename)
-			}
-			errorChan <- nil // Signal successful completion (skip)
-			continue
-		}
+	photoPath := filepath.Join(unorganizedDir, photo.Filename)
 
-		// Fetch metadata only when we need to download
-		if err := workerExporter.fetchPhotoMetadata(&photo); err != nil {
-			errorChan <- fmt.Errorf("worker %d: failed to get metadata for %s: %w", workerID, photo.Filename, err)
-			continue
-		}
+	if fe.ignoresPhoto(photo) {
+		fe.exported.addFile(photoPath)
+		fe.events.photoSkipped(Album{Title: unorganizedAlbumTitle}, photo, photoPath, skipIgnored)
+		return nil
+	}
 
-		if err := workerExporter.downloadPhoto(photo, photoPath); err != nil {
-			errorChan <- fmt.Errorf("worker %d: failed to download %s: %w", workerID, photo.Filename, err)
-			continue
+	// Check if photo already exists
+	if _, err := os.Stat(photoPath); err == nil && !fe.overwrite {
+		if fe.verbose {
+			fe.logf("[Worker %d] Skipping (already exists): %s\n", workerID, photo.Filename)
 		}
+		fe.recordPhoto(Album{Title: unorganizedAlbumTitle}, photo, photoPath, false)
+		fe.events.photoSkipped(Album{Title: unorganizedAlbumTitle}, photo, photoPath, skipExists)
+		return nil // Signal successful completion (skip)
+	}
 
-		// Write metadata - this is critical, remove photo if it fails
-		if err := workerExporter.writeMetadata(photoPath, photo); err != nil {
-			fmt.Printf("[Worker %d] Error: Failed to write metadata for %s: %v\n", workerID, photo.Filename, err)
-			// Remove the downloaded photo since we can't write metadata
-			if removeErr := os.Remove(photoPath); removeErr != nil {
-				fmt.Printf("[Worker %d] Error: Also failed to remove incomplete photo %s: %v\n", workerID, photo.Filename, removeErr)
-			}
-			errorChan <- fmt.Errorf("worker %d: failed to write metadata for %s: %w", workerID, photo.Filename, err)
-			continue
+	if !fe.maxPhotos.take() {
+		return nil
+	}
+	downloaded := false
+	defer func() { fe.maxPhotos.finish(downloaded) }()
+
+	// Fetch metadata only when we need to download
+	if !fe.noMetadata || fe.filtersSafety() {
+		if err := fe.fetchPhotoMetadata(&photo); err != nil {
+			return fmt.Errorf("worker %d: failed to get metadata for %s: %w", workerID, photo.Filename, err)
 		}
+		if !fe.allowsSafety(photo) {
+			fe.events.photoSkipped(Album{Title: unorganizedAlbumTitle}, photo, photoPath, skipSafety)
+			return nil
+		}
+	}
 
-		// Rate limiting: sleep 100ms between downloads
-		time.Sleep(100 * time.Millisecond)
+	if err := fe.downloadPhoto(photo, photoPath); err != nil {
+		return fmt.Errorf("worker %d: failed to download %s: %w", workerID, photo.Filename, err)
+	}
+
+	if err := fe.writeMetadata(photoPath, photo); err != nil {
+		fe.warnf("[Worker %d] Error: Failed to write metadata for %s: %v\n", workerID, photo.Filename, err)
+		if err := fe.keepWithoutMetadata(photo, photoPath, err); err != nil {
+			return fmt.Errorf("worker %d: failed to write metadata for %s: %w", workerID, photo.Filename, err)
+		}
+	}
 
-		errorChan <- nil // Signal successful completion
+	if err := fe.tarStream.add(photoPath); err != nil {
+		return fmt.Errorf("worker %d: failed to stream %s: %w", workerID, photo.Filename, err)
 	}
+
+	downloaded = true
+	fe.recordPhoto(Album{Title: unorganizedAlbumTitle}, photo, photoPath, true)
+	fe.events.photoDownloaded(Album{Title: unorganizedAlbumTitle}, photo, photoPath)
+
+	// Rate limiting: sleep 100ms between downloads
+	time.Sleep(100 * time.Millisecond)
+
+	return nil // Signal successful completion
 }
 
 func (fe *FlickrExporter) getAllPhotos() ([]Photo, error) {
+	method := "flickr.people.getPhotos"
+	args := url.Values{}
+	if !fe.since.IsZero() {
+		method = "flickr.photos.search"
+		args.Set("min_upload_date", fmt.Sprintf("%d", fe.since.Unix()))
+	}
+	args.Set("user_id", fe.userID)
+	if safeSearch := safeSearchParam(fe.safetyLevel); safeSearch != "" {
+		args.Set("safe_search", safeSearch)
+	}
+
+	allPhotos, err := fe.listPhotos(method, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if fe.isCurrentUser() {
+		fe.logf("Found %d total photos in your account\n", len(allPhotos))
+	} else {
+		fe.logf("Found %d total photos of user %s\n", len(allPhotos), fe.userID)
+	}
+	return allPhotos, nil
+}
+
+// getPhotosNotInSet returns the user's photos that aren't in any album,
+// which is much cheaper than listing every album's photos to find them.
+func (fe *FlickrExporter) getPhotosNotInSet() ([]Photo, error) {
+	args := url.Values{}
+	if !fe.since.IsZero() {
+		args.Set("min_upload_date", fmt.Sprintf("%d", fe.since.Unix()))
+	}
+	return fe.listPhotos("flickr.photos.getNotInSet", args)
+}
+
+// listPhotos pages through the results of method, an API method returning a
+// list of photos, called with args and the arguments for paging.
+func (fe *FlickrExporter) listPhotos(method string, args url.Values) ([]Photo, error) {
 	var allPhotos []Photo
 	page := 1
 
 	for {
-		// Re-initialize the client for each page request
-		fe.client.Init()
-		fe.client.Args.Set("method", "flickr.people.getPhotos")
-		fe.client.Args.Set("user_id", "me")
-		fe.client.Args.Set("extras", "original_format,url_o")
-		fe.client.Args.Set("per_page", "500")
-		fe.client.Args.Set("page", fmt.Sprintf("%d", page))
-		fe.client.OAuthSign()
-
 		response := &PhotosResponse{}
-		err := flickr.DoGet(fe.client, response)
+		err := fe.withRetry(fmt.Sprintf("getting photos page %d", page), func() error {
+			args.Set("extras", fe.listingExtras("original_format,url_o,url_c"))
+			args.Set("per_page", "500")
+			args.Set("page", fmt.Sprintf("%d", page))
+			if filter := privacyFilterParam(fe.privacy); filter != "" {
+				args.Set("privacy_filter", filter)
+			}
+
+			response = &PhotosResponse{}
+			return fe.api.Get(method, args, true, response)
+		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to get photos page %d: %w", page, err)
 		}
 
-		if response.HasErrors() {
-			return nil, fmt.Errorf("flickr API error on page %d: %s", page, response.ErrorMsg())
-		}
-
-		fmt.Printf("Fetching page %d/%d: Got %d photos\n", page, response.Photos.Pages, len(response.Photos.Photo))
+		fe.logf("Fetching page %d/%d: Got %d photos\n", page, response.Photos.Pages, len(response.Photos.Photo))
 
 		// Parse photos from this page
 		for _, photoData := range response.Photos.Photo {
 			photo, err := fe.parsePhotoFromPhotosAPI(photoData)
 			if err != nil {
-				fmt.Printf("Warning: Failed to get metadata for photo %s: %v\n", photoData.ID, err)
+				fe.warnf("Warning: Failed to get metadata for photo %s: %v\n", photoData.ID, err)
 				continue // Skip this photo but continue with others
 			}
-			if photo.OriginalURL != "" {
+			fe.setListedInfo(&photo, photoData.listedInfo, "")
+			if matchesPrivacy(photo.Visibility, fe.privacy) && fe.isDownloadable(&photo) {
 				allPhotos = append(allPhotos, photo)
 			}
 		}
@@ -788,11 +2373,11 @@ func (fe *FlickrExporter) getAllPhotos() ([]Photo, error) {
 		time.Sleep(100 * time.Millisecond)
 	}
 
-	fmt.Printf("Found %d total photos in your account\n", len(allPhotos))
 	return allPhotos, nil
 }
 
-// PhotosResponse represents the response from flickr.people.getPhotos
+// PhotosResponse represents the response from flickr.people.getPhotos or
+// flickr.photos.search
 type PhotosResponse struct {
 	flickr.BasicResponse
 	Photos PhotosData `xml:"photos"`
@@ -810,6 +2395,18 @@ type PhotoItem struct {
 	ID          string `xml:"id,attr"`
 	Title       string `xml:"title,attr"`
 	OriginalURL string `xml:"url_o,attr"`
+	URLC        string `xml:"url_c,attr"`
+	WidthO      int    `xml:"width_o,attr"`
+	HeightO     int    `xml:"height_o,attr"`
+	IsPublic    bool   `xml:"ispublic,attr"`
+	IsFriend    bool   `xml:"isfriend,attr"`
+	IsFamily    bool   `xml:"isfamily,attr"`
+	// Server, OriginalSecret, and OriginalFormat are given with the
+	// original_format extra, if the caller may download the original.
+	Server         string `xml:"server,attr"`
+	OriginalSecret string `xml:"originalsecret,attr"`
+	OriginalFormat string `xml:"originalformat,attr"`
+	listedInfo
 }
 
 func (fe *FlickrExporter) parsePhotoFromPhotosAPI(photoData PhotoItem) (Photo, error) {
@@ -817,98 +2414,137 @@ func (fe *FlickrExporter) parsePhotoFromPhotosAPI(photoData PhotoItem) (Photo, e
 		ID:          photoData.ID,
 		Title:       photoData.Title,
 		OriginalURL: photoData.OriginalURL,
+		Width:       photoData.WidthO,
+		Height:      photoData.HeightO,
+		Visibility: Visibility{
+			IsPublic: photoData.IsPublic,
+			IsFriend: photoData.IsFriend,
+			IsFamily: photoData.IsFamily,
+		},
+	}
+	if photo.OriginalURL == "" {
+		photo.OriginalURL = originalPhotoURL(photoData.Server, photo.ID, photoData.OriginalSecret, photoData.OriginalFormat)
 	}
 
 	// Extract filename from URL
 	if photo.OriginalURL != "" {
 		parts := strings.Split(photo.OriginalURL, "/")
 		if len(parts) > 0 {
-			photo.Filename = parts[len(parts)-1]
+			photo.Filename = fe.photoFilename(parts[len(parts)-1], photo.Title)
 		}
+	} else {
+		fe.noOriginalFilename(&photo, photoData.URLC)
 	}
 
 	// Don't fetch metadata here - we'll do it later only if needed
 	return photo, nil
 }
 
+// fetchPhotoMetadata fills in photo's details from Flickr. Each photo is only
+// looked up once per run, however many albums it's in.
 func (fe *FlickrExporter) fetchPhotoMetadata(photo *Photo) error {
-	detailedPhoto, err := fe.getPhotoInfo(photo.ID)
-	if err != nil {
-		return fmt.Errorf("failed to get metadata for photo %s (%s): %w", photo.ID, photo.Title, err)
+	detailedPhoto, ok := fe.photoInfo.get(photo.ID)
+	if !ok {
+		var err error
+		if fe.needsPhotoInfo(*photo) {
+			detailedPhoto, err = fe.getPhotoInfo(photo.ID)
+			if err != nil {
+				return fmt.Errorf("failed to get metadata for photo %s (%s): %w", photo.ID, photo.Title, err)
+			}
+		} else {
+			detailedPhoto = fe.listedPhotoInfo(*photo)
+		}
+		if fe.albumKeywords {
+			detailedPhoto.Albums, err = fe.getPhotoAlbums(photo.ID)
+			if err != nil {
+				return err
+			}
+		}
+		if fe.includeStats {
+			detailedPhoto.Favorites, err = fe.getFavoritesCount(photo.ID)
+			if err != nil {
+				return err
+			}
+		}
+		fe.photoInfo.add(detailedPhoto)
+	}
+
+	// Listings leave out the URL of some originals that can be downloaded,
+	// which photos.getInfo gives what's needed to build.
+	if photo.NoOriginal && detailedPhoto.OriginalURL != "" {
+		photo.OriginalURL = detailedPhoto.OriginalURL
+		photo.NoOriginal = false
 	}
 	photo.Description = detailedPhoto.Description
 	photo.Tags = detailedPhoto.Tags
+	photo.MachineTags = detailedPhoto.MachineTags
 	photo.DateTaken = detailedPhoto.DateTaken
+	photo.DateUploaded = detailedPhoto.DateUploaded
+	photo.Notes = detailedPhoto.Notes
+	photo.License = detailedPhoto.License
+	photo.PageURL = detailedPhoto.PageURL
+	photo.Owner = detailedPhoto.Owner
+	photo.SafetyLevel = detailedPhoto.SafetyLevel
+	photo.Albums = detailedPhoto.Albums
+	photo.Views = detailedPhoto.Views
+	photo.Favorites = detailedPhoto.Favorites
 	return nil
 }
 
 func (fe *FlickrExporter) getPhotoInfo(photoID string) (Photo, error) {
-	maxRetries := 5
-	baseDelay := 2 * time.Second
-	
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		fe.client.Init()
-		fe.client.Args.Set("method", "flickr.photos.getInfo")
-		fe.client.Args.Set("photo_id", photoID)
-		fe.client.OAuthSign()
-
-		response := &PhotoInfoResponse{}
-		err := flickr.DoGet(fe.client, response)
-		if err != nil {
-			// Check if it's a rate limiting error
-			if strings.Contains(err.Error(), "HTTP 429") || strings.Contains(err.Error(), "rate limit") {
-				if attempt < maxRetries-1 {
-					delay := baseDelay * time.Duration(1<<attempt) // Exponential backoff
-					if fe.verbose {
-						fmt.Printf("Rate limited getting photo info for %s, retrying in %v (attempt %d/%d)\n", photoID, delay, attempt+1, maxRetries)
-					}
-					time.Sleep(delay)
-					continue
-				}
-			}
-			return Photo{}, fmt.Errorf("failed to get photo info for %s after %d attempts: %w", photoID, maxRetries, err)
-		}
-
-		if response.HasErrors() {
-			// Check if the error message indicates rate limiting
-			errorMsg := response.ErrorMsg()
-			if strings.Contains(errorMsg, "rate limit") || strings.Contains(errorMsg, "too many requests") {
-				if attempt < maxRetries-1 {
-					delay := baseDelay * time.Duration(1<<attempt) // Exponential backoff
-					if fe.verbose {
-						fmt.Printf("Rate limited getting photo info for %s, retrying in %v (attempt %d/%d)\n", photoID, delay, attempt+1, maxRetries)
-					}
-					time.Sleep(delay)
-					continue
-				}
-			}
-			return Photo{}, fmt.Errorf("flickr API error for photo %s: %s", photoID, errorMsg)
-		}
+	response := &PhotoInfoResponse{}
+	err := fe.withRetry("getting photo info for "+photoID, func() error {
+		response = &PhotoInfoResponse{}
+		return fe.api.Get("flickr.photos.getInfo", url.Values{"photo_id": {photoID}}, true, response)
+	})
+	if err != nil {
+		return Photo{}, fmt.Errorf("failed to get photo info for %s: %w", photoID, err)
+	}
 
-		// Success! Parse the response
-		var tags []string
-		for _, tag := range response.Photo.Tags.Tag {
+	var tags, machineTags []string
+	for _, tag := range response.Photo.Tags.Tag {
+		if tag.MachineTag || isMachineTag(tag.Raw) {
+			machineTags = append(machineTags, tag.Raw)
+		} else {
 			tags = append(tags, tag.Raw)
 		}
+	}
 
-		// Parse date taken
-		var dateTaken time.Time
-		if response.Photo.Dates.Taken != "" {
-			if parsed, err := time.Parse("2006-01-02 15:04:05", response.Photo.Dates.Taken); err == nil {
-				dateTaken = parsed
-			}
+	// Parse date taken
+	var dateTaken time.Time
+	if response.Photo.Dates.Taken != "" {
+		if parsed, err := time.Parse("2006-01-02 15:04:05", response.Photo.Dates.Taken); err == nil {
+			dateTaken = parsed
 		}
+	}
+
+	// Date posted is a Unix timestamp
+	var dateUploaded time.Time
+	if response.Photo.Dates.Posted > 0 {
+		dateUploaded = time.Unix(response.Photo.Dates.Posted, 0)
+	}
 
-		return Photo{
-			ID:          photoID,
-			Title:       response.Photo.Title.Content,
-			Description: response.Photo.Description.Content,
-			Tags:        tags,
-			DateTaken:   dateTaken,
-		}, nil
+	license, ok := lookupLicense(response.Photo.License)
+	if !ok && fe.verbose {
+		fe.logf("Unknown license ID %q for photo %s\n", response.Photo.License, photoID)
 	}
-	
-	return Photo{}, fmt.Errorf("failed to get photo info for %s after %d retry attempts", photoID, maxRetries)
+
+	return Photo{
+		ID:           photoID,
+		OriginalURL:  originalPhotoURL(response.Photo.Server, photoID, response.Photo.OriginalSecret, response.Photo.OriginalFormat),
+		PageURL:      photoPageURL(response.Photo.Owner.NSID, photoID),
+		Owner:        response.Photo.Owner.name(),
+		Title:        response.Photo.Title.Content,
+		Description:  response.Photo.Description.Content,
+		Tags:         tags,
+		MachineTags:  machineTags,
+		DateTaken:    dateTaken,
+		DateUploaded: dateUploaded,
+		Notes:        parsePhotoNotes(response.Photo.Notes),
+		License:      license,
+		SafetyLevel:  response.Photo.SafetyLevel,
+		Views:        response.Photo.Views,
+	}, nil
 }
 
 // PhotoInfoResponse represents the response from flickr.photos.getInfo
@@ -918,11 +2554,37 @@ type PhotoInfoResponse struct {
 }
 
 type PhotoInfoDetail struct {
-	ID          string                `xml:"id,attr"`
-	Title       PhotoInfoTitle        `xml:"title"`
-	Description PhotoInfoDescription  `xml:"description"`
-	Tags        PhotoInfoTags         `xml:"tags"`
-	Dates       PhotoInfoDates        `xml:"dates"`
+	ID          string               `xml:"id,attr"`
+	License     string               `xml:"license,attr"`
+	Owner       PhotoInfoOwner       `xml:"owner"`
+	SafetyLevel int                  `xml:"safety_level,attr"`
+	Views       int                  `xml:"views,attr"`
+	Title       PhotoInfoTitle       `xml:"title"`
+	Description PhotoInfoDescription `xml:"description"`
+	Tags        PhotoInfoTags        `xml:"tags"`
+	Dates       PhotoInfoDates       `xml:"dates"`
+	Notes       PhotoInfoNotes       `xml:"notes"`
+	Server      string               `xml:"server,attr"`
+	Farm        string               `xml:"farm,attr"`
+	// OriginalSecret and OriginalFormat are only given if the caller may
+	// download the photo's original.
+	OriginalSecret string `xml:"originalsecret,attr"`
+	OriginalFormat string `xml:"originalformat,attr"`
+}
+
+type PhotoInfoOwner struct {
+	NSID     string `xml:"nsid,attr"`
+	Username string `xml:"username,attr"`
+	RealName string `xml:"realname,attr"`
+}
+
+// name returns the owner's real name, or their username if they haven't
+// given one.
+func (o PhotoInfoOwner) name() string {
+	if name := strings.TrimSpace(o.RealName); name != "" {
+		return name
+	}
+	return o.Username
 }
 
 type PhotoInfoTitle struct {
@@ -938,11 +2600,33 @@ type PhotoInfoTags struct {
 }
 
 type PhotoInfoTag struct {
-	Raw string `xml:"raw,attr"`
+	Raw        string `xml:"raw,attr"`
+	MachineTag bool   `xml:"machine_tag,attr"`
 }
 
 type PhotoInfoDates struct {
-	Taken string `xml:"taken,attr"`
+	Taken  string `xml:"taken,attr"`
+	Posted int64  `xml:"posted,attr"`
+}
+
+// originalPhotoURL returns the URL of a photo's original, on server, from
+// its original secret and format, or "" if they weren't given because the
+// caller can't download it. The format, such as "png" or "gif", is the
+// original's extension, so photos named after the URL keep it.
+func originalPhotoURL(server, photoID, originalSecret, originalFormat string) string {
+	if server == "" || server == "0" || originalSecret == "" || originalFormat == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://live.staticflickr.com/%s/%s_%s_o.%s", server, photoID, originalSecret, originalFormat)
+}
+
+// photoPageURL returns the URL of a photo's page on Flickr. The owner's NSID
+// is used rather than their custom URL, which can change.
+func photoPageURL(ownerNSID, photoID string) string {
+	if ownerNSID == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://www.flickr.com/photos/%s/%s/", ownerNSID, photoID)
 }
 
 func sanitizeFilename(filename string) string {
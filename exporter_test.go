@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/barasher/go-exiftool"
+)
+
+// failingExiftool returns a newExiftool that fails on the given calls,
+// numbered from 1, and otherwise returns no process, as with --no-metadata.
+func failingExiftool(failOn ...int) func() (*exiftool.Exiftool, error) {
+	var calls atomic.Int32
+	return func() (*exiftool.Exiftool, error) {
+		call := int(calls.Add(1))
+		for _, n := range failOn {
+			if call == n {
+				return nil, errors.New("exiftool failed to start")
+			}
+		}
+		return nil, nil
+	}
+}
+
+func TestStartWorkersContinuesWithoutFailedWorker(t *testing.T) {
+	var log bytes.Buffer
+	fe := &FlickrExporter{
+		concurrency: 4,
+		noMetadata:  true,
+		runLog:      newRunLog(&log),
+		newExiftool: failingExiftool(3),
+	}
+
+	stop := fe.startPhotoWorkers()
+	defer stop()
+	if got := len(fe.photoWorkers); got != 2 {
+		t.Fatalf("started %d workers, want the 2 started before the failure", got)
+	}
+	if !strings.Contains(log.String(), "Could not start worker 3, continuing with 2 workers") {
+		t.Errorf("failure wasn't reported; log:\n%s", log.String())
+	}
+
+	const n = 100
+	var mu sync.Mutex
+	done := make(map[int]int)
+	users := make(map[*FlickrExporter]bool)
+	fe.forEachParallel(n, func(worker *FlickrExporter, i int) {
+		mu.Lock()
+		defer mu.Unlock()
+		done[i]++
+		users[worker] = true
+	})
+	for i := 0; i < n; i++ {
+		if done[i] != 1 {
+			t.Errorf("index %d processed %d times, want 1", i, done[i])
+		}
+	}
+	for worker := range users {
+		if worker != fe.photoWorkers[0] && worker != fe.photoWorkers[1] {
+			t.Errorf("index processed by %p, which isn't a started worker", worker)
+		}
+	}
+}
+
+func TestStartWorkersAllFail(t *testing.T) {
+	var log bytes.Buffer
+	fe := &FlickrExporter{
+		concurrency: 3,
+		noMetadata:  true,
+		runLog:      newRunLog(&log),
+		newExiftool: failingExiftool(1, 2, 3),
+	}
+
+	if _, err := fe.startWorkers(3); err == nil {
+		t.Fatal("startWorkers succeeded with no workers started")
+	}
+
+	stop := fe.startPhotoWorkers()
+	defer stop()
+	if !strings.Contains(log.String(), "Could not start workers, continuing without them") {
+		t.Errorf("failure wasn't reported; log:\n%s", log.String())
+	}
+
+	// Without workers, every index is processed by fe itself.
+	var count int
+	fe.forEachParallel(10, func(worker *FlickrExporter, i int) {
+		if worker != fe {
+			t.Errorf("index %d processed by a worker, want fe", i)
+		}
+		count++
+	})
+	if count != 10 {
+		t.Errorf("processed %d indexes, want 10", count)
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	rateLimited := errors.New("HTTP 429: 429 Too Many Requests")
+	notFound := &FlickrAPIError{Code: 1, Msg: "Photo not found"}
+	unavailable := &FlickrAPIError{Code: flickrErrServiceUnavailable, Msg: "Service currently unavailable"}
+
+	tests := []struct {
+		name       string
+		maxRetries int
+		// errs are returned by each call in turn; calls past the end
+		// succeed.
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{"succeeds first time", 4, nil, 1, nil},
+		{"fails twice then succeeds", 4, []error{rateLimited, unavailable}, 3, nil},
+		{"not retryable", 4, []error{notFound, nil}, 1, notFound},
+		{"retryable error after non-retryable", 4, []error{notFound, rateLimited}, 1, notFound},
+		{"gives up after max retries", 2, []error{unavailable, unavailable, unavailable, unavailable}, 3, unavailable},
+		{"no retries", 0, []error{rateLimited}, 1, rateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fe := &FlickrExporter{maxRetries: tt.maxRetries}
+			calls := 0
+			err := fe.withRetry("testing", func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("called %d times, want %d", calls, tt.wantCalls)
+			}
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// photoServer serves a photo's content at /photo.jpg, responding to each
+// request in turn with the given status codes, and with 200 once they've
+// run out.
+func photoServer(t *testing.T, content string, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		if n <= len(statuses) && statuses[n-1] != http.StatusOK {
+			http.Error(w, http.StatusText(statuses[n-1]), statuses[n-1])
+			return
+		}
+		io.WriteString(w, content)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestDownloadPhoto(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantRequests int32
+		wantErr      string
+	}{
+		{"succeeds", nil, 1, ""},
+		{"retries rate limiting", []int{http.StatusTooManyRequests}, 2, ""},
+		{"gives up when still rate limited", []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests}, 3, "HTTP 429"},
+		{"doesn't retry not found", []int{http.StatusNotFound}, 1, "HTTP 404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := photoServer(t, "photo data", tt.statuses...)
+			fe := newTestExporter(t, &fakeFlickrAPI{}, ExporterOptions{HTTPClient: srv.Client(), MaxRetries: 2})
+
+			path := filepath.Join(t.TempDir(), "photo.jpg")
+			err := fe.downloadPhoto(Photo{ID: "1", Filename: "photo.jpg", OriginalURL: srv.URL + "/photo.jpg"}, path)
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("made %d requests, want %d", got, tt.wantRequests)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("downloadPhoto: %v", err)
+			}
+			if data, err := os.ReadFile(path); err != nil || string(data) != "photo data" {
+				t.Errorf("downloaded %q (%v), want the photo", data, err)
+			}
+		})
+	}
+}
+
+func TestDownloadPhotoTruncated(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every response is cut off halfway through.
+		requests.Add(1)
+		w.Header().Set("Content-Length", "20")
+		io.WriteString(w, "first ten.")
+	}))
+	defer srv.Close()
+	fe := newTestExporter(t, &fakeFlickrAPI{}, ExporterOptions{HTTPClient: srv.Client(), MaxRetries: 1})
+
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	err := fe.downloadPhoto(Photo{ID: "1", Filename: "photo.jpg", OriginalURL: srv.URL + "/photo.jpg"}, path)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got error %v, want an unexpected EOF", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("made %d requests, want 2 since a truncated download is retried", got)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("partial download left behind (%v); it would be skipped as exported on the next run", err)
+	}
+}
+
+func TestCollectionTreeAlbums(t *testing.T) {
+	// Travel
+	//   Paris (10)
+	//   Europe
+	//     Rome (11)
+	//     Paris (10), again
+	//     Italy
+	//       Venice (12)
+	//   Germany
+	//     Berlin (13)
+	tree := CollectionNode{
+		ID:    "1-100",
+		Title: "Travel",
+		Sets:  []CollectionSet{{ID: "10", Title: "Paris"}},
+		Collections: []CollectionNode{
+			{
+				ID:    "1-101",
+				Title: "Europe",
+				Sets:  []CollectionSet{{ID: "11", Title: "Rome"}, {ID: "10", Title: "Paris"}},
+				Collections: []CollectionNode{
+					{ID: "1-102", Title: "Italy", Sets: []CollectionSet{{ID: "12", Title: "Venice"}}},
+				},
+			},
+			{ID: "1-103", Title: "Germany", Sets: []CollectionSet{{ID: "13", Title: "Berlin"}}},
+		},
+	}
+	api := &fakeFlickrAPI{responses: map[string]func(url.Values) string{
+		"flickr.photosets.getInfo": func(args url.Values) string {
+			id := args.Get("photoset_id")
+			return fmt.Sprintf(`<rsp stat="ok"><photoset id="%s" photos="1"><title>Album %s</title></photoset></rsp>`, id, id)
+		},
+	}}
+
+	tests := []struct {
+		name    string
+		nest    bool
+		folders map[string]string
+	}{
+		{"flat", false, map[string]string{"10": "", "11": "", "12": "", "13": ""}},
+		{"nested", true, map[string]string{
+			"10": "Travel",
+			"11": filepath.Join("Travel", "Europe"),
+			"12": filepath.Join("Travel", "Europe", "Italy"),
+			"13": filepath.Join("Travel", "Germany"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fe := newTestExporter(t, api, ExporterOptions{NestCollections: tt.nest})
+
+			albums := fe.collectionTreeAlbums(tree, "", make(map[string]bool))
+			var ids []string
+			for _, album := range albums {
+				ids = append(ids, album.ID)
+				if want := tt.folders[album.ID]; album.Folder != want {
+					t.Errorf("album %s is in folder %q, want %q", album.ID, album.Folder, want)
+				}
+				if want := "Album " + album.ID; album.Title != want {
+					t.Errorf("album %s titled %q, want its own title %q", album.ID, album.Title, want)
+				}
+			}
+			// Paris is only exported once, under the first collection
+			// it's found in.
+			if got, want := strings.Join(ids, ","), "10,11,12,13"; got != want {
+				t.Errorf("got albums %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestIPTCDateCreated(t *testing.T) {
+	tests := []struct {
+		name     string
+		taken    time.Time
+		wantDate string
+		wantTime string
+	}{
+		{"as parsed from Flickr", time.Date(2019, 7, 4, 18, 30, 5, 0, time.UTC), "2019:07:04", "18:30:05+00:00"},
+		{"midnight", time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), "2001:01:01", "00:00:00+00:00"},
+		// The wall clock time is written whatever the location, so it
+		// matches Flickr's.
+		{"with a location", time.Date(2019, 7, 4, 18, 30, 5, 0, time.FixedZone("PDT", -7*60*60)), "2019:07:04", "18:30:05+00:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date, timeOfDay := iptcDateCreated(tt.taken)
+			if date != tt.wantDate || timeOfDay != tt.wantTime {
+				t.Errorf("iptcDateCreated(%v) = %q, %q, want %q, %q", tt.taken, date, timeOfDay, tt.wantDate, tt.wantTime)
+			}
+		})
+	}
+}
+
+func TestOriginalPhotoURL(t *testing.T) {
+	tests := []struct {
+		name                   string
+		server, secret, format string
+		want                   string
+	}{
+		{"jpeg", "65535", "a1b2c3", "jpg", "https://live.staticflickr.com/65535/123_a1b2c3_o.jpg"},
+		{"png", "65535", "a1b2c3", "png", "https://live.staticflickr.com/65535/123_a1b2c3_o.png"},
+		{"gif", "65535", "a1b2c3", "gif", "https://live.staticflickr.com/65535/123_a1b2c3_o.gif"},
+		{"no secret", "65535", "", "png", ""},
+		{"no format", "65535", "a1b2c3", "", ""},
+		{"no server", "0", "a1b2c3", "png", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := originalPhotoURL(tt.server, "123", tt.secret, tt.format); got != tt.want {
+				t.Errorf("originalPhotoURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListedOriginalFormats(t *testing.T) {
+	api := &fakeFlickrAPI{responses: map[string]func(url.Values) string{
+		"flickr.photosets.getPhotos": func(url.Values) string {
+			return `<rsp stat="ok"><photoset id="1" owner="12345@N00" page="1" pages="1" perpage="500" total="3">
+				<photo id="1" title="Diagram" server="65535" originalsecret="aaa" originalformat="png" />
+				<photo id="2" title="Animation" server="65535" originalsecret="bbb" originalformat="gif" url_o="https://live.staticflickr.com/65535/2_bbb_o.gif" />
+				<photo id="3" title="Photo.jpg" server="65535" originalsecret="ccc" originalformat="jpg" />
+			</photoset></rsp>`
+		},
+	}}
+
+	tests := []struct {
+		name      string
+		opts      ExporterOptions
+		filenames []string
+	}{
+		{"URL names", ExporterOptions{}, []string{"1_aaa_o.png", "2_bbb_o.gif", "3_ccc_o.jpg"}},
+		{"original filenames", ExporterOptions{OriginalFilenames: true}, []string{"Diagram.png", "Animation.gif", "Photo.jpg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fe := newTestExporter(t, api, tt.opts)
+			photos, err := fe.getAlbumPhotos("1")
+			if err != nil {
+				t.Fatalf("getAlbumPhotos: %v", err)
+			}
+			if len(photos) != len(tt.filenames) {
+				t.Fatalf("got %d photos, want %d", len(photos), len(tt.filenames))
+			}
+			for i, photo := range photos {
+				if photo.Filename != tt.filenames[i] {
+					t.Errorf("photo %s named %q, want %q", photo.ID, photo.Filename, tt.filenames[i])
+				}
+				// Only the GIF is written to as XMP alone.
+				if got, want := holdsOnlyXMP(photo.Filename), photo.ID == "2"; got != want {
+					t.Errorf("holdsOnlyXMP(%q) = %v, want %v", photo.Filename, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewHTTPClientProxy(t *testing.T) {
+	var proxied atomic.Value
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Requests sent through a proxy are for the absolute URL.
+		proxied.Store(r.URL.String())
+		io.WriteString(w, "photo data")
+	}))
+	defer proxy.Close()
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		proxyURL string
+	}{
+		{"flag", nil, proxy.URL},
+		{"environment", map[string]string{"HTTP_PROXY": proxy.URL}, ""},
+		{"flag over environment", map[string]string{"HTTP_PROXY": "http://proxy.invalid:3128"}, proxy.URL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearProxyEnv(t)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			proxied.Store("")
+
+			client := newHTTPClient(time.Minute, tt.proxyURL)
+			resp, err := client.Get("http://photos.example.invalid/1_abc_o.jpg")
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			resp.Body.Close()
+			if got, want := proxied.Load(), "http://photos.example.invalid/1_abc_o.jpg"; got != want {
+				t.Errorf("proxy got a request for %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestNewHTTPClientNoProxy(t *testing.T) {
+	clearProxyEnv(t)
+	t.Setenv("NO_PROXY", "direct.example.invalid")
+	client := newHTTPClient(time.Minute, "http://proxy.example.invalid:3128")
+	transport := client.Transport.(*http.Transport)
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://photos.example.invalid/1.jpg", "http://proxy.example.invalid:3128"},
+		{"https://photos.example.invalid/1.jpg", "http://proxy.example.invalid:3128"},
+		{"http://direct.example.invalid/1.jpg", ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+		proxyURL, err := transport.Proxy(req)
+		if err != nil {
+			t.Fatalf("Proxy(%s): %v", tt.url, err)
+		}
+		var got string
+		if proxyURL != nil {
+			got = proxyURL.String()
+		}
+		if got != tt.want {
+			t.Errorf("Proxy(%s) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+	if client.Timeout != time.Minute {
+		t.Errorf("Timeout = %v, want %v", client.Timeout, time.Minute)
+	}
+}
+
+// clearProxyEnv unsets the proxy environment variables for the rest of the
+// test.
+func clearProxyEnv(t *testing.T) {
+	for _, key := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "REQUEST_METHOD", "http_proxy", "https_proxy", "no_proxy"} {
+		t.Setenv(key, "")
+	}
+}
+
+func TestNewFlickrExporterLeavesPatternsAlone(t *testing.T) {
+	// Spare capacity that appending to the caller's slices would write to
+	include := make([]string, 1, 4)
+	include[0] = "Beach*"
+	ignored := make([]string, 1, 4)
+	ignored[0] = "Screenshots"
+	newTestExporter(t, &fakeFlickrAPI{}, ExporterOptions{
+		IncludeAlbums: include,
+		ExcludeAlbums: []string{"Private*"},
+		IgnoredAlbums: ignored,
+		IgnoredPhotos: []string{"IMG_*"},
+	})
+
+	if spare := include[:2][1]; spare != "" {
+		t.Errorf("IncludeAlbums' backing array was written to: %q", spare)
+	}
+	if spare := ignored[:2][1]; spare != "" {
+		t.Errorf("IgnoredAlbums' backing array was written to: %q", spare)
+	}
+}
+
+func TestNewFlickrExporterInvalidPatterns(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ExporterOptions
+		want string
+	}{
+		{"include", ExporterOptions{IncludeAlbums: []string{"ok", "[bad"}}, "invalid album pattern"},
+		{"exclude", ExporterOptions{ExcludeAlbums: []string{"[bad"}}, "invalid album pattern"},
+		{"ignored album", ExporterOptions{IgnoredAlbums: []string{"[bad"}}, "invalid ignore file pattern"},
+		{"ignored photo", ExporterOptions{IgnoredPhotos: []string{"[bad"}}, "invalid ignore file pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.OutputDir = t.TempDir()
+			opts.Concurrency = 1
+			opts.FlickrAPI = &fakeFlickrAPI{}
+			opts.NoMetadata = true
+			_, err := NewFlickrExporter("key", "secret", "", "", opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
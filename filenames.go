@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// asciiReplacements transliterates letters that don't decompose into an
+// ASCII letter plus combining marks.
+var asciiReplacements = strings.NewReplacer(
+	"ß", "ss", "Æ", "AE", "æ", "ae", "Œ", "OE", "œ", "oe",
+	"Ø", "O", "ø", "o", "Ł", "L", "ł", "l", "Đ", "D", "đ", "d",
+	"Þ", "Th", "þ", "th", "Ð", "D", "ð", "d", "ı", "i",
+	"‘", "'", "’", "'", "“", "'", "”", "'", "–", "-", "—", "-", "…", "...",
+)
+
+// windowsReservedNames can't be used as file names on Windows, with or
+// without an extension.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// defaultDateFormat is the layout of the creation date album folders are
+// prefixed with, unless --date-format is given.
+const defaultDateFormat = "2006-01-02"
+
+// dateFormatPresets are the names accepted by --date-format in place of a Go
+// time layout.
+var dateFormatPresets = map[string]string{
+	"iso":        defaultDateFormat,
+	"compact":    "20060102",
+	"year-month": "2006-01",
+	"year":       "2006",
+}
+
+// dateFormatLayout returns the Go time layout for a --date-format value,
+// which is either the name of a preset or a layout. Empty means the default.
+func dateFormatLayout(format string) (string, error) {
+	if format == "" {
+		return defaultDateFormat, nil
+	}
+	if layout, ok := dateFormatPresets[format]; ok {
+		return layout, nil
+	}
+
+	// A layout without any date elements would give every album the same
+	// prefix, and is most likely a mistake, such as "YYYY-MM-DD".
+	reference := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	if reference.Format(format) == format {
+		return "", fmt.Errorf("invalid date format %q: it must be a Go time layout like 2006-01-02, or one of: compact, iso, year, year-month", format)
+	}
+	if strings.ContainsAny(format, `/\`) {
+		return "", fmt.Errorf("invalid date format %q: it can't contain path separators", format)
+	}
+	return format, nil
+}
+
+// folderName returns the name to use on disk for a folder named after an
+// album or other title, applying the stricter naming options if enabled.
+func (fe *FlickrExporter) folderName(title string) string {
+	name := sanitizeFilename(title)
+	if fe.asciiFilenames {
+		name = portableFilename(name)
+	}
+	if fe.lowercaseFilenames {
+		name = strings.ToLower(name)
+	}
+	if fe.replaceSpaces != "" {
+		name = fe.withoutSpaces(strings.TrimSpace(name))
+	}
+	return name
+}
+
+// spaceRuns matches the runs of whitespace --replace-spaces replaces.
+var spaceRuns = regexp.MustCompile(`\s+`)
+
+// withoutSpaces replaces each run of spaces in name with --replace-spaces,
+// if it's set.
+func (fe *FlickrExporter) withoutSpaces(name string) string {
+	if fe.replaceSpaces == "" {
+		return name
+	}
+	return spaceRuns.ReplaceAllLiteralString(name, fe.replaceSpaces)
+}
+
+// validateNamePart checks a --path-separator or --replace-spaces value,
+// which is put in folder and file names as given.
+func validateNamePart(what, value string) error {
+	if sanitizeFilename(value) != value || strings.IndexFunc(value, unicode.IsControl) >= 0 {
+		return fmt.Errorf("invalid %s %q: it can't contain path separators or characters that are invalid in filenames", what, value)
+	}
+	return nil
+}
+
+// minMaxFolderNameLength is the shortest --max-folder-name-length allowed:
+// enough for the date prefix, a hash suffix, and a few characters of title.
+const minMaxFolderNameLength = 32
+
+func validateMaxFolderNameLength(n int) error {
+	if n != 0 && n < minMaxFolderNameLength {
+		return fmt.Errorf("max folder name length must be 0 (no limit) or at least %d", minMaxFolderNameLength)
+	}
+	return nil
+}
+
+// maxTitleFilenameLength is the length in bytes photo titles are cut to when
+// photos are named after them. Most filesystems limit names to 255 bytes, and
+// this leaves room for the extension, a size suffix like "_large2048", and
+// the photo ID added to tell apart photos with the same title.
+const maxTitleFilenameLength = 200
+
+// truncateName shortens name to at most max bytes, if it's longer, keeping
+// its beginning and appending a short hash of the full name so that names
+// which only differ after the cut stay distinct. A max of 0 means no limit.
+func truncateName(name string, max int) string {
+	if max == 0 || len(name) <= max {
+		return name
+	}
+
+	sum := sha1.Sum([]byte(name))
+	suffix := "~" + hex.EncodeToString(sum[:3])
+
+	cut := max - len(suffix)
+	for cut > 0 && !utf8.RuneStart(name[cut]) {
+		cut--
+	}
+	return strings.TrimRight(name[:cut], ". ") + suffix
+}
+
+// portableFilename makes name safe to use on any common filesystem: it is
+// transliterated to ASCII, dropping characters (like emoji) that have no
+// ASCII equivalent; trailing dots and spaces, which Windows strips, are
+// removed; and names reserved by Windows are suffixed with an underscore.
+func portableFilename(name string) string {
+	name = asciiReplacements.Replace(norm.NFKD.String(name))
+
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Combining marks left by decomposing accented letters
+		case r < 0x20 || r == 0x7f:
+			// Control characters
+		case r <= unicode.MaxASCII:
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteRune(' ')
+		}
+	}
+
+	name = strings.Join(strings.Fields(b.String()), " ")
+	name = strings.TrimRight(name, ". ")
+	if name == "" {
+		name = "_"
+	}
+
+	base, ext, hasExt := strings.Cut(name, ".")
+	if windowsReservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		name = base + "_"
+		if hasExt {
+			name += "." + ext
+		}
+	}
+
+	return name
+}
+
+// photoFilename returns the name to save a photo under, given the last
+// segment of the URL it's downloaded from. Flickr doesn't keep the names of
+// uploaded files, but it titles photos uploaded without one after the file,
+// so if original filenames are preferred, the photo's title is used with the
+// URL's extension, cut short if it's too long to be a filename. The name is
+// then adjusted for the selected size.
+func (fe *FlickrExporter) photoFilename(urlName, title string) string {
+	name := urlName
+	if fe.originalFilenames {
+		ext := filepath.Ext(urlName)
+		base := fe.withoutSpaces(strings.TrimSpace(sanitizeFilename(title)))
+		if strings.EqualFold(filepath.Ext(base), ext) {
+			base = strings.TrimSuffix(base, filepath.Ext(base))
+		}
+		base = truncateName(base, maxTitleFilenameLength)
+		if strings.Trim(base, ". ") != "" {
+			name = base + ext
+		}
+	}
+	return fe.sizedFilename(name)
+}
+
+// uniqueFilenames gives photos in the same folder whose filenames differ only
+// in case, as titles often do, distinct names by adding the photo ID to all
+// but the first.
+func uniqueFilenames(photos []Photo) {
+	seen := make(map[string]bool, len(photos))
+	for i, photo := range photos {
+		key := strings.ToLower(photo.Filename)
+		if seen[key] {
+			ext := filepath.Ext(photo.Filename)
+			photos[i].Filename = fmt.Sprintf("%s_%s%s", strings.TrimSuffix(photo.Filename, ext), photo.ID, ext)
+			key = strings.ToLower(photos[i].Filename)
+		}
+		seen[key] = true
+	}
+}
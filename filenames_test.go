@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestTruncateName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		max  int
+		want string
+	}{
+		{"fits", "Summer 2019", 32, "Summer 2019"},
+		{"exactly fits", "Summer 2019", 11, "Summer 2019"},
+		{"no limit", strings.Repeat("a", 300), 0, strings.Repeat("a", 300)},
+		{"too long", "abcdefghijklmnopqrstuvwxyz", 16, "abcdefghi~" + nameHash("abcdefghijklmnopqrstuvwxyz")},
+		{"trailing dots and spaces dropped", "abcdefg. . hijklmnop", 16, "abcdefg~" + nameHash("abcdefg. . hijklmnop")},
+		// "é" is two bytes; cutting at 9 bytes would split the fifth.
+		{"multibyte cut point", "ééééééééé", 16, "éééé~" + nameHash("ééééééééé")},
+		// "日" is three bytes; 9 bytes is three of them exactly.
+		{"multibyte at the cut point", "日本語の写真です", 16, "日本語~" + nameHash("日本語の写真です")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateName(tt.in, tt.max)
+			if got != tt.want {
+				t.Errorf("truncateName(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+			}
+			if tt.max > 0 && len(got) > tt.max {
+				t.Errorf("truncateName(%q, %d) is %d bytes", tt.in, tt.max, len(got))
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("truncateName(%q, %d) = %q, which isn't valid UTF-8", tt.in, tt.max, got)
+			}
+		})
+	}
+}
+
+// nameHash returns the short hash of name truncateName appends.
+func nameHash(name string) string {
+	sum := sha1.Sum([]byte(name))
+	return hex.EncodeToString(sum[:3])
+}
+
+func TestTruncateNameKeepsNamesDistinct(t *testing.T) {
+	// Names that only differ after the cut
+	prefix := strings.Repeat("Holiday photos from the trip ", 4)
+	a := truncateName(prefix+"to Paris", 64)
+	b := truncateName(prefix+"to Rome", 64)
+	if a == b {
+		t.Errorf("both truncated to %q", a)
+	}
+	if !strings.HasPrefix(a, prefix[:32]) || !strings.HasPrefix(b, prefix[:32]) {
+		t.Errorf("truncated to %q and %q, which don't keep the start of the names", a, b)
+	}
+	// The same name is always truncated the same way, so an album keeps
+	// its folder from one export to the next.
+	if again := truncateName(prefix+"to Paris", 64); again != a {
+		t.Errorf("truncated to %q, then %q", a, again)
+	}
+}
+
+func TestAlbumDirTruncatedKeepsDate(t *testing.T) {
+	fe := &FlickrExporter{
+		dateFormat:          defaultDateFormat,
+		pathSeparator:       " ",
+		maxFolderNameLength: minMaxFolderNameLength,
+	}
+	album := Album{
+		ID:          "72157600000000001",
+		Title:       strings.Repeat("Ünïcödé album títle ", 5),
+		DateCreated: time.Date(2019, 7, 4, 12, 0, 0, 0, time.UTC),
+	}
+
+	dir := fe.albumDir(album)
+	if len(dir) > minMaxFolderNameLength {
+		t.Errorf("albumDir = %q, which is %d bytes, more than %d", dir, len(dir), minMaxFolderNameLength)
+	}
+	if prefix := album.DateCreated.Format(defaultDateFormat) + " Ünïcödé"; !strings.HasPrefix(dir, prefix) {
+		t.Errorf("albumDir = %q, want it to start with %q", dir, prefix)
+	}
+	if !utf8.ValidString(dir) {
+		t.Errorf("albumDir = %q, which isn't valid UTF-8", dir)
+	}
+}
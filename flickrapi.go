@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+
+	"gopkg.in/masci/flickr.v3"
+)
+
+// FlickrAPI calls Flickr API methods. The exporter makes all of its API
+// calls through it, so tests can substitute a fake that serves canned
+// responses without network access.
+type FlickrAPI interface {
+	// Get calls method with args, and decodes Flickr's response into
+	// response. The call is signed with the user's OAuth token if
+	// authenticate is set, and with just the API key otherwise. If Flickr
+	// responds with an error, it returns a *FlickrAPIError.
+	Get(method string, args url.Values, authenticate bool, response flickr.FlickrResponse) error
+}
+
+// flickrClient is the FlickrAPI that calls Flickr, using the flickr
+// package. Each call uses its own flickr.FlickrClient, so it's safe for
+// concurrent use.
+type flickrClient struct {
+	apiKey           string
+	apiSecret        string
+	oauthToken       string
+	oauthTokenSecret string
+	httpClient       *http.Client
+}
+
+func (c *flickrClient) Get(method string, args url.Values, authenticate bool, response flickr.FlickrResponse) error {
+	client := flickr.NewFlickrClient(c.apiKey, c.apiSecret)
+	client.HTTPClient = c.httpClient
+	client.OAuthToken = c.oauthToken
+	client.OAuthTokenSecret = c.oauthTokenSecret
+
+	client.Init()
+	for key, values := range args {
+		client.Args[key] = append([]string(nil), values...)
+	}
+	client.Args.Set("method", method)
+	if authenticate {
+		client.OAuthSign()
+	} else {
+		client.ApiSign()
+	}
+	return apiError(response, flickr.DoGet(client, response))
+}
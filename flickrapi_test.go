@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/masci/flickr.v3"
+)
+
+// fakeFlickrAPI is a FlickrAPI that serves canned XML responses, by method,
+// and records the calls made to it.
+type fakeFlickrAPI struct {
+	mu sync.Mutex
+	// responses returns the body of Flickr's response to a call of each
+	// method, given its args. Calls to other methods fail.
+	responses map[string]func(args url.Values) string
+	calls     []fakeCall
+}
+
+type fakeCall struct {
+	method string
+	args   url.Values
+}
+
+func (f *fakeFlickrAPI) Get(method string, args url.Values, authenticate bool, response flickr.FlickrResponse) error {
+	f.mu.Lock()
+	f.calls = append(f.calls, fakeCall{method, args})
+	respond := f.responses[method]
+	f.mu.Unlock()
+
+	if respond == nil {
+		return fmt.Errorf("unexpected call to %s", method)
+	}
+	if err := xml.Unmarshal([]byte(respond(args)), response); err != nil {
+		return err
+	}
+	if response.HasErrors() {
+		return apiError(response, errors.New(response.ErrorMsg()))
+	}
+	return nil
+}
+
+// callsTo returns the args of each call made to method, in order.
+func (f *fakeFlickrAPI) callsTo(method string) []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []url.Values
+	for _, call := range f.calls {
+		if call.method == method {
+			calls = append(calls, call.args)
+		}
+	}
+	return calls
+}
+
+// newTestExporter returns an exporter that makes its API calls to api and
+// writes to a temporary directory, without metadata or output.
+func newTestExporter(t *testing.T, api FlickrAPI, opts ExporterOptions) *FlickrExporter {
+	t.Helper()
+	opts.FlickrAPI = api
+	if opts.OutputDir == "" {
+		opts.OutputDir = t.TempDir()
+	}
+	opts.Concurrency = max(opts.Concurrency, 1)
+	opts.NoMetadata = true
+	opts.Quiet = true
+	fe, err := NewFlickrExporter("key", "secret", "", "", opts)
+	if err != nil {
+		t.Fatalf("NewFlickrExporter: %v", err)
+	}
+	return fe
+}
+
+// albumPhotosPage returns a flickr.photosets.getPhotos response for a page
+// of an album of total photos, numbered from 1, listed perPage at a time.
+func albumPhotosPage(args url.Values, total, perPage int) string {
+	page := 1
+	fmt.Sscan(args.Get("page"), &page)
+	pages := (total + perPage - 1) / perPage
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<rsp stat="ok"><photoset id="%s" owner="12345@N00" page="%d" pages="%d" perpage="%d" total="%d">`,
+		args.Get("photoset_id"), page, pages, perPage, total)
+	for n := (page-1)*perPage + 1; n <= min(page*perPage, total); n++ {
+		fmt.Fprintf(&b, `<photo id="%d" title="Photo %d" ispublic="1" url_o="https://live.staticflickr.com/1/%d_abc_o.jpg" />`, n, n, n)
+	}
+	b.WriteString(`</photoset></rsp>`)
+	return b.String()
+}
+
+func TestListAlbumPhotosPages(t *testing.T) {
+	api := &fakeFlickrAPI{responses: map[string]func(url.Values) string{
+		"flickr.photosets.getPhotos": func(args url.Values) string {
+			return albumPhotosPage(args, 5, 2)
+		},
+	}}
+	fe := newTestExporter(t, api, ExporterOptions{})
+
+	var pages [][]string
+	err := fe.listAlbumPhotos("72157600000000001", func(photos []Photo) {
+		var ids []string
+		for _, photo := range photos {
+			ids = append(ids, photo.ID)
+		}
+		pages = append(pages, ids)
+	})
+	if err != nil {
+		t.Fatalf("listAlbumPhotos: %v", err)
+	}
+
+	want := [][]string{{"1", "2"}, {"3", "4"}, {"5"}}
+	if fmt.Sprint(pages) != fmt.Sprint(want) {
+		t.Errorf("listed pages %v, want %v", pages, want)
+	}
+	calls := api.callsTo("flickr.photosets.getPhotos")
+	if len(calls) != 3 {
+		t.Fatalf("listed %d pages, want 3", len(calls))
+	}
+	for i, args := range calls {
+		if got, want := args.Get("page"), fmt.Sprint(i+1); got != want {
+			t.Errorf("call %d asked for page %s, want %s", i+1, got, want)
+		}
+		if got := args.Get("photoset_id"); got != "72157600000000001" {
+			t.Errorf("call %d asked for album %q", i+1, got)
+		}
+	}
+}
+
+func TestGetAlbumPhotosPageRange(t *testing.T) {
+	api := &fakeFlickrAPI{responses: map[string]func(url.Values) string{
+		"flickr.photosets.getPhotos": func(args url.Values) string {
+			return albumPhotosPage(args, 10, 2)
+		},
+	}}
+	fe := newTestExporter(t, api, ExporterOptions{FromPage: 2, ToPage: 3})
+
+	photos, err := fe.getAlbumPhotos("72157600000000001")
+	if err != nil {
+		t.Fatalf("getAlbumPhotos: %v", err)
+	}
+	var ids, positions []string
+	for _, photo := range photos {
+		ids = append(ids, photo.ID)
+		positions = append(positions, fmt.Sprint(photo.Position))
+	}
+	if got, want := strings.Join(ids, ","), "3,4,5,6"; got != want {
+		t.Errorf("got photos %s, want %s", got, want)
+	}
+	// Positions are in the whole album, not the pages listed.
+	if got, want := strings.Join(positions, ","), "3,4,5,6"; got != want {
+		t.Errorf("got positions %s, want %s", got, want)
+	}
+	if n := len(api.callsTo("flickr.photosets.getPhotos")); n != 2 {
+		t.Errorf("listed %d pages, want 2", n)
+	}
+}
+
+func TestListAllAlbumsPages(t *testing.T) {
+	api := &fakeFlickrAPI{responses: map[string]func(url.Values) string{
+		"flickr.photosets.getList": func(args url.Values) string {
+			if args.Get("page") == "1" {
+				return `<rsp stat="ok"><photosets page="1" pages="2" perpage="2" total="3">
+					<photoset id="1" photos="4" videos="1" date_create="1500000000"><title>Beach</title></photoset>
+					<photoset id="2" photos="2"><title>Mountains</title></photoset>
+				</photosets></rsp>`
+			}
+			return `<rsp stat="ok"><photosets page="2" pages="2" perpage="2" total="3">
+				<photoset id="3" photos="1"><title>City</title></photoset>
+			</photosets></rsp>`
+		},
+	}}
+	fe := newTestExporter(t, api, ExporterOptions{})
+
+	var titles []string
+	var first Album
+	err := fe.listAllAlbums(func(albums []Album) {
+		for _, album := range albums {
+			if album.ID == "1" {
+				first = album
+			}
+			titles = append(titles, album.Title)
+		}
+	})
+	if err != nil {
+		t.Fatalf("listAllAlbums: %v", err)
+	}
+	if got, want := strings.Join(titles, ","), "Beach,Mountains,City"; got != want {
+		t.Errorf("listed albums %s, want %s", got, want)
+	}
+	if first.PhotoCount != 5 {
+		t.Errorf("album 1 has %d photos, want 5 including its video", first.PhotoCount)
+	}
+	if got := first.DateCreated.Unix(); got != 1500000000 {
+		t.Errorf("album 1 created at %d, want 1500000000", got)
+	}
+}
+
+func TestListAlbumPhotosRetriesUnavailable(t *testing.T) {
+	var mu sync.Mutex
+	failures := 2
+	api := &fakeFlickrAPI{responses: map[string]func(url.Values) string{
+		"flickr.photosets.getPhotos": func(args url.Values) string {
+			mu.Lock()
+			defer mu.Unlock()
+			if failures > 0 {
+				failures--
+				return `<rsp stat="fail"><err code="105" msg="Service currently unavailable" /></rsp>`
+			}
+			return albumPhotosPage(args, 1, 2)
+		},
+	}}
+	fe := newTestExporter(t, api, ExporterOptions{MaxRetries: 3})
+
+	photos, err := fe.getAlbumPhotos("72157600000000001")
+	if err != nil {
+		t.Fatalf("getAlbumPhotos: %v", err)
+	}
+	if len(photos) != 1 {
+		t.Errorf("got %d photos, want 1", len(photos))
+	}
+	if n := len(api.callsTo("flickr.photosets.getPhotos")); n != 3 {
+		t.Errorf("made %d calls, want 3", n)
+	}
+}
+
+func TestListAlbumPhotosNotFound(t *testing.T) {
+	api := &fakeFlickrAPI{responses: map[string]func(url.Values) string{
+		"flickr.photosets.getPhotos": func(url.Values) string {
+			return `<rsp stat="fail"><err code="1" msg="Photoset not found" /></rsp>`
+		},
+	}}
+	fe := newTestExporter(t, api, ExporterOptions{MaxRetries: 3})
+
+	_, err := fe.getAlbumPhotos("72157600000000001")
+	var apiErr *FlickrAPIError
+	if !errors.As(err, &apiErr) || apiErr.Code != 1 {
+		t.Fatalf("got error %v, want Flickr error 1", err)
+	}
+	if n := len(api.callsTo("flickr.photosets.getPhotos")); n != 1 {
+		t.Errorf("made %d calls, want 1 since the error isn't retryable", n)
+	}
+}
+
+func TestGetCollectionAlbums(t *testing.T) {
+	api := &fakeFlickrAPI{responses: map[string]func(url.Values) string{
+		"flickr.collections.getTree": func(url.Values) string {
+			return `<rsp stat="ok"><collections>
+				<collection id="1-100" title="Travel">
+					<set id="10" title="Paris" date_create="1400000000" />
+					<set id="11" title="Rome" date_create="1400000000" />
+				</collection>
+			</collections></rsp>`
+		},
+		"flickr.photosets.getInfo": func(args url.Values) string {
+			if args.Get("photoset_id") == "11" {
+				return `<rsp stat="fail"><err code="1" msg="Photoset not found" /></rsp>`
+			}
+			return `<rsp stat="ok"><photoset id="10" photos="7" date_create="1500000000"><title>Paris 2017</title></photoset></rsp>`
+		},
+	}}
+	fe := newTestExporter(t, api, ExporterOptions{})
+
+	albums, name, err := fe.getCollectionAlbums("1-100")
+	if err != nil {
+		t.Fatalf("getCollectionAlbums: %v", err)
+	}
+	if name != "Travel" {
+		t.Errorf("collection named %q, want Travel", name)
+	}
+	if len(albums) != 2 {
+		t.Fatalf("got %d albums, want 2", len(albums))
+	}
+
+	// The album's own info is used where it can be fetched...
+	if got := albums[0]; got.Title != "Paris 2017" || got.PhotoCount != 7 || got.DateCreated.Unix() != 1500000000 {
+		t.Errorf("album 10 is %q with %d photos created at %d, want its own info", got.Title, got.PhotoCount, got.DateCreated.Unix())
+	}
+	// ...and the collection's otherwise.
+	if got := albums[1]; got.ID != "11" || got.Title != "Rome" || got.DateCreated.Unix() != 1400000000 {
+		t.Errorf("album 11 is %q created at %d, want the collection's info", got.Title, got.DateCreated.Unix())
+	}
+
+	calls := api.callsTo("flickr.collections.getTree")
+	if len(calls) != 1 || calls[0].Get("collection_id") != "1-100" {
+		t.Errorf("got collection tree calls %v, want one for 1-100", calls)
+	}
+}
+
+func TestGetCollectionAlbumsEmpty(t *testing.T) {
+	api := &fakeFlickrAPI{responses: map[string]func(url.Values) string{
+		"flickr.collections.getTree": func(url.Values) string {
+			return `<rsp stat="ok"><collections><collection id="1-100" title="Empty" /></collections></rsp>`
+		},
+	}}
+	fe := newTestExporter(t, api, ExporterOptions{})
+
+	if _, _, err := fe.getCollectionAlbums("1-100"); err == nil {
+		t.Error("getCollectionAlbums succeeded for a collection without albums")
+	}
+}
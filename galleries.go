@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/masci/flickr.v3"
+	"gopkg.in/masci/flickr.v3/test"
+)
+
+// Galleries are Flickr's curated sets of up to 500 photos, usually by other
+// users. They're exported like albums, into a folder per gallery.
+
+// galleryPhotoExtras requests the original and the larger fallback sizes, since
+// other users can prevent their originals from being downloaded.
+const galleryPhotoExtras = "url_o,url_k,url_h,url_l"
+
+// GalleriesResponse represents the response from flickr.galleries.getList
+type GalleriesResponse struct {
+	flickr.BasicResponse
+	Galleries struct {
+		Page    int           `xml:"page,attr"`
+		Pages   int           `xml:"pages,attr"`
+		Gallery []GalleryItem `xml:"gallery"`
+	} `xml:"galleries"`
+}
+
+// GalleryInfoResponse represents the response from flickr.galleries.getInfo
+type GalleryInfoResponse struct {
+	flickr.BasicResponse
+	Gallery GalleryItem `xml:"gallery"`
+}
+
+type GalleryItem struct {
+	ID          string `xml:"id,attr"`
+	DateCreate  int64  `xml:"date_create,attr"`
+	Title       string `xml:"title"`
+	Description string `xml:"description"`
+}
+
+// GalleryPhotosResponse represents the response from flickr.galleries.getPhotos
+type GalleryPhotosResponse struct {
+	flickr.BasicResponse
+	Photos struct {
+		Page  int                `xml:"page,attr"`
+		Pages int                `xml:"pages,attr"`
+		Photo []GalleryPhotoItem `xml:"photo"`
+	} `xml:"photos"`
+}
+
+type GalleryPhotoItem struct {
+	ID          string `xml:"id,attr"`
+	Title       string `xml:"title,attr"`
+	IsPublic    bool   `xml:"ispublic,attr"`
+	IsFriend    bool   `xml:"isfriend,attr"`
+	IsFamily    bool   `xml:"isfamily,attr"`
+	OriginalURL string `xml:"url_o,attr"`
+	WidthO      int    `xml:"width_o,attr"`
+	HeightO     int    `xml:"height_o,attr"`
+	URLK        string `xml:"url_k,attr"` // 2048 on longest side
+	URLH        string `xml:"url_h,attr"` // 1600 on longest side
+	URLL        string `xml:"url_l,attr"` // 1024 on longest side
+}
+
+func (fe *FlickrExporter) ExportGallery(galleryID string) error {
+	defer fe.Close()
+	defer fe.startPhotoWorkers()()
+
+	fe.logf("Exporting gallery %s...\n", galleryID)
+
+	gallery, err := fe.getGalleryInfo(galleryID)
+	if err != nil {
+		return fmt.Errorf("failed to get gallery info: %w", err)
+	}
+
+	err = fe.downloadGallery(gallery)
+	fe.finishExport()
+	return err
+}
+
+// ExportAllGalleries exports every gallery created by the authenticated user.
+func (fe *FlickrExporter) ExportAllGalleries() error {
+	defer fe.Close()
+	defer fe.startPhotoWorkers()()
+
+	galleries, err := fe.getAllGalleries()
+	if err != nil {
+		return fmt.Errorf("failed to get galleries: %w", err)
+	}
+
+	fe.logf("Found %d galleries\n", len(galleries))
+
+	var failed int
+	for _, gallery := range galleries {
+		if err := fe.downloadGallery(gallery); err != nil {
+			fe.warnf("Warning: Failed to download gallery %s: %v\n", gallery.Title, err)
+			failed++
+		}
+	}
+
+	fe.finishExport()
+
+	if failed > 0 {
+		return partialExportErrorf("failed to export %d of %d galleries", failed, len(galleries))
+	}
+	return nil
+}
+
+func (fe *FlickrExporter) downloadGallery(gallery Album) error {
+	fe.logf("Processing gallery: %s\n", gallery.Title)
+
+	photos, err := fe.getGalleryPhotos(gallery.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get gallery photos: %w", err)
+	}
+	gallery.Photos = photos
+
+	return fe.downloadAlbum(gallery)
+}
+
+func (fe *FlickrExporter) getAllGalleries() ([]Album, error) {
+	// flickr.galleries.getList doesn't accept "me", so look up our user ID
+	// when exporting our own galleries
+	userID := fe.userID
+	if fe.isCurrentUser() {
+		login := &test.LoginResponse{}
+		err := fe.withRetry("getting user ID", func() error {
+			login = &test.LoginResponse{}
+			return fe.api.Get("flickr.test.login", nil, true, login)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user ID: %w", err)
+		}
+		userID = login.User.ID
+	}
+
+	var galleries []Album
+	page := 1
+
+	for {
+		response := &GalleriesResponse{}
+		err := fe.withRetry(fmt.Sprintf("getting galleries page %d", page), func() error {
+			args := url.Values{}
+			args.Set("user_id", userID)
+			args.Set("page", fmt.Sprintf("%d", page))
+
+			response = &GalleriesResponse{}
+			return fe.api.Get("flickr.galleries.getList", args, true, response)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get galleries page %d: %w", page, err)
+		}
+
+		for _, item := range response.Galleries.Gallery {
+			galleries = append(galleries, parseGallery(item))
+		}
+
+		// Check if we've got all pages
+		if page >= response.Galleries.Pages {
+			break
+		}
+		page++
+
+		// Rate limiting between API calls
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return galleries, nil
+}
+
+func (fe *FlickrExporter) getGalleryInfo(galleryID string) (Album, error) {
+	response := &GalleryInfoResponse{}
+	err := fe.withRetry("getting gallery info for "+galleryID, func() error {
+		response = &GalleryInfoResponse{}
+		return fe.api.Get("flickr.galleries.getInfo", url.Values{"gallery_id": {galleryID}}, true, response)
+	})
+	if err != nil {
+		return Album{}, err
+	}
+
+	return parseGallery(response.Gallery), nil
+}
+
+func parseGallery(item GalleryItem) Album {
+	gallery := Album{
+		ID:          item.ID,
+		Title:       item.Title,
+		Description: item.Description,
+		DateCreated: time.Unix(0, 0),
+	}
+	if item.DateCreate > 0 {
+		gallery.DateCreated = time.Unix(item.DateCreate, 0)
+	}
+	return gallery
+}
+
+func (fe *FlickrExporter) getGalleryPhotos(galleryID string) ([]Photo, error) {
+	var photos []Photo
+	var position int
+	page := 1
+
+	for {
+		response := &GalleryPhotosResponse{}
+		err := fe.withRetry(fmt.Sprintf("getting photos page %d of gallery %s", page, galleryID), func() error {
+			args := url.Values{}
+			args.Set("gallery_id", galleryID)
+			args.Set("extras", galleryPhotoExtras)
+			args.Set("per_page", "500")
+			args.Set("page", fmt.Sprintf("%d", page))
+
+			response = &GalleryPhotosResponse{}
+			return fe.api.Get("flickr.galleries.getPhotos", args, true, response)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get photos page %d: %w", page, err)
+		}
+
+		for _, photoData := range response.Photos.Photo {
+			position++
+			photo, ok := fe.parseGalleryPhoto(photoData)
+			photo.Position = position
+			if ok && matchesPrivacy(photo.Visibility, fe.privacy) {
+				photos = append(photos, photo)
+			}
+		}
+
+		// Check if we've got all pages
+		if page >= response.Photos.Pages {
+			break
+		}
+		page++
+
+		// Rate limiting between API calls
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return photos, nil
+}
+
+// parseGalleryPhoto converts a photo in a gallery, which is usually someone
+// else's. If its owner doesn't allow the original to be downloaded, the
+// largest of the large sizes is used instead. If none of them is available
+// either, it returns false unless the largest available size is wanted.
+func (fe *FlickrExporter) parseGalleryPhoto(photoData GalleryPhotoItem) (Photo, bool) {
+	photo := Photo{
+		ID:    photoData.ID,
+		Title: photoData.Title,
+		Visibility: Visibility{
+			IsPublic: photoData.IsPublic,
+			IsFriend: photoData.IsFriend,
+			IsFamily: photoData.IsFamily,
+		},
+	}
+
+	for _, url := range []string{photoData.OriginalURL, photoData.URLK, photoData.URLH, photoData.URLL} {
+		if url != "" {
+			photo.OriginalURL = url
+			break
+		}
+	}
+
+	if photo.OriginalURL == "" {
+		// Smaller sizes than those listed may still be available
+		fe.noOriginalFilename(&photo, "")
+		return photo, fe.isDownloadable(&photo)
+	}
+	if photoData.OriginalURL != "" {
+		photo.Width = photoData.WidthO
+		photo.Height = photoData.HeightO
+	} else {
+		fe.noOriginal.add(photo.ID, true)
+		if fe.verbose {
+			fe.logf("  Original of %s (%s) is not available; using the largest available size\n", photo.ID, photo.Title)
+		}
+	}
+
+	// Extract filename from URL
+	parts := strings.Split(photo.OriginalURL, "/")
+	photo.Filename = fe.photoFilename(parts[len(parts)-1], photo.Title)
+
+	return photo, true
+}
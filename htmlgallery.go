@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const galleryFilename = "index.html"
+
+const galleryStyle = `
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { margin-bottom: 0.2em; }
+.meta { color: #666; }
+.description { white-space: pre-wrap; }
+.grid { display: grid; grid-template-columns: repeat(auto-fill, minmax(220px, 1fr)); gap: 1.5em; margin-top: 1.5em; }
+.grid figure { margin: 0; }
+.grid img { width: 100%; height: 220px; object-fit: cover; background: #eee; }
+.grid figcaption { font-size: 0.9em; margin-top: 0.4em; }
+ul.albums { list-style: none; padding: 0; }
+ul.albums li { margin: 0.4em 0; }
+`
+
+var albumGalleryTemplate = template.Must(template.New("album").Funcs(template.FuncMap{
+	"pathEscape": url.PathEscape,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Album.Title}}</title>
+<style>{{.Style}}</style>
+</head>
+<body>
+<p><a href="{{.IndexHref}}">&larr; All albums</a></p>
+<h1>{{.Album.Title}}</h1>
+{{- if not .Album.DateCreated.IsZero}}
+<p class="meta">{{.Album.DateCreated.Format "January 2, 2006"}}</p>
+{{- end}}
+{{- if .Album.Description}}
+<p class="description">{{.Album.Description}}</p>
+{{- end}}
+<div class="grid">
+{{- range .Photos}}
+<figure>
+<a href="{{pathEscape .Filename}}"><img src="{{pathEscape .Filename}}" alt="{{.Title}}" loading="lazy"></a>
+<figcaption>
+{{- if .Title}}<strong>{{.Title}}</strong><br>{{end}}
+{{- if not .DateTaken.IsZero}}<span class="meta">{{.DateTaken.Format "January 2, 2006"}}</span>{{end}}
+{{- if .Description}}<div class="description">{{.Description}}</div>{{end}}
+</figcaption>
+</figure>
+{{- end}}
+</div>
+</body>
+</html>
+`))
+
+var galleryIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Flickr Export</title>
+<style>{{.Style}}</style>
+</head>
+<body>
+<h1>Flickr Export</h1>
+<ul class="albums">
+{{- range .Albums}}
+<li><a href="{{.Href}}">{{.Name}}</a></li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+// galleryLink is an album in the gallery index: its folder relative to the
+// output directory, and the URL of its page relative to the index.
+type galleryLink struct {
+	Name string
+	Href string
+}
+
+// relativeHref returns the URL of path relative to dir, both local paths.
+func relativeHref(dir, path string) (string, error) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// writeAlbumGallery writes an HTML page to albumPath showing the album's
+// photos, linking back to the index in outputDir, which albumPath may be
+// nested any depth within. Photos whose files are missing from albumPath are
+// left out.
+func writeAlbumGallery(outputDir, albumPath string, album Album) error {
+	var photos []Photo
+	for _, photo := range album.Photos {
+		if _, err := os.Stat(filepath.Join(albumPath, photo.Filename)); err == nil {
+			photos = append(photos, photo)
+		}
+	}
+
+	indexHref, err := relativeHref(albumPath, filepath.Join(outputDir, galleryFilename))
+	if err != nil {
+		return fmt.Errorf("failed to link %s to the gallery index: %w", albumPath, err)
+	}
+
+	return writeTemplate(filepath.Join(albumPath, galleryFilename), albumGalleryTemplate, map[string]any{
+		"Album":     album,
+		"Photos":    photos,
+		"Style":     template.CSS(galleryStyle),
+		"IndexHref": indexHref,
+	})
+}
+
+// writeGalleryIndex writes an HTML page to outputDir linking to every album
+// directory that contains a gallery page, including albums exported by
+// previous runs and albums nested in collection folders by
+// --nest-collections or placed by --path-map.
+func writeGalleryIndex(outputDir string) error {
+	index := filepath.Join(outputDir, galleryFilename)
+
+	var albums []galleryLink
+	err := filepath.WalkDir(outputDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != outputDir && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Name() != galleryFilename || path == index {
+			return nil
+		}
+
+		albumPath := filepath.Dir(path)
+		name, err := filepath.Rel(outputDir, albumPath)
+		if err != nil {
+			return err
+		}
+		href, err := relativeHref(outputDir, path)
+		if err != nil {
+			return err
+		}
+		albums = append(albums, galleryLink{Name: filepath.ToSlash(name), Href: href})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read output directory: %w", err)
+	}
+	sort.Slice(albums, func(i, j int) bool { return albums[i].Name < albums[j].Name })
+
+	return writeTemplate(index, galleryIndexTemplate, map[string]any{
+		"Albums": albums,
+		"Style":  template.CSS(galleryStyle),
+	})
+}
+
+func writeTemplate(path string, tmpl *template.Template, data any) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if err := tmpl.Execute(file, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return nil
+}
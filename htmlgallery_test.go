@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGalleryIndexNestedAlbums(t *testing.T) {
+	outputDir := t.TempDir()
+	albums := map[string]string{
+		"2019-07-04 Paris":                           `href="../index.html"`,
+		filepath.Join("Travel", "Europe", "Rome #1"): `href="../../../index.html"`,
+	}
+	for dir, backLink := range albums {
+		albumPath := filepath.Join(outputDir, dir)
+		if err := os.MkdirAll(albumPath, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeAlbumGallery(outputDir, albumPath, Album{Title: filepath.Base(dir)}); err != nil {
+			t.Fatal(err)
+		}
+		page, err := os.ReadFile(filepath.Join(albumPath, galleryFilename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(page), backLink) {
+			t.Errorf("gallery page for %s doesn't link back with %s:\n%s", dir, backLink, page)
+		}
+	}
+	// Folders without a gallery page, and hidden ones, aren't albums.
+	if err := os.MkdirAll(filepath.Join(outputDir, "Travel", "Asia"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	hidden := filepath.Join(outputDir, ".flickr-exporter-tmp")
+	if err := os.MkdirAll(hidden, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(hidden, galleryFilename), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeGalleryIndex(outputDir); err != nil {
+		t.Fatal(err)
+	}
+	index, err := os.ReadFile(filepath.Join(outputDir, galleryFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []string{
+		`<a href="2019-07-04%20Paris/index.html">2019-07-04 Paris</a>`,
+		`<a href="Travel/Europe/Rome%20%231/index.html">Travel/Europe/Rome #1</a>`,
+	} {
+		if !strings.Contains(string(index), link) {
+			t.Errorf("gallery index doesn't contain %s:\n%s", link, index)
+		}
+	}
+	if got := strings.Count(string(index), "<li>"); got != len(albums) {
+		t.Errorf("gallery index lists %d albums, want %d:\n%s", got, len(albums), index)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// IPTC limits on the length of text fields, in bytes.
+const (
+	iptcObjectNameMax      = 64
+	iptcCaptionAbstractMax = 2000
+	iptcBylineMax          = 32
+	iptcCopyrightNoticeMax = 128
+)
+
+var extraBlankLines = regexp.MustCompile(`\n{3,}`)
+
+// htmlToText converts a Flickr title or description, which may contain HTML
+// such as links and <br> tags, to plain text for photo metadata. Tags are
+// removed, line and paragraph breaks become newlines, entities are
+// unescaped, and links are followed by their URL unless their text is part
+// of it. Newlines in the text are kept, since Flickr shows them as line
+// breaks.
+func htmlToText(s string) string {
+	if !strings.ContainsAny(s, "<&") {
+		return strings.TrimSpace(s)
+	}
+
+	var b strings.Builder
+	var href, linkText string
+	inLink := false
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		token := z.Token()
+		switch tt {
+		case html.TextToken:
+			b.WriteString(token.Data)
+			if inLink {
+				linkText += token.Data
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch token.Data {
+			case "br":
+				b.WriteString("\n")
+			case "p", "div", "blockquote":
+				b.WriteString("\n\n")
+			case "li":
+				b.WriteString("\n- ")
+			case "a":
+				href, linkText, inLink = "", "", tt == html.StartTagToken
+				for _, attr := range token.Attr {
+					if attr.Key == "href" {
+						href = attr.Val
+					}
+				}
+			}
+		case html.EndTagToken:
+			switch token.Data {
+			case "p", "div", "blockquote", "ul", "ol":
+				b.WriteString("\n\n")
+			case "a":
+				if inLink && href != "" && !strings.Contains(href, strings.TrimSpace(linkText)) {
+					b.WriteString(" (" + href + ")")
+				}
+				inLink = false
+			}
+		}
+	}
+
+	text := strings.ReplaceAll(b.String(), "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	text = extraBlankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
+
+// truncateIPTC shortens s to at most max bytes, without splitting a
+// character, ending it with an ellipsis if it's shortened. The full text is
+// written to XMP, which has no length limit.
+func truncateIPTC(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	const ellipsis = "…"
+	cut := max - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return strings.TrimRight(s[:cut], " \n") + ellipsis
+}
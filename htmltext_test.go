@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain text", "  Sunset over the bay \n", "Sunset over the bay"},
+		{"newlines kept", "First line\nSecond line", "First line\nSecond line"},
+		{"br", "First line<br>Second line<br/>Third line<br />", "First line\nSecond line\nThird line"},
+		{"paragraphs", "<p>One</p><p>Two</p>", "One\n\nTwo"},
+		{"blank lines collapsed", "One<br><br><br><br>Two", "One\n\nTwo"},
+		{"trailing spaces", "One   <br>Two", "One\nTwo"},
+		{"entities", "Fish &amp; chips &lt;3 &quot;yum&quot; caf&eacute; &#8212; &#x263A;", `Fish & chips <3 "yum" café — ☺`},
+		{"link stripped to text and URL", `Taken at <a href="https://example.com/park">the park</a>.`, "Taken at the park (https://example.com/park)."},
+		{"link with its URL as text", `See <a href="https://example.com/park" rel="nofollow">example.com/park</a>`, "See example.com/park"},
+		{"link without href", `<a name="top">Top</a>`, "Top"},
+		{"entity in link", `<a href="https://example.com/?a=1&amp;b=2">here</a>`, "here (https://example.com/?a=1&b=2)"},
+		{"nested tags", `<p><b>Bold <i>and italic</i></b> and <a href="https://example.com"><b>bold link</b></a></p>`, "Bold and italic and bold link (https://example.com)"},
+		{"list", "<ul><li>One</li><li>Two</li></ul>After", "- One\n- Two\n\nAfter"},
+		{"unknown tags removed", "<span class=\"x\">Hi</span><script></script>", "Hi"},
+		{"unclosed tag", "Before <b>after", "Before after"},
+		{"CRLF", "One\r\n<br>Two", "One\n\nTwo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := htmlToText(tt.in); got != tt.want {
+				t.Errorf("htmlToText(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateIPTC(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		max  int
+		want string
+	}{
+		{"fits", "Short", 64, "Short"},
+		{"exactly fits", "12345", 5, "12345"},
+		{"too long", "abcdefghij", 8, "abcde…"},
+		{"trailing space dropped", "abc   defghij", 9, "abc…"},
+		{"not splitting a character", "ééééé", 8, "éé…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateIPTC(tt.in, tt.max)
+			if got != tt.want {
+				t.Errorf("truncateIPTC(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+			}
+			if len(got) > tt.max || !utf8.ValidString(got) {
+				t.Errorf("truncateIPTC(%q, %d) = %q, which is too long or invalid UTF-8", tt.in, tt.max, got)
+			}
+		})
+	}
+
+	long := strings.Repeat("é", iptcObjectNameMax)
+	if got := truncateIPTC(long, iptcObjectNameMax); len(got) > iptcObjectNameMax {
+		t.Errorf("truncated to %d bytes, more than %d", len(got), iptcObjectNameMax)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFilename names the file in the output directory that's read as the
+// ignore file when --ignore-file isn't given.
+const ignoreFilename = ".flickrignore"
+
+// Prefixes of ignore file entries. Entries without a prefix are albums, as
+// with --exclude-album.
+const (
+	ignoreAlbumPrefix = "album:"
+	ignorePhotoPrefix = "photo:"
+)
+
+// ignoreList is the albums and photos listed in an ignore file, each as an
+// ID or a case-insensitive glob matched against titles.
+type ignoreList struct {
+	albums []string
+	photos []string
+}
+
+// loadIgnoreFile reads the ignore file at filename, e.g.:
+//
+//	# Screenshots and tests
+//	72157694563874100
+//	album:test*
+//	photo:53012345678
+//	photo:IMG_*
+//
+// Blank lines and lines starting with # are skipped. If required isn't set,
+// a missing file is an empty list.
+func loadIgnoreFile(filename string, required bool) (ignoreList, error) {
+	var list ignoreList
+	f, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return list, nil
+	}
+	if err != nil {
+		return list, fmt.Errorf("failed to read ignore file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entries := &list.albums
+		if rest, ok := strings.CutPrefix(line, ignorePhotoPrefix); ok {
+			line, entries = strings.TrimSpace(rest), &list.photos
+		} else if rest, ok := strings.CutPrefix(line, ignoreAlbumPrefix); ok {
+			line = strings.TrimSpace(rest)
+		}
+		if line == "" {
+			return list, fmt.Errorf("%s:%d: missing ID or title", filename, lineNum)
+		}
+		if _, err := path.Match(line, ""); err != nil {
+			return list, fmt.Errorf("%s:%d: invalid pattern %q: %w", filename, lineNum, line, err)
+		}
+		*entries = append(*entries, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return list, fmt.Errorf("failed to read ignore file: %w", err)
+	}
+	return list, nil
+}
+
+// ignoreFilePath returns the ignore file to read: --ignore-file if given,
+// which must exist, or else the one in outputDir, if any.
+func ignoreFilePath(flagValue, outputDir string) (filename string, required bool) {
+	if flagValue != "" {
+		return flagValue, true
+	}
+	return filepath.Join(outputDir, ignoreFilename), false
+}
+
+// ignoresPhoto reports whether photo is listed in the ignore file, by ID or
+// by title. Ignored photos are counted for the end-of-export report.
+func (fe *FlickrExporter) ignoresPhoto(photo Photo) bool {
+	if len(fe.ignoredPhotos) == 0 {
+		return false
+	}
+	title := strings.ToLower(photo.Title)
+	for _, pattern := range fe.ignoredPhotos {
+		matched := pattern == photo.ID
+		if !matched && title != "" {
+			matched, _ = path.Match(strings.ToLower(pattern), title)
+		}
+		if matched {
+			fe.ignoredPhotoCount.Add(1)
+			if fe.verbose {
+				fe.logf("  Skipping (in ignore file): %s\n", photo.Filename)
+			}
+			return true
+		}
+	}
+	return false
+}
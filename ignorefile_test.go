@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPruneKeepsIgnoredPhotos(t *testing.T) {
+	fe := newTestExporter(t, &fakeFlickrAPI{}, ExporterOptions{
+		TrackExportedFiles: true,
+		IgnoredPhotos:      []string{"2", "screenshot*"},
+	})
+	albumPath := filepath.Join(fe.outputDir, "2019-07-04 Beach")
+	if err := os.MkdirAll(albumPath, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Exported before the photos were added to the ignore file, along with
+	// a photo since removed from the album.
+	for _, name := range []string{"1.jpg", "2.jpg", "3.jpg", "removed.jpg"} {
+		if err := os.WriteFile(filepath.Join(albumPath, name), []byte("photo"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	album := Album{ID: "1", Title: "Beach", Photos: []Photo{
+		{ID: "1", Title: "Sunset", Filename: "1.jpg"},
+		{ID: "2", Title: "Sunrise", Filename: "2.jpg"},
+		{ID: "3", Title: "Screenshot 1", Filename: "3.jpg"},
+	}}
+	fe.exported.addDir(albumPath)
+	for i := range album.Photos {
+		if err := fe.downloadAlbumPhoto(album, i, albumPath); err != nil {
+			t.Fatalf("downloadAlbumPhoto(%s): %v", album.Photos[i].ID, err)
+		}
+	}
+	if got := fe.ignoredPhotoCount.Load(); got != 2 {
+		t.Errorf("ignored %d photos, want 2", got)
+	}
+
+	orphans, err := fe.OrphanedFiles()
+	if err != nil {
+		t.Fatalf("OrphanedFiles: %v", err)
+	}
+	if want := filepath.Join(albumPath, "removed.jpg"); len(orphans) != 1 || orphans[0] != want {
+		t.Errorf("orphaned files %v, want only %s", orphans, want)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+// License is a license that a Flickr photo can be published under.
+type License struct {
+	Name string
+	URL  string
+	// PublicDomain is set for licenses under which the photo has no known
+	// copyright, so no copyright notice is written for it.
+	PublicDomain bool
+}
+
+// flickrLicenses maps Flickr's license IDs, as returned by
+// flickr.photos.licenses.getInfo, to their licenses.
+var flickrLicenses = map[string]License{
+	"0":  {Name: "All Rights Reserved"},
+	"1":  {Name: "Attribution-NonCommercial-ShareAlike 2.0 (CC BY-NC-SA 2.0)", URL: "https://creativecommons.org/licenses/by-nc-sa/2.0/"},
+	"2":  {Name: "Attribution-NonCommercial 2.0 (CC BY-NC 2.0)", URL: "https://creativecommons.org/licenses/by-nc/2.0/"},
+	"3":  {Name: "Attribution-NonCommercial-NoDerivs 2.0 (CC BY-NC-ND 2.0)", URL: "https://creativecommons.org/licenses/by-nc-nd/2.0/"},
+	"4":  {Name: "Attribution 2.0 (CC BY 2.0)", URL: "https://creativecommons.org/licenses/by/2.0/"},
+	"5":  {Name: "Attribution-ShareAlike 2.0 (CC BY-SA 2.0)", URL: "https://creativecommons.org/licenses/by-sa/2.0/"},
+	"6":  {Name: "Attribution-NoDerivs 2.0 (CC BY-ND 2.0)", URL: "https://creativecommons.org/licenses/by-nd/2.0/"},
+	"7":  {Name: "No known copyright restrictions", URL: "https://www.flickr.com/commons/usage/", PublicDomain: true},
+	"8":  {Name: "United States Government Work", URL: "https://www.usa.gov/government-copyright", PublicDomain: true},
+	"9":  {Name: "Public Domain Dedication (CC0)", URL: "https://creativecommons.org/publicdomain/zero/1.0/", PublicDomain: true},
+	"10": {Name: "Public Domain Mark", URL: "https://creativecommons.org/publicdomain/mark/1.0/", PublicDomain: true},
+	"11": {Name: "Attribution 4.0 (CC BY 4.0)", URL: "https://creativecommons.org/licenses/by/4.0/"},
+	"12": {Name: "Attribution-ShareAlike 4.0 (CC BY-SA 4.0)", URL: "https://creativecommons.org/licenses/by-sa/4.0/"},
+	"13": {Name: "Attribution-NoDerivs 4.0 (CC BY-ND 4.0)", URL: "https://creativecommons.org/licenses/by-nd/4.0/"},
+	"14": {Name: "Attribution-NonCommercial 4.0 (CC BY-NC 4.0)", URL: "https://creativecommons.org/licenses/by-nc/4.0/"},
+	"15": {Name: "Attribution-NonCommercial-ShareAlike 4.0 (CC BY-NC-SA 4.0)", URL: "https://creativecommons.org/licenses/by-nc-sa/4.0/"},
+	"16": {Name: "Attribution-NonCommercial-NoDerivs 4.0 (CC BY-NC-ND 4.0)", URL: "https://creativecommons.org/licenses/by-nc-nd/4.0/"},
+}
+
+// lookupLicense returns the license with the given Flickr license ID, and
+// whether the ID is known.
+func lookupLicense(id string) (License, bool) {
+	license, ok := flickrLicenses[id]
+	return license, ok
+}
+
+// UsageTerms returns a human-readable statement of the license terms.
+func (l License) UsageTerms() string {
+	if l.URL == "" {
+		return l.Name
+	}
+	return l.Name + ": " + l.URL
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLookupLicense(t *testing.T) {
+	tests := []struct {
+		id           string
+		wantName     string
+		wantURL      string
+		publicDomain bool
+	}{
+		{"0", "All Rights Reserved", "", false},
+		{"1", "Attribution-NonCommercial-ShareAlike 2.0 (CC BY-NC-SA 2.0)", "https://creativecommons.org/licenses/by-nc-sa/2.0/", false},
+		{"4", "Attribution 2.0 (CC BY 2.0)", "https://creativecommons.org/licenses/by/2.0/", false},
+		{"7", "No known copyright restrictions", "https://www.flickr.com/commons/usage/", true},
+		{"8", "United States Government Work", "https://www.usa.gov/government-copyright", true},
+		{"9", "Public Domain Dedication (CC0)", "https://creativecommons.org/publicdomain/zero/1.0/", true},
+		{"10", "Public Domain Mark", "https://creativecommons.org/publicdomain/mark/1.0/", true},
+		{"11", "Attribution 4.0 (CC BY 4.0)", "https://creativecommons.org/licenses/by/4.0/", false},
+		{"16", "Attribution-NonCommercial-NoDerivs 4.0 (CC BY-NC-ND 4.0)", "https://creativecommons.org/licenses/by-nc-nd/4.0/", false},
+	}
+	for _, tt := range tests {
+		license, ok := lookupLicense(tt.id)
+		if !ok {
+			t.Errorf("license %s is unknown", tt.id)
+			continue
+		}
+		if license.Name != tt.wantName || license.URL != tt.wantURL || license.PublicDomain != tt.publicDomain {
+			t.Errorf("license %s = %+v, want %q, %q, public domain %v", tt.id, license, tt.wantName, tt.wantURL, tt.publicDomain)
+		}
+	}
+
+	for _, id := range []string{"", "17", "-1", "abc"} {
+		if license, ok := lookupLicense(id); ok || license != (License{}) {
+			t.Errorf("lookupLicense(%q) = %+v, %v, want no license", id, license, ok)
+		}
+	}
+}
+
+func TestFlickrLicenses(t *testing.T) {
+	// Flickr's licenses are numbered from 0 to 16, with none missing.
+	if len(flickrLicenses) != 17 {
+		t.Errorf("%d licenses, want 17", len(flickrLicenses))
+	}
+	for i := 0; i < len(flickrLicenses); i++ {
+		license, ok := flickrLicenses[strconv.Itoa(i)]
+		if !ok {
+			t.Errorf("license %d is missing", i)
+			continue
+		}
+		if license.Name == "" {
+			t.Errorf("license %d has no name", i)
+		}
+		// Each Creative Commons license links to its deed, matching its
+		// name, e.g. "(CC BY-NC 2.0)" and /licenses/by-nc/2.0/.
+		if _, short, ok := strings.Cut(license.Name, "(CC "); ok && short != "0)" {
+			short = strings.TrimSuffix(short, ")")
+			kind, version, _ := strings.Cut(short, " ")
+			want := "https://creativecommons.org/licenses/" + strings.ToLower(kind) + "/" + version + "/"
+			if license.URL != want {
+				t.Errorf("license %d (%s) links to %s, want %s", i, license.Name, license.URL, want)
+			}
+			if license.PublicDomain {
+				t.Errorf("license %d (%s) is marked public domain", i, license.Name)
+			}
+		}
+	}
+}
+
+func TestUsageTerms(t *testing.T) {
+	if got, want := flickrLicenses["0"].UsageTerms(), "All Rights Reserved"; got != want {
+		t.Errorf("UsageTerms = %q, want %q", got, want)
+	}
+	if got, want := flickrLicenses["4"].UsageTerms(), "Attribution 2.0 (CC BY 2.0): https://creativecommons.org/licenses/by/2.0/"; got != want {
+		t.Errorf("UsageTerms = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// runLogTimeFormat is the timestamp at the start of each line of the run log.
+const runLogTimeFormat = "2006-01-02 15:04:05.000"
+
+// runLog copies the messages an export prints to a log file, with each line
+// timestamped, for reviewing unattended runs. Messages that --quiet or
+// --progress keep off the console are written to it too. It is safe for
+// concurrent use, and a nil *runLog writes nothing.
+type runLog struct {
+	mu sync.Mutex
+	w  io.Writer
+	// midLine is set if the last message written didn't end its line, so
+	// the next shouldn't be timestamped.
+	midLine bool
+}
+
+// newRunLog returns a run log writing to w, or nil if w is nil. If w is
+// already a *runLog, it's returned as is, so that messages from the exporter
+// and from main share its timestamps.
+func newRunLog(w io.Writer) *runLog {
+	if w == nil {
+		return nil
+	}
+	if l, ok := w.(*runLog); ok {
+		return l
+	}
+	return &runLog{w: w}
+}
+
+// Write writes p to the log, timestamping the start of each line.
+func (l *runLog) Write(p []byte) (int, error) {
+	if l == nil {
+		return len(p), nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var buf bytes.Buffer
+	stamp := time.Now().Format(runLogTimeFormat) + " "
+	for rest := p; len(rest) > 0; {
+		if !l.midLine {
+			buf.WriteString(stamp)
+		}
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line = rest[:i+1]
+		}
+		buf.Write(line)
+		rest = rest[len(line):]
+		l.midLine = line[len(line)-1] != '\n'
+	}
+	if _, err := l.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (l *runLog) printf(format string, args ...any) {
+	if l == nil {
+		return
+	}
+	fmt.Fprintf(l, format, args...)
+}
+
+// The run log for --log-file, which main's messages are written to as well
+// as the exporter's.
+var runLogger *runLog
+
+// openRunLog opens path for --log-file, appending to it unless truncate is
+// set.
+func openRunLog(path string, truncate bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if truncate {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	runLogger = newRunLog(f)
+	runLogger.printf("flickr-exporter %s started\n", version)
+	return nil
+}
+
+// errorf prints an error message to stderr, and to the run log.
+func errorf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format, args...)
+	runLogger.printf(format, args...)
+}
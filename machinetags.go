@@ -0,0 +1,17 @@
+package main
+
+import "regexp"
+
+// Machine tags are Flickr tags of the form namespace:predicate=value, such as
+// geo:locality=paris or upcoming:event=123, that hold structured data rather
+// than describing the photo. They're written to XMP-flickr:MachineTags
+// instead of being mixed in with the photo's keywords.
+
+// machineTagPattern matches a machine tag. Namespaces and predicates start
+// with a letter and contain only letters, digits, and underscores.
+var machineTagPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*:[A-Za-z][A-Za-z0-9_]*=.`)
+
+// isMachineTag reports whether tag is a machine tag.
+func isMachineTag(tag string) bool {
+	return machineTagPattern.MatchString(tag)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsMachineTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want bool
+	}{
+		{"geo:locality=paris", true},
+		{"upcoming:event=123", true},
+		{"dc:title=Sunset over the bay", true},
+		{"exif:focal_length=35mm", true},
+		{"ns2:pred_1=x", true},
+		{"a:b=c=d", true},
+		{"a:b=", false}, // no value
+		{"=x", false},
+		{":b=x", false},         // no namespace
+		{"a:=x", false},         // no predicate
+		{"a=b", false},          // "=" but no namespace
+		{"a=b:c", false},        // ":" after "="
+		{"geo:locality", false}, // no value
+		{"1a:b=c", false},       // namespace starts with a digit
+		{"a:1b=c", false},       // predicate starts with a digit
+		{"a-b:c=d", false},
+		{"a:b:c=d", false},
+		{"sunset", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isMachineTag(tt.tag); got != tt.want {
+			t.Errorf("isMachineTag(%q) = %v, want %v", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestListedMachineTagsKeptOutOfKeywords(t *testing.T) {
+	fe := &FlickrExporter{listedTags: true}
+	var photo Photo
+	fe.setListedInfo(&photo, listedInfo{
+		DateUpload:  1500000000,
+		Tags:        "sunset geo:locality=paris a:b= =x a=b",
+		MachineTags: "geo:locality=paris",
+	}, "12345@N00")
+
+	if got, want := strings.Join(photo.MachineTags, " "), "geo:locality=paris"; got != want {
+		t.Errorf("got machine tags %q, want %q", got, want)
+	}
+	// Tags that only look like machine tags are kept as keywords.
+	if got, want := strings.Join(photo.Tags, " "), "sunset a:b= =x a=b"; got != want {
+		t.Errorf("got tags %q, want %q", got, want)
+	}
+}
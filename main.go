@@ -1,16 +1,22 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 	"gopkg.in/masci/flickr.v3"
 	"gopkg.in/yaml.v3"
 )
 
-var version = "<dev>"
-
 var (
 	apiKey           string
 	apiSecret        string
@@ -19,7 +25,84 @@ var (
 	oauthTokenSecret string
 	credsFile        string
 	credsFileSave    string
+	credsCommand     string
+	encryptCreds     bool
+	verifier         string
+	requestToken     string
+	authCheck        bool
+	metadataOnly     bool
 	verbose          bool
+	htmlGallery      bool
+	catalogFormats   []string
+	zipAlbums        bool
+	zipRemove        bool
+	writeUploadDate  bool
+	preferEXIFDate   bool
+	includeNotes     bool
+	includeStats     bool
+	albumKeywords    bool
+	dedupHardlink    bool
+	concurrency      string
+	includeAlbums    []string
+	excludeAlbums    []string
+	privacy          string
+	includePrivate   bool
+	excludePrivate   bool
+	safetyLevel      string
+	noMetadata       bool
+	requireMetadata  bool
+	metadataSchema   string
+	photoSize        string
+	verifyDimensions bool
+	preferOrigName   bool
+	overwrite        bool
+	largestAvail     bool
+	checkSpace       bool
+	asciiFilenames   bool
+	lowercaseNames   bool
+	maxFolderNameLen int
+	pathMapFile      string
+	ignoreFile       string
+	nestCollections  bool
+	fromPage         int
+	toPage           int
+	quiet            bool
+	showProgress     bool
+	outputFormat     string
+	jsonResult       bool
+	httpTimeout      time.Duration
+	proxyURL         string
+	maxRetries       int
+	retryBackoff     time.Duration
+	since            string
+	onlyUnorganized  bool
+	noUnorganized    bool
+	prune            bool
+	pruneDelete      bool
+	assumeYes        bool
+	maxPhotos        int
+	tagPrefix        string
+	copyright        string
+	dateFormat       string
+	pathSeparator    string
+	replaceSpaces    string
+	albumDateSource  string
+	relistAlbums     bool
+	unorganizedDir   string
+	userID           string
+	keepMetaErrors   bool
+	listedTags       bool
+	logFile          string
+	logTruncate      bool
+	reportDups       bool
+	searchText       string
+	searchTags       []string
+	searchTagMode    string
+	searchMachTags   []string
+	minTakenDate     string
+	maxTakenDate     string
+	minUploadDate    string
+	maxUploadDate    string
 )
 
 type Credentials struct {
@@ -33,32 +116,65 @@ var rootCmd = &cobra.Command{
 	Use:   "flickr-exporter",
 	Short: "Export original-resolution photos from Flickr",
 	Long: `A tool to export original-resolution photos from your Flickr account.
-Supports exporting single albums, collections, or all photos.
+Supports exporting single albums, collections, galleries, search results, or all photos.
 Photos are organized by album with date prefixes and include EXIF/IPTC metadata.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if jsonResult {
+			if outputFormat == outputFormatJSON {
+				return fmt.Errorf("--json can't be combined with --output-format json, since both write to stdout")
+			}
+			if outputDir == streamOutput {
+				return fmt.Errorf("--json can't be combined with --output -, since the tar stream is written to stdout")
+			}
+			// Nothing but the result is printed to stdout.
+			quiet = true
+		}
+		if logFile == "" {
+			return nil
+		}
+		return openRunLog(logFile, logTruncate)
+	},
 }
 
 var authCmd = &cobra.Command{
-	Use:   "auth",
-	Short: "Authenticate with Flickr to get OAuth tokens",
+	Use:     "auth",
+	Aliases: []string{"refresh"},
+	Short:   "Authenticate with Flickr to get OAuth tokens",
 	Long: `Start the OAuth authentication flow to get access tokens.
-You'll need to visit a URL and authorize the application.`,
+You'll need to visit a URL and authorize the application.
+
+If a credentials file is given with -c, its tokens are replaced with the new
+ones. "refresh" is an alias that requires -c, for renewing expired tokens.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if cmd.CalledAs() == "refresh" && credsFile == "" {
+			errorf("Error: refresh requires the credentials file to update (-c)\n")
+			exit(1)
+		}
+
 		err := loadCredsIfProvided()
 		if err != nil {
-			fmt.Printf("Error loading credentials: %v\n", err)
-			os.Exit(1)
+			errorf("Error loading credentials: %v\n", err)
+			exit(1)
+		}
+
+		if authCheck {
+			printCredsCheck()
+			return
 		}
 
 		if apiKey == "" || apiSecret == "" {
-			fmt.Println("Error: Both API key and API secret are required for authentication")
-			fmt.Println("Provide them via flags or credentials file (-c)")
-			os.Exit(1)
+			errorf("Error: Both API key and API secret are required for authentication\n")
+			errorf("Provide them via flags, a credentials file (-c), or --creds-command\n")
+			exit(1)
 		}
 
 		oauthToken, oauthTokenSecret, err := performOAuthFlow(apiKey, apiSecret)
+		if errors.Is(err, errAuthPending) {
+			return
+		}
 		if err != nil {
-			fmt.Printf("Error during authentication: %v\n", err)
-			os.Exit(1)
+			errorf("Error during authentication: %v\n", err)
+			exit(1)
 		}
 
 		// Save credentials to file if requested
@@ -70,14 +186,29 @@ You'll need to visit a URL and authorize the application.`,
 				OAuthTokenSecret: oauthTokenSecret,
 			}
 
-			err := saveCredentials(credsFileSave, creds)
+			err := saveCredentials(credsFileSave, creds, encryptCreds)
 			if err != nil {
-				fmt.Printf("Error saving credentials: %v\n", err)
-				os.Exit(1)
+				errorf("Error saving credentials: %v\n", err)
+				exit(1)
 			}
 
 			fmt.Printf("Credentials saved to %s\n", credsFileSave)
 			fmt.Printf("You can now use: ./flickr-exporter -c %s [command]\n", credsFileSave)
+		} else if credsFile != "" {
+			creds := Credentials{
+				APIKey:           apiKey,
+				APISecret:        apiSecret,
+				OAuthToken:       oauthToken,
+				OAuthTokenSecret: oauthTokenSecret,
+			}
+
+			err := updateCredentials(credsFile, creds, encryptCreds)
+			if err != nil {
+				errorf("Error updating credentials: %v\n", err)
+				exit(1)
+			}
+
+			fmt.Printf("Credentials updated in %s\n", credsFile)
 		}
 	},
 }
@@ -90,36 +221,40 @@ var albumCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		err := loadCredsIfProvided()
 		if err != nil {
-			fmt.Printf("Error loading credentials: %v\n", err)
-			os.Exit(1)
+			errorf("Error loading credentials: %v\n", err)
+			exit(exitFatal)
 		}
 
 		if apiKey == "" || apiSecret == "" {
-			fmt.Println("Error: Both API key and API secret are required")
-			fmt.Println("Provide them via flags or credentials file (-c)")
-			os.Exit(1)
+			errorf("Error: Both API key and API secret are required\n")
+			errorf("Provide them via flags, a credentials file (-c), or --creds-command\n")
+			exit(exitFatal)
 		}
 
-		exporter, err := NewFlickrExporter(apiKey, apiSecret, oauthToken, oauthTokenSecret, outputDir, verbose)
+		opts, err := exporterOptions()
 		if err != nil {
-			fmt.Printf("Error creating exporter: %v\n", err)
-			os.Exit(1)
+			errorf("Error: %v\n", err)
+			exit(exitFatal)
 		}
 
-		var hasErrors bool
+		exporter, err := NewFlickrExporter(apiKey, apiSecret, oauthToken, oauthTokenSecret, opts)
+		if err != nil {
+			errorf("Error creating exporter: %v\n", err)
+			exit(exitFatal)
+		}
+
+		var result exportResult
 		for _, albumID := range args {
-			fmt.Printf("Exporting album %s...\n", albumID)
+			statusf("Exporting album %s...\n", albumID)
 			err := exporter.ExportAlbum(albumID)
+			result.record(err)
 			if err != nil {
-				fmt.Printf("Error exporting album %s: %v\n", albumID, err)
-				hasErrors = true
+				errorf("Error exporting album %s: %v\n", albumID, err)
 				continue
 			}
-			fmt.Printf("Successfully exported album %s\n", albumID)
-		}
-		if hasErrors {
-			os.Exit(1)
+			statusf("Successfully exported album %s\n", albumID)
 		}
+		result.exit(exporter, "album")
 	},
 }
 
@@ -131,35 +266,87 @@ var collectionCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		err := loadCredsIfProvided()
 		if err != nil {
-			fmt.Printf("Error loading credentials: %v\n", err)
-			os.Exit(1)
+			errorf("Error loading credentials: %v\n", err)
+			exit(exitFatal)
 		}
 
 		if apiKey == "" || apiSecret == "" {
-			fmt.Println("Error: Both API key and API secret are required")
-			fmt.Println("Provide them via flags or credentials file (-c)")
-			os.Exit(1)
+			errorf("Error: Both API key and API secret are required\n")
+			errorf("Provide them via flags, a credentials file (-c), or --creds-command\n")
+			exit(exitFatal)
+		}
+
+		opts, err := exporterOptions()
+		if err != nil {
+			errorf("Error: %v\n", err)
+			exit(exitFatal)
 		}
 
-		exporter, err := NewFlickrExporter(apiKey, apiSecret, oauthToken, oauthTokenSecret, outputDir, verbose)
+		exporter, err := NewFlickrExporter(apiKey, apiSecret, oauthToken, oauthTokenSecret, opts)
 		if err != nil {
-			fmt.Printf("Error creating exporter: %v\n", err)
-			os.Exit(1)
+			errorf("Error creating exporter: %v\n", err)
+			exit(exitFatal)
 		}
 
-		var hasErrors bool
+		var result exportResult
 		for _, collectionID := range args {
-			fmt.Printf("Exporting collection %s...\n", collectionID)
+			statusf("Exporting collection %s...\n", collectionID)
 			err := exporter.ExportCollection(collectionID)
+			result.record(err)
 			if err != nil {
-				fmt.Printf("Error exporting collection %s: %v\n", collectionID, err)
-				hasErrors = true
+				errorf("Error exporting collection %s: %v\n", collectionID, err)
 				continue
 			}
-			fmt.Printf("Successfully exported collection %s\n", collectionID)
+			statusf("Successfully exported collection %s\n", collectionID)
 		}
-		if hasErrors {
-			os.Exit(1)
+		result.exit(exporter, "collection")
+	},
+}
+
+var retryCmd = &cobra.Command{
+	Use:   "retry",
+	Short: "Retry writing metadata to photos it failed for",
+	Long: `Write the metadata of the photos listed in the output directory's
+.flickr-exporter-metadata-errors file again, such as after a transient
+exiftool failure. Photos that were removed because their metadata couldn't be
+written are downloaded again first, unless --metadata-only is given.
+
+Photos that are fixed are removed from the list; those that fail again, or
+weren't retried, stay on it.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := loadCredsIfProvided()
+		if err != nil {
+			errorf("Error loading credentials: %v\n", err)
+			exit(exitFatal)
+		}
+
+		if apiKey == "" || apiSecret == "" {
+			errorf("Error: Both API key and API secret are required\n")
+			errorf("Provide them via flags, a credentials file (-c), or --creds-command\n")
+			exit(exitFatal)
+		}
+		if outputDir == streamOutput {
+			errorf("Error: retry needs the output directory the photos were exported to, not --output -\n")
+			exit(exitFatal)
+		}
+
+		opts, err := exporterOptions()
+		if err != nil {
+			errorf("Error: %v\n", err)
+			exit(exitFatal)
+		}
+		opts.RequireMetadata = true
+
+		exporter, err := NewFlickrExporter(apiKey, apiSecret, oauthToken, oauthTokenSecret, opts)
+		if err != nil {
+			errorf("Error creating exporter: %v\n", err)
+			exit(exitFatal)
+		}
+
+		if err := exporter.RetryMetadataErrors(metadataOnly); err != nil {
+			errorf("Error retrying metadata: %v\n", err)
+			exit(exitCode(err))
 		}
 	},
 }
@@ -172,59 +359,294 @@ var allCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		err := loadCredsIfProvided()
 		if err != nil {
-			fmt.Printf("Error loading credentials: %v\n", err)
-			os.Exit(1)
+			errorf("Error loading credentials: %v\n", err)
+			exit(exitFatal)
 		}
 
 		if apiKey == "" || apiSecret == "" {
-			fmt.Println("Error: Both API key and API secret are required")
-			fmt.Println("Provide them via flags or credentials file (-c)")
-			os.Exit(1)
+			errorf("Error: Both API key and API secret are required\n")
+			errorf("Provide them via flags, a credentials file (-c), or --creds-command\n")
+			exit(exitFatal)
+		}
+
+		if onlyUnorganized && (len(includeAlbums) > 0 || len(excludeAlbums) > 0) {
+			errorf("Error: --only-unorganized can't be combined with --include-album or --exclude-album\n")
+			exit(exitFatal)
+		}
+		if onlyUnorganized && noUnorganized {
+			errorf("Error: --only-unorganized and --no-unorganized can't be used together\n")
+			exit(exitFatal)
+		}
+		if onlyUnorganized && userID != "" && userID != currentUser {
+			errorf("Error: --only-unorganized can't be combined with --user-id, since Flickr only lists your own photos that aren't in any album\n")
+			exit(exitFatal)
+		}
+
+		opts, err := exporterOptions()
+		if err != nil {
+			errorf("Error: %v\n", err)
+			exit(exitFatal)
 		}
+		opts.Since, err = parseSince(since, outputDir)
+		if err != nil {
+			errorf("Error: %v\n", err)
+			exit(exitFatal)
+		}
+		if since != "" && opts.Since.IsZero() {
+			statusln("No previous run recorded in the output directory; exporting all photos")
+		}
+		opts.TrackExportedFiles = prune || pruneDelete
+		opts.SkipUnorganized = noUnorganized
 
-		exporter, err := NewFlickrExporter(apiKey, apiSecret, oauthToken, oauthTokenSecret, outputDir, verbose)
+		exporter, err := NewFlickrExporter(apiKey, apiSecret, oauthToken, oauthTokenSecret, opts)
 		if err != nil {
-			fmt.Printf("Error creating exporter: %v\n", err)
-			os.Exit(1)
+			errorf("Error creating exporter: %v\n", err)
+			exit(exitFatal)
 		}
 
-		fmt.Println("Exporting all photos...")
-		err = exporter.ExportAllPhotos()
+		if onlyUnorganized {
+			statusln("Exporting photos that aren't in any album...")
+			err = exporter.ExportUnorganizedPhotos()
+		} else {
+			statusln("Exporting all photos...")
+			err = exporter.ExportAllPhotos()
+		}
 		if err != nil {
-			fmt.Printf("Error exporting all photos: %v\n", err)
-			os.Exit(1)
+			errorf("Error exporting all photos: %v\n", err)
+			if opts.TrackExportedFiles {
+				errorf("Not pruning, since the export didn't complete\n")
+			}
+			if jsonResult {
+				printResult(exporter, "all", exitCode(err), []error{err})
+			}
+			exit(exitCode(err))
+		}
+		statusln("Successfully exported all photos")
+
+		if opts.TrackExportedFiles {
+			if err := pruneOrphanedFiles(exporter, pruneDelete, assumeYes); err != nil {
+				errorf("Error pruning: %v\n", err)
+				if jsonResult {
+					printResult(exporter, "all", exitFatal, []error{fmt.Errorf("pruning: %w", err)})
+				}
+				exit(exitFatal)
+			}
+		}
+		if jsonResult {
+			printResult(exporter, "all", exitOK, nil)
 		}
-		fmt.Println("Successfully exported all photos")
 	},
 }
 
-func performOAuthFlow(apiKey, apiSecret string) (string, string, error) {
-	client := flickr.NewFlickrClient(apiKey, apiSecret)
+var galleryCmd = &cobra.Command{
+	Use:   "gallery [gallery-id] [gallery-id2] ...",
+	Short: "Export one or more galleries",
+	Long: `Export photos from one or more Flickr galleries by their IDs.
+If no IDs are given, every gallery you've created is exported.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := loadCredsIfProvided()
+		if err != nil {
+			errorf("Error loading credentials: %v\n", err)
+			exit(exitFatal)
+		}
+
+		if apiKey == "" || apiSecret == "" {
+			errorf("Error: Both API key and API secret are required\n")
+			errorf("Provide them via flags, a credentials file (-c), or --creds-command\n")
+			exit(exitFatal)
+		}
 
-	// Step 1: Get request token
-	fmt.Println("Getting request token...")
-	fmt.Printf("Using API Key: %s\n", apiKey)
-	fmt.Printf("Using API Secret: %s\n", apiSecret[:8]+"...")
+		opts, err := exporterOptions()
+		if err != nil {
+			errorf("Error: %v\n", err)
+			exit(exitFatal)
+		}
 
-	requestTok, err := flickr.GetRequestToken(client)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to get request token: %w", err)
+		exporter, err := NewFlickrExporter(apiKey, apiSecret, oauthToken, oauthTokenSecret, opts)
+		if err != nil {
+			errorf("Error creating exporter: %v\n", err)
+			exit(exitFatal)
+		}
+
+		if len(args) == 0 {
+			statusln("Exporting all galleries...")
+			if err := exporter.ExportAllGalleries(); err != nil {
+				errorf("Error exporting galleries: %v\n", err)
+				exit(exitCode(err))
+			}
+			statusln("Successfully exported all galleries")
+			return
+		}
+
+		var result exportResult
+		for _, galleryID := range args {
+			statusf("Exporting gallery %s...\n", galleryID)
+			err := exporter.ExportGallery(galleryID)
+			result.record(err)
+			if err != nil {
+				errorf("Error exporting gallery %s: %v\n", galleryID, err)
+				continue
+			}
+			statusf("Successfully exported gallery %s\n", galleryID)
+		}
+		result.exit(exporter, "gallery")
+	},
+}
+
+var searchCmd = &cobra.Command{
+	Use:   "search",
+	Short: "Export photos matching a search",
+	Long: `Export your photos matching a Flickr search by text, tags, machine tags,
+and when they were taken or uploaded, into a folder named after the search.
+Filtering is done by Flickr, so only the matching photos are listed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := loadCredsIfProvided()
+		if err != nil {
+			errorf("Error loading credentials: %v\n", err)
+			exit(exitFatal)
+		}
+
+		if apiKey == "" || apiSecret == "" {
+			errorf("Error: Both API key and API secret are required\n")
+			errorf("Provide them via flags, a credentials file (-c), or --creds-command\n")
+			exit(exitFatal)
+		}
+
+		query, err := searchQueryFromFlags()
+		if err != nil {
+			errorf("Error: %v\n", err)
+			exit(exitFatal)
+		}
+		if query.IsEmpty() {
+			errorf("Error: Give at least one of --text, --tags, --machine-tags, or a date range to search for\n")
+			exit(exitFatal)
+		}
+
+		opts, err := exporterOptions()
+		if err != nil {
+			errorf("Error: %v\n", err)
+			exit(exitFatal)
+		}
+
+		exporter, err := NewFlickrExporter(apiKey, apiSecret, oauthToken, oauthTokenSecret, opts)
+		if err != nil {
+			errorf("Error creating exporter: %v\n", err)
+			exit(exitFatal)
+		}
+
+		statusf("Exporting photos matching %s...\n", query)
+		if err := exporter.ExportSearch(query); err != nil {
+			errorf("Error exporting search: %v\n", err)
+			exit(exitCode(err))
+		}
+		statusln("Successfully exported search")
+	},
+}
+
+// searchQueryFromFlags returns the search given by the search command's
+// flags.
+func searchQueryFromFlags() (SearchQuery, error) {
+	query := SearchQuery{
+		Text:        searchText,
+		Tags:        searchTags,
+		TagMode:     searchTagMode,
+		MachineTags: searchMachTags,
+	}
+	if err := validateTagMode(query.TagMode); err != nil {
+		return query, err
 	}
 
-	// Step 2: Get authorization URL
-	authUrl, err := flickr.GetAuthorizeUrl(client, requestTok)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to get authorization URL: %w", err)
+	var err error
+	if query.MinTaken, err = parseSearchDate("min-taken-date", minTakenDate, false); err != nil {
+		return query, err
+	}
+	if query.MaxTaken, err = parseSearchDate("max-taken-date", maxTakenDate, true); err != nil {
+		return query, err
 	}
+	if query.MinUploaded, err = parseSearchDate("min-upload-date", minUploadDate, false); err != nil {
+		return query, err
+	}
+	if query.MaxUploaded, err = parseSearchDate("max-upload-date", maxUploadDate, true); err != nil {
+		return query, err
+	}
+	return query, nil
+}
 
-	// Step 3: Ask user to authorize
-	fmt.Printf("\nPlease visit this URL to authorize the application:\n%s\n\n", authUrl)
-	fmt.Print("After authorizing, enter the verification code: ")
+// errAuthPending is returned by performOAuthFlow when it has printed the
+// authorization URL, but no verification code was given to finish with.
+var errAuthPending = errors.New("authorization pending")
 
-	var verificationCode string
-	_, err = fmt.Scanln(&verificationCode)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to read verification code: %w", err)
+// readLine reads a line from r, returning "" if r has no more input.
+func readLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+func performOAuthFlow(apiKey, apiSecret string) (string, string, error) {
+	client := flickr.NewFlickrClient(apiKey, apiSecret)
+	client.HTTPClient = newHTTPClient(httpTimeout, proxyURL)
+
+	var requestTok *flickr.RequestToken
+	verificationCode := verifier
+	if requestToken != "" {
+		// Resuming a flow started by an earlier run
+		token, secret, ok := strings.Cut(requestToken, ":")
+		if !ok || token == "" || secret == "" {
+			return "", "", fmt.Errorf("invalid request token %q (must be TOKEN:SECRET, as printed by auth)", requestToken)
+		}
+		if verificationCode == "" {
+			return "", "", fmt.Errorf("--request-token requires --verifier")
+		}
+		requestTok = &flickr.RequestToken{OauthToken: token, OauthTokenSecret: secret}
+	} else {
+		if verificationCode != "" {
+			return "", "", fmt.Errorf("--verifier requires the --request-token printed with the authorization URL it was issued for")
+		}
+
+		// Step 1: Get request token
+		fmt.Println("Getting request token...")
+		fmt.Printf("Using API Key: %s\n", apiKey)
+		fmt.Printf("Using API Secret: %s\n", apiSecret[:8]+"...")
+
+		var err error
+		requestTok, err = flickr.GetRequestToken(client)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to get request token: %w", err)
+		}
+
+		// Step 2: Get authorization URL
+		authUrl, err := flickr.GetAuthorizeUrl(client, requestTok)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to get authorization URL: %w", err)
+		}
+
+		// Step 3: Ask user to authorize
+		fmt.Printf("\nPlease visit this URL to authorize the application:\n%s\n\n", authUrl)
+		resumeArg := requestTok.OauthToken + ":" + requestTok.OauthTokenSecret
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			fmt.Print("After authorizing, enter the verification code: ")
+			_, err = fmt.Scanln(&verificationCode)
+			if err != nil {
+				return "", "", fmt.Errorf("failed to read verification code: %w", err)
+			}
+		} else {
+			// Piped input: use the code if one is given, or stop so that
+			// the flow can be finished by a later run.
+			verificationCode, err = readLine(os.Stdin)
+			if err != nil {
+				return "", "", fmt.Errorf("failed to read verification code: %w", err)
+			}
+			if verificationCode == "" {
+				fmt.Println("No verification code was given on stdin. After authorizing, finish by running auth")
+				fmt.Println("again with the same API key and credentials options, adding:")
+				fmt.Printf("--request-token %s --verifier CODE\n", resumeArg)
+				return "", "", errAuthPending
+			}
+		}
 	}
 
 	// Step 4: Get access token
@@ -239,7 +661,7 @@ func performOAuthFlow(apiKey, apiSecret string) (string, string, error) {
 	fmt.Printf("OAuth Token: %s\n", accessTok.OAuthToken)
 	fmt.Printf("OAuth Token Secret: %s\n", accessTok.OAuthTokenSecret)
 
-	if credsFileSave == "" {
+	if credsFileSave == "" && credsFile == "" {
 		fmt.Printf("\nSave these tokens and use them with:\n")
 		fmt.Printf("--oauth-token %s --oauth-token-secret %s\n", accessTok.OAuthToken, accessTok.OAuthTokenSecret)
 	}
@@ -247,12 +669,21 @@ func performOAuthFlow(apiKey, apiSecret string) (string, string, error) {
 	return accessTok.OAuthToken, accessTok.OAuthTokenSecret, nil
 }
 
-func saveCredentials(filename string, creds Credentials) error {
+// saveCredentials writes creds to filename, encrypted with a passphrase if
+// encrypt is set.
+func saveCredentials(filename string, creds Credentials, encrypt bool) error {
 	data, err := yaml.Marshal(creds)
 	if err != nil {
 		return fmt.Errorf("failed to marshal credentials: %w", err)
 	}
 
+	if encrypt {
+		data, err = encryptCredentials(data)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt credentials: %w", err)
+		}
+	}
+
 	err = os.WriteFile(filename, data, 0600) // Secure permissions
 	if err != nil {
 		return fmt.Errorf("failed to write credentials file: %w", err)
@@ -261,31 +692,144 @@ func saveCredentials(filename string, creds Credentials) error {
 	return nil
 }
 
+// updateCredentials sets the fields of creds in an existing credentials file,
+// leaving anything else in it, such as comments, as it is. An encrypted file
+// stays encrypted; a plaintext one is encrypted if encrypt is set.
+func updateCredentials(filename string, creds Credentials, encrypt bool) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read credentials file: %w", err)
+	}
+	if isEncryptedCredentials(data) {
+		encrypt = true
+		data, err = decryptCredentials(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse credentials file: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		// Empty or not a mapping; there's nothing worth keeping
+		return saveCredentials(filename, creds, encrypt)
+	}
+
+	fields := doc.Content[0]
+	setField := func(key, value string) {
+		for i := 0; i+1 < len(fields.Content); i += 2 {
+			if fields.Content[i].Value == key {
+				fields.Content[i+1].SetString(value)
+				return
+			}
+		}
+		keyNode := &yaml.Node{}
+		keyNode.SetString(key)
+		valueNode := &yaml.Node{}
+		valueNode.SetString(value)
+		fields.Content = append(fields.Content, keyNode, valueNode)
+	}
+	setField("api_key", creds.APIKey)
+	setField("api_secret", creds.APISecret)
+	setField("oauth_token", creds.OAuthToken)
+	setField("oauth_token_secret", creds.OAuthTokenSecret)
+
+	data, err = yaml.Marshal(&doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal credentials: %w", err)
+	}
+	if encrypt {
+		data, err = encryptCredentials(data)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt credentials: %w", err)
+		}
+	}
+
+	// The file's existing permissions are kept
+	err = os.WriteFile(filename, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write credentials file: %w", err)
+	}
+
+	return nil
+}
+
 func loadCredentials(filename string) (*Credentials, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read credentials file: %w", err)
 	}
+	return parseCredentials(data)
+}
+
+// parseCredentials parses credentials in YAML (or JSON, which YAML includes),
+// decrypting them first if they're encrypted.
+func parseCredentials(data []byte) (*Credentials, error) {
+	var err error
+	if isEncryptedCredentials(data) {
+		data, err = decryptCredentials(data)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	var creds Credentials
 	err = yaml.Unmarshal(data, &creds)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse credentials file: %w", err)
+		return nil, fmt.Errorf("failed to parse credentials: %w", err)
 	}
 
 	return &creds, nil
 }
 
 func loadCredsIfProvided() error {
-	if credsFile == "" {
-		return nil // No credentials file specified
-	}
+	// Credentials given as flags take precedence over loaded ones.
+	credSources = credFlagSources()
+	defer logCredSources()
 
-	creds, err := loadCredentials(credsFile)
+	var (
+		creds      *Credentials
+		loadedFrom string
+		err        error
+	)
+	switch {
+	case credsFile != "" && credsCommand != "":
+		return fmt.Errorf("--creds-file and --creds-command can't be used together")
+	case credsFile != "":
+		loadedFrom = "credentials file " + credsFile
+		creds, err = loadCredentials(credsFile)
+	case credsCommand != "":
+		loadedFrom = "--creds-command"
+		var data []byte
+		data, err = runCredsCommand(credsCommand)
+		if err == nil {
+			creds, err = parseCredentials(data)
+		}
+	default:
+		return nil // No credentials file or command specified
+	}
 	if err != nil {
 		return fmt.Errorf("failed to load credentials: %w", err)
 	}
 
+	loaded := map[string]string{
+		"API key":            creds.APIKey,
+		"API secret":         creds.APISecret,
+		"OAuth token":        creds.OAuthToken,
+		"OAuth token secret": creds.OAuthTokenSecret,
+	}
+	for name, value := range loaded {
+		switch flag, fromFlag := credSources[name]; {
+		case value == "":
+		case !fromFlag:
+			credSources[name] = loadedFrom
+		default:
+			credSources[name] = fmt.Sprintf("%s, overriding the one in %s", flag, loadedFrom)
+		}
+	}
+
 	// Only override if not already set via flags
 	if apiKey == "" {
 		apiKey = creds.APIKey
@@ -303,31 +847,483 @@ func loadCredsIfProvided() error {
 	return nil
 }
 
+// credential is one of the credentials whose source is reported by auth
+// --check and --verbose.
+type credential struct {
+	name   string
+	flag   string
+	value  string
+	secret bool
+}
+
+func credentials() []credential {
+	return []credential{
+		{"API key", "--api-key", apiKey, false},
+		{"API secret", "--api-secret", apiSecret, true},
+		{"OAuth token", "--oauth-token", oauthToken, false},
+		{"OAuth token secret", "--oauth-token-secret", oauthTokenSecret, true},
+	}
+}
+
+// credSources says where each credential was resolved from, by name, once
+// loadCredsIfProvided has run.
+var credSources map[string]string
+
+// credFlagSources returns the flag each credential set so far was given by,
+// by name.
+func credFlagSources() map[string]string {
+	sources := make(map[string]string)
+	for _, cred := range credentials() {
+		if cred.value != "" {
+			sources[cred.name] = cred.flag
+		}
+	}
+	return sources
+}
+
+// describe says whether cred is set and where from. Secrets aren't shown,
+// and the key and token only by their last few characters, so that the
+// output can be shared when asking for help.
+func (cred credential) describe() string {
+	switch {
+	case cred.value == "":
+		return "missing"
+	case cred.secret || len(cred.value) < 8:
+		return fmt.Sprintf("set (from %s)", credSources[cred.name])
+	default:
+		return fmt.Sprintf("...%s (from %s)", cred.value[len(cred.value)-4:], credSources[cred.name])
+	}
+}
+
+// logCredSources logs where each credential was resolved from, with
+// --verbose, unless auth --check is going to print it anyway.
+func logCredSources() {
+	if !verbose || authCheck {
+		return
+	}
+	for _, cred := range credentials() {
+		statusf("%-19s %s\n", cred.name+":", cred.describe())
+	}
+}
+
+// printCredsCheck prints where each credential was resolved from, for auth
+// --check. It exits with status 1 if the API key or secret is missing.
+func printCredsCheck() {
+	for _, cred := range credentials() {
+		fmt.Printf("%-19s %s\n", cred.name+":", cred.describe())
+	}
+
+	if apiKey == "" || apiSecret == "" {
+		errorf("Error: Both API key and API secret are required for authentication\n")
+		exit(1)
+	}
+	if oauthToken == "" || oauthTokenSecret == "" {
+		fmt.Println("No OAuth token yet; run auth without --check to get one")
+	}
+}
+
+// Exit codes
+const (
+	exitOK = 0
+	// exitFatal means nothing could be exported, because of bad options,
+	// missing credentials, or an error listing what to export.
+	exitFatal = 1
+	// exitPartial means the export completed, but some photos or albums
+	// failed.
+	exitPartial = 2
+)
+
+// exitCode returns the exit code for an export that returned err.
+func exitCode(err error) int {
+	var partial *PartialExportError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &partial):
+		return exitPartial
+	default:
+		return exitFatal
+	}
+}
+
+// exportResult tracks the outcome of exporting each item given on the
+// command line, to choose the exit code.
+type exportResult struct {
+	exported int
+	failed   int
+	errs     []error
+}
+
+func (r *exportResult) record(err error) {
+	if err != nil {
+		r.errs = append(r.errs, err)
+	}
+	switch exitCode(err) {
+	case exitOK:
+		r.exported++
+	case exitPartial:
+		r.exported++
+		r.failed++
+	default:
+		r.failed++
+	}
+}
+
+// exit exits with exitFatal if nothing was exported, or exitPartial if
+// anything failed, after printing the result of command with --json. It
+// returns normally if every item was exported.
+func (r *exportResult) exit(exporter *FlickrExporter, command string) {
+	code := exitOK
+	switch {
+	case r.exported == 0 && r.failed > 0:
+		code = exitFatal
+	case r.failed > 0:
+		code = exitPartial
+	}
+	if jsonResult {
+		printResult(exporter, command, code, r.errs)
+	}
+	if code != exitOK {
+		exit(code)
+	}
+}
+
+// statusf prints a status message about the export, unless --quiet is set.
+// With --output-format json or --output -, it's written to stderr so that
+// stdout only has JSON events or the tar stream. It's always written to the
+// run log.
+func statusf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	runLogger.printf("%s", msg)
+	switch {
+	case quiet:
+	case outputFormat == outputFormatJSON || outputDir == streamOutput:
+		fmt.Fprint(os.Stderr, msg)
+	default:
+		fmt.Print(msg)
+	}
+}
+
+func statusln(msg string) {
+	statusf("%s\n", msg)
+}
+
+// pruneOrphanedFiles lists the files in exported album folders that are no
+// longer on Flickr, and removes them if remove is set, after asking for
+// confirmation unless assumeYes is set.
+func pruneOrphanedFiles(exporter *FlickrExporter, remove, assumeYes bool) error {
+	orphans, err := exporter.OrphanedFiles()
+	if err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		statusln("No orphaned files found")
+		return nil
+	}
+
+	// The list is printed even with --quiet, since it's what was asked for.
+	out := os.Stdout
+	if quiet || outputFormat == outputFormatJSON {
+		out = os.Stderr
+	}
+	fmt.Fprintf(out, "Found %d files that are no longer on Flickr:\n", len(orphans))
+	for _, path := range orphans {
+		fmt.Fprintf(out, "  %s\n", path)
+	}
+
+	if !remove {
+		fmt.Fprintln(out, "Run with --prune-delete to remove them")
+		return nil
+	}
+
+	if !assumeYes {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return fmt.Errorf("not removing files without confirmation; use --yes to remove them non-interactively")
+		}
+		fmt.Fprintf(out, "Remove these %d files? [y/N] ", len(orphans))
+		var answer string
+		fmt.Scanln(&answer)
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			fmt.Fprintln(out, "Not removing any files")
+			return nil
+		}
+	}
+
+	removed := 0
+	for _, path := range orphans {
+		if err := os.Remove(path); err != nil {
+			errorf("Warning: Failed to remove %s: %v\n", path, err)
+			continue
+		}
+		removed++
+	}
+	statusf("Removed %d orphaned files\n", removed)
+	if removed < len(orphans) {
+		return fmt.Errorf("failed to remove %d files", len(orphans)-removed)
+	}
+	return nil
+}
+
+func exporterOptions() (ExporterOptions, error) {
+	opts := ExporterOptions{
+		OutputDir:           outputDir,
+		Verbose:             verbose,
+		HTML:                htmlGallery,
+		Catalog:             catalogFormats,
+		Zip:                 zipAlbums || zipRemove,
+		ZipRemove:           zipRemove,
+		WriteUploadDate:     writeUploadDate,
+		PreferEXIFDate:      preferEXIFDate,
+		IncludeNotes:        includeNotes,
+		IncludeStats:        includeStats,
+		AlbumKeywords:       albumKeywords,
+		TagPrefix:           tagPrefix,
+		Copyright:           copyright,
+		DedupHardlink:       dedupHardlink,
+		IncludeAlbums:       includeAlbums,
+		ExcludeAlbums:       excludeAlbums,
+		Privacy:             privacy,
+		SafetyLevel:         safetyLevel,
+		NoMetadata:          noMetadata,
+		RequireMetadata:     requireMetadata,
+		MetadataSchema:      metadataSchema,
+		Size:                photoSize,
+		VerifyDimensions:    verifyDimensions,
+		OriginalFilenames:   preferOrigName,
+		Overwrite:           overwrite,
+		RelistAlbums:        relistAlbums,
+		UnorganizedDir:      unorganizedDir,
+		UserID:              userID,
+		KeepOnMetadataError: keepMetaErrors,
+		LargestAvailable:    largestAvail,
+		CheckSpace:          checkSpace,
+		MaxPhotos:           maxPhotos,
+		ASCIIFilenames:      asciiFilenames,
+		LowercaseFilenames:  lowercaseNames,
+		MaxFolderNameLength: maxFolderNameLen,
+		DateFormat:          dateFormat,
+		PathSeparator:       pathSeparator,
+		ReplaceSpaces:       replaceSpaces,
+		ReportDuplicates:    reportDups,
+		AlbumDateSource:     albumDateSource,
+		NestCollections:     nestCollections,
+		FromPage:            fromPage,
+		ToPage:              toPage,
+		Progress:            showProgress,
+		Quiet:               quiet,
+		OutputFormat:        outputFormat,
+		CollectResult:       jsonResult,
+		HTTPTimeout:         httpTimeout,
+		Proxy:               proxyURL,
+		MaxRetries:          maxRetries,
+		RetryBackoff:        retryBackoff,
+		ListedTags:          listedTags,
+	}
+
+	if runLogger != nil {
+		opts.LogFile = runLogger
+	}
+
+	var err error
+	if outputDir == streamOutput {
+		opts.TarStream, opts.OutputDir, err = startStream()
+		if err != nil {
+			return opts, err
+		}
+	}
+
+	opts.Concurrency, err = parseConcurrency(concurrency)
+	if err != nil {
+		return opts, err
+	}
+
+	opts.Privacy, err = privacyFromFlags()
+	if err != nil {
+		return opts, err
+	}
+
+	if pathMapFile != "" {
+		pathMap, err := loadPathMap(pathMapFile)
+		if err != nil {
+			return opts, err
+		}
+		opts.PathMap = pathMap
+	}
+
+	// A stream has no output directory to find an ignore file in.
+	if ignoreFile != "" || outputDir != streamOutput {
+		ignored, err := loadIgnoreFile(ignoreFilePath(ignoreFile, outputDir))
+		if err != nil {
+			return opts, err
+		}
+		opts.IgnoredAlbums = ignored.albums
+		opts.IgnoredPhotos = ignored.photos
+	}
+
+	return opts, nil
+}
+
+// privacyFromFlags returns the privacy level to export, from --privacy or
+// its shorthands --include-private (any) and --exclude-private (public),
+// which can't be combined with each other or with --privacy.
+func privacyFromFlags() (string, error) {
+	privacySet := rootCmd.PersistentFlags().Changed("privacy")
+	switch {
+	case includePrivate && excludePrivate:
+		return "", fmt.Errorf("--include-private and --exclude-private can't be used together")
+	case (includePrivate || excludePrivate) && privacySet:
+		return "", fmt.Errorf("--include-private and --exclude-private can't be combined with --privacy")
+	case includePrivate:
+		return privacyAny, nil
+	case excludePrivate:
+		return privacyPublic, nil
+	default:
+		return privacy, nil
+	}
+}
+
+// maxAutoConcurrency bounds --concurrency auto, so that machines with many
+// CPUs don't make more requests to Flickr at once than it tolerates.
+const maxAutoConcurrency = 8
+
+// parseConcurrency parses the value of --concurrency: a number of workers,
+// or "auto" for one per CPU, up to maxAutoConcurrency.
+func parseConcurrency(value string) (int, error) {
+	if value == "auto" {
+		return min(runtime.NumCPU(), maxAutoConcurrency), nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid concurrency %q (must be a number or \"auto\")", value)
+	}
+	return n, nil
+}
+
+const checkSpaceUsage = "Before downloading, check the size of each photo to download and fail if there isn't enough free space (one extra request per photo)"
+
 func init() {
 	// Global flags available to all commands
 	rootCmd.PersistentFlags().StringVarP(&apiKey, "api-key", "k", "", "Flickr API Key")
 	rootCmd.PersistentFlags().StringVarP(&apiSecret, "api-secret", "s", "", "Flickr API Secret")
-	rootCmd.PersistentFlags().StringVarP(&outputDir, "output", "o", "./flickr-export", "Output directory for exported photos")
+	rootCmd.PersistentFlags().StringVarP(&outputDir, "output", "o", "./flickr-export", "Output directory for exported photos, or - to stream them to stdout as a tar archive")
 	rootCmd.PersistentFlags().StringVar(&oauthToken, "oauth-token", "", "OAuth token")
 	rootCmd.PersistentFlags().StringVar(&oauthTokenSecret, "oauth-token-secret", "", "OAuth token secret")
 	rootCmd.PersistentFlags().StringVarP(&credsFile, "creds-file", "c", "", "Credentials file (YAML)")
+	rootCmd.PersistentFlags().StringVar(&credsCommand, "creds-command", "", "Shell command that prints the credentials (YAML or JSON), e.g. to read them from a secrets manager")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose logging (show individual photo downloads)")
+	rootCmd.PersistentFlags().BoolVar(&htmlGallery, "html", false, "Generate a browsable index.html for each album and the output directory")
+	rootCmd.PersistentFlags().StringSliceVar(&catalogFormats, "catalog", nil, "Write a catalog of all exported photos to the output directory (formats: csv, sqlite)")
+	rootCmd.PersistentFlags().BoolVar(&zipAlbums, "zip", false, "Package each album as a ZIP archive next to its folder")
+	rootCmd.PersistentFlags().BoolVar(&zipRemove, "zip-remove", false, "Remove each album folder after archiving it (implies --zip)")
+	rootCmd.PersistentFlags().BoolVar(&writeUploadDate, "write-upload-date", false, "Write the date each photo was uploaded to Flickr to XMP:DateTimeDigitized")
+	rootCmd.PersistentFlags().BoolVar(&preferEXIFDate, "prefer-exif-date", false, "Keep the date taken in a photo's EXIF:DateTimeOriginal instead of writing Flickr's, and fill it in from Flickr if it's missing")
+	rootCmd.PersistentFlags().BoolVar(&includeNotes, "include-notes", false, "Write Flickr notes (annotations on areas of a photo) to XMP image regions")
+	rootCmd.PersistentFlags().BoolVar(&includeStats, "include-stats", false, "Write each photo's view and favorite counts to XMP-flickr:Views and XMP-flickr:Favorites (one extra API call per photo)")
+	rootCmd.PersistentFlags().BoolVar(&listedTags, "listed-tags", false, "Write tags as Flickr normalizes them in photo lists, e.g. newyork for \"New York\", saving an API call for each photo with tags")
+	rootCmd.PersistentFlags().BoolVar(&albumKeywords, "album-keywords", false, "Write every album each photo belongs to as an \"album:\" keyword")
+	rootCmd.PersistentFlags().StringVar(&tagPrefix, "tag-prefix", "", "Prefix each Flickr tag with this when writing it as a keyword, e.g. \"flickr:\"")
+	rootCmd.PersistentFlags().StringVar(&copyright, "copyright", defaultCopyright, "Copyright notice to write to each photo, with {year} replaced by the year it was taken and {name} by its owner's name (empty for none)")
+	rootCmd.PersistentFlags().BoolVar(&dedupHardlink, "dedup-hardlink", false, "Download photos in several albums once, hard linking them into the other album folders")
+	rootCmd.PersistentFlags().BoolVar(&reportDups, "report-duplicates", false, "Hash each photo as it's downloaded, and list photos with identical content in duplicates.txt (nothing is removed)")
+	rootCmd.PersistentFlags().StringVar(&concurrency, "concurrency", "4", "Number of albums, or photos within a single album, to process at once, or \"auto\" to choose based on the number of CPUs")
+	rootCmd.PersistentFlags().StringVar(&privacy, "privacy", "any", "Only export photos at this privacy level: public, private, friends, family, or any")
+	rootCmd.PersistentFlags().BoolVar(&includePrivate, "include-private", false, "Export photos at every privacy level (same as --privacy any)")
+	rootCmd.PersistentFlags().BoolVar(&excludePrivate, "exclude-private", false, "Only export public photos (same as --privacy public)")
+	rootCmd.PersistentFlags().StringVar(&safetyLevel, "safety-level", "restricted", "Only export photos at or below this Flickr safety level: safe, moderate, or restricted (everything)")
+	rootCmd.PersistentFlags().BoolVar(&noMetadata, "no-metadata", false, "Download original files only, without fetching or writing metadata (exiftool is not required)")
+	rootCmd.PersistentFlags().BoolVar(&requireMetadata, "require-metadata", false, "Fail if exiftool is unavailable, instead of downloading photos without metadata")
+	rootCmd.PersistentFlags().BoolVar(&asciiFilenames, "ascii-filenames", false, "Transliterate folder names to ASCII and make them valid on Windows")
+	rootCmd.PersistentFlags().BoolVar(&lowercaseNames, "lowercase-filenames", false, "Lowercase folder names to avoid collisions on case-insensitive filesystems")
+	rootCmd.PersistentFlags().IntVar(&maxFolderNameLen, "max-folder-name-length", 0, "Truncate album folder names longer than this many bytes, adding a short hash to keep them unique (0 for no limit)")
+	rootCmd.PersistentFlags().StringVar(&dateFormat, "date-format", defaultDateFormat, "Format of the date album folders are prefixed with: a Go time layout like 2006.01, or compact, iso, year, or year-month")
+	rootCmd.PersistentFlags().StringVar(&pathSeparator, "path-separator", " ", "Separator between the date prefix and title of album folders")
+	rootCmd.PersistentFlags().StringVar(&replaceSpaces, "replace-spaces", "", "Replace spaces in folder names, and in filenames from titles, with this, e.g. _")
+	rootCmd.PersistentFlags().StringVar(&albumDateSource, "album-date-source", albumDateCreated, "Date album folders are prefixed with: created (when the album was created), or earliest-taken or latest-taken (from its photos; one extra API call per photo)")
+	rootCmd.PersistentFlags().StringVar(&ignoreFile, "ignore-file", "", "File listing albums and photos to skip, by ID or title glob (default: "+ignoreFilename+" in the output directory, if it exists)")
+	rootCmd.PersistentFlags().StringVar(&pathMapFile, "path-map", "", "YAML file mapping album IDs to folders (relative to the output directory) to export them to")
+	rootCmd.PersistentFlags().StringVar(&metadataSchema, "metadata-schema", "both", "Which metadata tags to write: iptc, xmp, or both")
+	rootCmd.PersistentFlags().StringVar(&photoSize, "size", sizeOriginal, "Size of photo to download: original, large2048, large1600, large1024, medium800, medium640, or medium500")
+	rootCmd.PersistentFlags().BoolVar(&largestAvail, "largest-available", false, "Download the largest available size of photos whose original can't be downloaded, instead of skipping them")
+	rootCmd.PersistentFlags().BoolVar(&overwrite, "overwrite", false, "Download photos again even if they already exist, replacing them (e.g. to repair damaged files)")
+	rootCmd.PersistentFlags().BoolVar(&relistAlbums, "relist", false, "List the photos in every album, instead of skipping albums that haven't changed on Flickr since they were last exported in full")
+	rootCmd.PersistentFlags().StringVar(&unorganizedDir, "unorganized-dir", unorganizedAlbumTitle, "Folder to export photos that aren't in any album to (empty for the output directory itself)")
+	rootCmd.PersistentFlags().StringVar(&userID, "user-id", "", "Export the public photos of this user (an NSID like 12345678@N02, a username, or a photostream URL) instead of your own")
+	rootCmd.PersistentFlags().BoolVar(&keepMetaErrors, "keep-on-metadata-error", false, "Keep downloaded photos whose metadata can't be written, instead of removing them; either way they're listed in .flickr-exporter-metadata-errors for retry")
+	rootCmd.PersistentFlags().BoolVar(&preferOrigName, "prefer-original-filename", false, "Name photos after their titles, which Flickr sets to the uploaded file's name (e.g. DSC_0423.jpg), instead of their download URLs")
+	rootCmd.PersistentFlags().IntVar(&maxPhotos, "max-photos", 0, "Stop after downloading this many photos, e.g. to try out options on a sample (0 for no limit)")
+	rootCmd.PersistentFlags().BoolVar(&verifyDimensions, "verify-dimensions", false, "Check that each downloaded image has the dimensions Flickr reports, and download it again if not")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Print nothing but warnings and errors, to stderr (for cron jobs)")
+	rootCmd.PersistentFlags().BoolVar(&showProgress, "progress", false, "Show a progress bar instead of logging each album and photo (when output is a terminal)")
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "output-format", outputFormatText, "Output format: text, or json for newline-delimited JSON events on stdout (logs go to stderr)")
+	rootCmd.PersistentFlags().DurationVar(&httpTimeout, "http-timeout", 0, "Timeout for each HTTP request, including downloads (0 for no timeout)")
+	rootCmd.PersistentFlags().StringVar(&proxyURL, "proxy", "", "HTTP proxy URL (default: from HTTP_PROXY/HTTPS_PROXY; NO_PROXY is honored)")
+	rootCmd.PersistentFlags().IntVar(&maxRetries, "max-retries", 4, "Number of times to retry a rate-limited request, or one that failed because Flickr was unavailable")
+	rootCmd.PersistentFlags().DurationVar(&retryBackoff, "retry-backoff", 2*time.Second, "Delay before the first retry; doubles with each subsequent retry, with random jitter")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Also write all messages, with timestamps, to this file, including those hidden by --quiet or --progress")
+	rootCmd.PersistentFlags().BoolVar(&logTruncate, "log-truncate", false, "Truncate the --log-file at the start of each run instead of appending to it")
+
+	// All command specific flags
+	allCmd.Flags().StringArrayVar(&includeAlbums, "include-album", nil, "Only export albums with this ID or whose title matches this glob (case-insensitive; repeatable)")
+	allCmd.Flags().StringArrayVar(&excludeAlbums, "exclude-album", nil, "Skip albums with this ID or whose title matches this glob (case-insensitive; repeatable)")
+	allCmd.Flags().BoolVar(&onlyUnorganized, "only-unorganized", false, "Only export photos that aren't in any album")
+	allCmd.Flags().BoolVar(&noUnorganized, "no-unorganized", false, "Only export albums, skipping photos that aren't in any album")
+	allCmd.Flags().BoolVar(&checkSpace, "check-space", false, checkSpaceUsage)
+	allCmd.Flags().BoolVar(&prune, "prune", false, "After exporting, list photo files in exported album folders that are no longer on Flickr")
+	allCmd.Flags().BoolVar(&pruneDelete, "prune-delete", false, "Like --prune, but remove the files listed, after asking for confirmation (implies --prune)")
+	allCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Don't ask for confirmation before removing files with --prune-delete")
+	allCmd.Flags().StringVar(&since, "since", "", "Only download photos uploaded on or after this date (YYYY-MM-DD or RFC 3339), or \"last-run\" for photos uploaded since the last successful export")
+
+	for _, cmd := range []*cobra.Command{allCmd, albumCmd, collectionCmd} {
+		cmd.Flags().BoolVar(&jsonResult, "json", false, "Print nothing but warnings and errors, then a JSON summary of the run to stdout when it's done")
+	}
+
+	// Album command specific flags
+	albumCmd.Flags().BoolVar(&checkSpace, "check-space", false, checkSpaceUsage)
+	albumCmd.Flags().IntVar(&fromPage, "from-page", 0, "Only export photos from this page (of 500 photos) of each album onward")
+	albumCmd.Flags().IntVar(&toPage, "to-page", 0, "Only export photos up to and including this page (of 500 photos) of each album")
+
+	// Collection command specific flags
+	collectionCmd.Flags().BoolVar(&nestCollections, "nest-collections", false, "Export albums into folders named after their collection, and any collections nested within it")
+
+	// Search command specific flags
+	searchCmd.Flags().StringVar(&searchText, "text", "", "Search photo titles, descriptions, and tags for this text")
+	searchCmd.Flags().StringSliceVar(&searchTags, "tags", nil, "Only export photos with these tags (comma-separated or repeatable)")
+	searchCmd.Flags().StringVar(&searchTagMode, "tag-mode", tagModeAny, "Whether photos need any or all of --tags: any or all")
+	searchCmd.Flags().StringSliceVar(&searchMachTags, "machine-tags", nil, "Only export photos with any of these machine tags, e.g. geo:locality=paris (comma-separated or repeatable)")
+	searchCmd.Flags().StringVar(&minTakenDate, "min-taken-date", "", "Only export photos taken on or after this date (YYYY-MM-DD or RFC 3339)")
+	searchCmd.Flags().StringVar(&maxTakenDate, "max-taken-date", "", "Only export photos taken on or before this date (YYYY-MM-DD or RFC 3339)")
+	searchCmd.Flags().StringVar(&minUploadDate, "min-upload-date", "", "Only export photos uploaded on or after this date (YYYY-MM-DD or RFC 3339)")
+	searchCmd.Flags().StringVar(&maxUploadDate, "max-upload-date", "", "Only export photos uploaded on or before this date (YYYY-MM-DD or RFC 3339)")
 
 	// Auth command specific flags
 	authCmd.Flags().StringVar(&credsFileSave, "save-creds", "", "Save credentials to this YAML file")
+	authCmd.Flags().StringVar(&verifier, "verifier", "", "Verification code from the authorization page, to finish a flow started by an earlier run (requires --request-token)")
+	authCmd.Flags().StringVar(&requestToken, "request-token", "", "Request token printed by the earlier run that showed the authorization URL, as TOKEN:SECRET")
+	authCmd.Flags().BoolVar(&encryptCreds, "encrypt-creds", false, "Encrypt the saved credentials with a passphrase, which is asked for whenever they're loaded (or read from $"+passphraseEnv+")")
+	authCmd.Flags().BoolVar(&authCheck, "check", false, "Print which credentials were found and where from, without contacting Flickr")
+
+	// Retry command specific flags
+	retryCmd.Flags().BoolVar(&metadataOnly, "metadata-only", false, "Only rewrite the metadata of photos that were kept, without downloading those that were removed")
 
-	rootCmd.Version = version
+	rootCmd.Version = versionString()
 
 	// Add subcommands
 	rootCmd.AddCommand(authCmd)
 	rootCmd.AddCommand(albumCmd)
 	rootCmd.AddCommand(collectionCmd)
 	rootCmd.AddCommand(allCmd)
+	rootCmd.AddCommand(retryCmd)
+	rootCmd.AddCommand(galleryCmd)
+	rootCmd.AddCommand(searchCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(versionCmd)
 }
 
 func main() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		errorf("%v\n", err)
+		exit(exitFatal)
 	}
+	exit(exitOK)
 }
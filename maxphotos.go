@@ -0,0 +1,61 @@
+package main
+
+import "sync"
+
+// photoLimit caps the number of photos downloaded during an export, for
+// trying out options on a sample of photos. It is shared with workers, and
+// its methods are no-ops on a nil *photoLimit, which imposes no limit.
+type photoLimit struct {
+	mu  sync.Mutex
+	max int
+	// pending counts photos being downloaded, and done those downloaded.
+	pending int
+	done    int
+}
+
+func newPhotoLimit(max int) *photoLimit {
+	if max == 0 {
+		return nil
+	}
+	return &photoLimit{max: max}
+}
+
+// take reserves one of the remaining downloads, returning false if none
+// remain. Each successful take must be followed by a call to finish.
+func (l *photoLimit) take() bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pending+l.done >= l.max {
+		return false
+	}
+	l.pending++
+	return true
+}
+
+// finish releases a download reserved by take, counting it toward the limit
+// if the photo was downloaded.
+func (l *photoLimit) finish(downloaded bool) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending--
+	if downloaded {
+		l.done++
+	}
+}
+
+// reached reports whether the limit's photos have all been downloaded, so
+// that no more albums need to be listed.
+func (l *photoLimit) reached() bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.done >= l.max
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metadata schemas accepted by --metadata-schema.
+const (
+	metadataSchemaIPTC = "iptc"
+	metadataSchemaXMP  = "xmp"
+	metadataSchemaBoth = "both"
+)
+
+func validateMetadataSchema(schema string) error {
+	switch schema {
+	case metadataSchemaIPTC, metadataSchemaXMP, metadataSchemaBoth:
+		return nil
+	default:
+		return fmt.Errorf("invalid metadata schema %q (must be one of: iptc, xmp, both)", schema)
+	}
+}
+
+// writesIPTC reports whether IPTC tags are written to downloaded photos.
+func (fe *FlickrExporter) writesIPTC() bool {
+	return fe.metadataSchema != metadataSchemaXMP
+}
+
+// writesXMP reports whether XMP tags are written to downloaded photos. The
+// license, page URL, upload date, and notes only have XMP tags, so they are
+// only written if this is true.
+func (fe *FlickrExporter) writesXMP() bool {
+	return fe.metadataSchema != metadataSchemaIPTC
+}
+
+// existingDateTaken returns the EXIF:DateTimeOriginal already in the photo
+// at photoPath, as written by the camera or scanner, for --prefer-exif-date.
+func (fe *FlickrExporter) existingDateTaken(photoPath string) (string, bool) {
+	files := fe.et.ExtractMetadata(photoPath)
+	if len(files) != 1 || files[0].Err != nil {
+		return "", false
+	}
+	date, err := files[0].GetString("DateTimeOriginal")
+	// Cameras whose clock was never set write zeros instead of a date.
+	if err != nil || strings.Trim(date, "0: ") == "" {
+		return "", false
+	}
+	return date, true
+}
+
+// holdsOnlyXMP reports whether the photo at path is in a format that can't
+// hold IPTC or EXIF tags, only XMP: a GIF. Its metadata is written as XMP
+// whatever the schema, so that it isn't left without any.
+func holdsOnlyXMP(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".gif")
+}
+
+// defaultCopyright is the default --copyright template.
+const defaultCopyright = "© {year} {name}"
+
+// copyrightNotice returns the copyright notice for photo, from the
+// --copyright template, or "" if none should be written: if there's no
+// template, the photo's owner isn't known, or its license puts it in the
+// public domain. The year is when the photo was taken, or if that isn't
+// known, uploaded.
+func (fe *FlickrExporter) copyrightNotice(photo Photo) string {
+	if fe.copyright == "" || photo.Owner == "" || photo.License.PublicDomain {
+		return ""
+	}
+
+	date := photo.DateTaken
+	if date.IsZero() {
+		date = photo.DateUploaded
+	}
+	var year string
+	if !date.IsZero() {
+		year = strconv.Itoa(date.Year())
+	}
+
+	notice := strings.NewReplacer("{year}", year, "{name}", photo.Owner).Replace(fe.copyright)
+	return strings.Join(strings.Fields(notice), " ")
+}
+
+// rightsStatement returns the value of XMP-dc:Rights for photo: its
+// copyright notice followed by the name of its license, e.g. "© 2019 Jane
+// Doe. All Rights Reserved", or whichever of them it has.
+func (fe *FlickrExporter) rightsStatement(photo Photo) string {
+	notice := fe.copyrightNotice(photo)
+	switch {
+	case notice == "":
+		return photo.License.Name
+	case photo.License.Name == "":
+		return notice
+	}
+	return strings.TrimRight(notice, ". ") + ". " + photo.License.Name
+}
+
+// photoInfoCache holds the details fetched for each photo, by photo ID, so
+// that photos in several albums are only looked up once. It's shared with
+// workers and safe for concurrent use. It only lasts for one run, so every
+// run picks up edits made on Flickr since the last.
+type photoInfoCache struct {
+	mu     sync.Mutex
+	photos map[string]Photo
+}
+
+func (c *photoInfoCache) get(photoID string) (Photo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	photo, ok := c.photos[photoID]
+	return photo, ok
+}
+
+func (c *photoInfoCache) add(photo Photo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.photos == nil {
+		c.photos = make(map[string]Photo)
+	}
+	c.photos[photo.ID] = photo
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/barasher/go-exiftool"
+)
+
+func TestHoldsOnlyXMP(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"album/photo.gif", true},
+		{"album/PHOTO.GIF", true},
+		{"album/photo.jpg", false},
+		{"album/photo.jpeg", false},
+		{"album/photo.png", false},
+		{"album/photo.gif.jpg", false},
+		{"album.gif/photo.jpg", false},
+		{"album/gif", false},
+	}
+	for _, tt := range tests {
+		if got := holdsOnlyXMP(tt.path); got != tt.want {
+			t.Errorf("holdsOnlyXMP(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRightsStatement(t *testing.T) {
+	taken := time.Date(2019, 7, 4, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		copyright string
+		photo     Photo
+		want      string
+	}{
+		{"notice and license", defaultCopyright, Photo{Owner: "Jane Doe", DateTaken: taken, License: flickrLicenses["0"]}, "© 2019 Jane Doe. All Rights Reserved"},
+		{"notice ending with a period", "Copyright {name}.", Photo{Owner: "Jane Doe", License: flickrLicenses["4"]}, "Copyright Jane Doe. Attribution 2.0 (CC BY 2.0)"},
+		{"no notice", "", Photo{Owner: "Jane Doe", DateTaken: taken, License: flickrLicenses["4"]}, "Attribution 2.0 (CC BY 2.0)"},
+		{"no owner", defaultCopyright, Photo{DateTaken: taken, License: flickrLicenses["0"]}, "All Rights Reserved"},
+		{"public domain", defaultCopyright, Photo{Owner: "Jane Doe", DateTaken: taken, License: flickrLicenses["9"]}, "Public Domain Dedication (CC0)"},
+		{"no license", defaultCopyright, Photo{Owner: "Jane Doe", DateTaken: taken}, "© 2019 Jane Doe"},
+		{"neither", "", Photo{Owner: "Jane Doe"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fe := &FlickrExporter{copyright: tt.copyright}
+			fm := exiftool.EmptyFileMetadata()
+			fe.setXMPMetadata(&fm, "photo.jpg", tt.photo, nil)
+
+			got, err := fm.GetString("XMP-dc:Rights")
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("wrote XMP-dc:Rights %q, want none", got)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("XMP-dc:Rights = %q (%v), want %q", got, err, tt.want)
+			}
+			// The license is still written in full to UsageTerms.
+			if terms, _ := fm.GetString("XMP-xmpRights:UsageTerms"); tt.photo.License.Name != "" && terms != tt.photo.License.UsageTerms() {
+				t.Errorf("XMP-xmpRights:UsageTerms = %q, want %q", terms, tt.photo.License.UsageTerms())
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// metadataErrorsFilename names the file in the output directory listing the
+// photos whose metadata couldn't be written, for the retry command. Each line
+// is a photo ID, the photo's path relative to the output directory, and
+// whether the photo was kept (with --keep-on-metadata-error) or removed,
+// separated by tabs. Lines without the last field, written by earlier
+// versions, are of kept photos.
+const metadataErrorsFilename = ".flickr-exporter-metadata-errors"
+
+// Whether a photo listed in the metadata errors file was kept or removed.
+const (
+	metadataErrorKept    = "kept"
+	metadataErrorRemoved = "removed"
+)
+
+// metadataErrors appends the photos whose metadata couldn't be written to the
+// metadata errors file as they fail, so that they're listed even if the
+// export is interrupted. It is safe for concurrent use, and a nil
+// *metadataErrors records nothing.
+type metadataErrors struct {
+	mu      sync.Mutex
+	dir     string
+	kept    int
+	removed int
+}
+
+type metadataError struct {
+	photoID string
+	// path is relative to the output directory.
+	path string
+	kept bool
+}
+
+func (e metadataError) String() string {
+	status := metadataErrorRemoved
+	if e.kept {
+		status = metadataErrorKept
+	}
+	return fmt.Sprintf("%s\t%s\t%s\n", e.photoID, e.path, status)
+}
+
+// add appends the photo with the given ID, downloaded to path, to the
+// metadata errors file.
+func (m *metadataErrors) add(photoID, path string, kept bool) error {
+	if m == nil {
+		return nil
+	}
+	if rel, err := filepath.Rel(m.dir, path); err == nil {
+		path = rel
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if kept {
+		m.kept++
+	} else {
+		m.removed++
+	}
+	f, err := os.OpenFile(filepath.Join(m.dir, metadataErrorsFilename), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	// Each line is written whole, so lines from other exports appending
+	// to the file at the same time aren't interleaved.
+	if _, err := f.WriteString(metadataError{photoID: photoID, path: path, kept: kept}.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// counts returns the number of photos kept and removed without their
+// metadata.
+func (m *metadataErrors) counts() (kept, removed int) {
+	if m == nil {
+		return 0, 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.kept, m.removed
+}
+
+// keepWithoutMetadata handles a failure to write metadata to the photo
+// downloaded to photoPath: it lists the photo in the metadata errors file,
+// then with --keep-on-metadata-error returns nil, so the photo is kept, or
+// otherwise removes the photo and returns err.
+func (fe *FlickrExporter) keepWithoutMetadata(photo Photo, photoPath string, err error) error {
+	if listErr := fe.metadataErrors.add(photo.ID, photoPath, fe.keepOnMetadataError); listErr != nil {
+		fe.warnf("  Warning: Failed to list %s in %s: %v\n", photo.Filename, metadataErrorsFilename, listErr)
+	}
+	if fe.keepOnMetadataError {
+		return nil
+	}
+
+	// A photo without its metadata is incomplete, so remove it to
+	// download it again next time.
+	if removeErr := os.Remove(photoPath); removeErr != nil {
+		fe.warnf("  Error: Also failed to remove incomplete photo %s: %v\n", photo.Filename, removeErr)
+	}
+	return err
+}
+
+// loadMetadataErrors reads the metadata errors file in dir. Photos listed
+// more than once are only returned once, as last listed.
+func loadMetadataErrors(dir string) ([]metadataError, error) {
+	f, err := os.Open(filepath.Join(dir, metadataErrorsFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []metadataError
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 2 {
+			continue
+		}
+		entry := metadataError{
+			photoID: fields[0],
+			path:    fields[1],
+			kept:    len(fields) < 3 || fields[2] != metadataErrorRemoved,
+		}
+		key := entry.photoID + "\t" + entry.path
+		if i, ok := index[key]; ok {
+			entries[i] = entry
+			continue
+		}
+		index[key] = len(entries)
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// RetryMetadataErrors writes the metadata of each photo listed in the
+// metadata errors file again, first downloading those that were removed,
+// unless metadataOnly is set. The file is then rewritten to list only the
+// photos that still failed or weren't retried.
+func (fe *FlickrExporter) RetryMetadataErrors(metadataOnly bool) error {
+	defer fe.Close()
+
+	if fe.et == nil {
+		return fmt.Errorf("exiftool is needed to write metadata")
+	}
+	entries, err := loadMetadataErrors(fe.outputDir)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", metadataErrorsFilename, err)
+	}
+	if len(entries) == 0 {
+		fe.logf("No photos are listed in %s\n", filepath.Join(fe.outputDir, metadataErrorsFilename))
+		return nil
+	}
+	fe.logf("Retrying %d photos whose metadata couldn't be written...\n", len(entries))
+
+	var remaining []metadataError
+	var fixed, failed int
+	for _, entry := range entries {
+		photoPath := filepath.Join(fe.outputDir, entry.path)
+		_, statErr := os.Stat(photoPath)
+		exists := statErr == nil
+		if !exists && metadataOnly {
+			if fe.verbose {
+				fe.logf("  Skipping %s, which needs downloading again\n", entry.path)
+			}
+			remaining = append(remaining, entry)
+			continue
+		}
+
+		// Listed as missing its original URL, so that fetching its
+		// info fills that in for downloading.
+		photo := Photo{ID: entry.photoID, Filename: filepath.Base(photoPath), NoOriginal: true}
+		if err := fe.fetchPhotoMetadata(&photo); err != nil {
+			fe.warnf("  Warning: Failed to get metadata for %s: %v\n", entry.path, err)
+			remaining = append(remaining, entry)
+			failed++
+			continue
+		}
+		if !exists {
+			if err := os.MkdirAll(filepath.Dir(photoPath), 0755); err != nil {
+				fe.warnf("  Warning: Failed to download %s: %v\n", entry.path, err)
+				remaining = append(remaining, entry)
+				failed++
+				continue
+			}
+			if err := fe.downloadPhoto(photo, photoPath); err != nil {
+				fe.warnf("  Warning: Failed to download %s: %v\n", entry.path, err)
+				remaining = append(remaining, entry)
+				failed++
+				continue
+			}
+		}
+
+		if err := fe.writeMetadata(photoPath, photo); err != nil {
+			fe.warnf("  Error: Failed to write metadata for %s: %v\n", entry.path, err)
+			entry.kept = exists || fe.keepOnMetadataError
+			if !entry.kept {
+				if removeErr := os.Remove(photoPath); removeErr != nil {
+					fe.warnf("  Error: Also failed to remove incomplete photo %s: %v\n", entry.path, removeErr)
+				}
+			}
+			remaining = append(remaining, entry)
+			failed++
+			continue
+		}
+		fe.logf("  Wrote metadata for %s\n", entry.path)
+		fixed++
+	}
+
+	if err := saveMetadataErrors(fe.outputDir, remaining); err != nil {
+		fe.warnf("Warning: Failed to update %s: %v\n", metadataErrorsFilename, err)
+	}
+	fe.logf("Wrote the metadata of %d photos; %d still failed, and %d weren't retried\n", fixed, failed, len(remaining)-failed)
+	if failed > 0 {
+		return partialExportErrorf("failed to write the metadata of %d of %d photos", failed, fixed+failed)
+	}
+	return nil
+}
+
+// saveMetadataErrors replaces the metadata errors file in dir with entries,
+// or removes it if there are none.
+func saveMetadataErrors(dir string, entries []metadataError) error {
+	path := filepath.Join(dir, metadataErrorsFilename)
+	if len(entries) == 0 {
+		err := os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	var b strings.Builder
+	for _, entry := range entries {
+		b.WriteString(entry.String())
+	}
+	// Written to a temporary file first, so an interrupted write doesn't
+	// lose the list.
+	if err := os.WriteFile(path+".tmp", []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"strings"
+)
+
+// Flickr note coordinates are relative to the photo scaled so that its
+// longest side is this many pixels.
+const noteCoordinateSize = 500
+
+// PhotoNote is an annotation placed on a rectangular area of a photo.
+type PhotoNote struct {
+	ID         string
+	Author     string
+	AuthorName string
+	X, Y, W, H int
+	Text       string
+}
+
+type PhotoInfoNotes struct {
+	Note []PhotoInfoNote `xml:"note"`
+}
+
+type PhotoInfoNote struct {
+	ID         string `xml:"id,attr"`
+	Author     string `xml:"author,attr"`
+	AuthorName string `xml:"authorname,attr"`
+	X          int    `xml:"x,attr"`
+	Y          int    `xml:"y,attr"`
+	W          int    `xml:"w,attr"`
+	H          int    `xml:"h,attr"`
+	Text       string `xml:",chardata"`
+}
+
+func parsePhotoNotes(notes PhotoInfoNotes) []PhotoNote {
+	var result []PhotoNote
+	for _, note := range notes.Note {
+		result = append(result, PhotoNote{
+			ID:         note.ID,
+			Author:     note.Author,
+			AuthorName: note.AuthorName,
+			X:          note.X,
+			Y:          note.Y,
+			W:          note.W,
+			H:          note.H,
+			Text:       note.Text,
+		})
+	}
+	return result
+}
+
+// noteRegionInfo returns a serialized XMP-mwg-rs:RegionInfo structure, in
+// exiftool's structure syntax, describing notes as regions of the image at
+// photoPath.
+func noteRegionInfo(photoPath string, notes []PhotoNote) (string, error) {
+	file, err := os.Open(photoPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image dimensions: %w", err)
+	}
+	if config.Width == 0 || config.Height == 0 {
+		return "", fmt.Errorf("image has no dimensions")
+	}
+
+	// Work out the size of the image the note coordinates refer to
+	scaledW, scaledH := float64(config.Width), float64(config.Height)
+	if longest := max(scaledW, scaledH); longest > noteCoordinateSize {
+		scaledW = scaledW * noteCoordinateSize / longest
+		scaledH = scaledH * noteCoordinateSize / longest
+	}
+
+	var regions []string
+	for _, note := range notes {
+		// MWG regions are positioned by their center, normalized to 0-1
+		x := (float64(note.X) + float64(note.W)/2) / scaledW
+		y := (float64(note.Y) + float64(note.H)/2) / scaledH
+		w := float64(note.W) / scaledW
+		h := float64(note.H) / scaledH
+
+		region := fmt.Sprintf("{Area={X=%.4f,Y=%.4f,W=%.4f,H=%.4f,Unit=normalized}", x, y, w, h)
+		if note.AuthorName != "" {
+			region += ",Name=" + escapeStructValue(note.AuthorName)
+		}
+		if note.Text != "" {
+			region += ",Description=" + escapeStructValue(note.Text)
+		}
+		regions = append(regions, region+"}")
+	}
+
+	return fmt.Sprintf("{AppliedToDimensions={W=%d,H=%d,Unit=pixel},RegionList=[%s]}",
+		config.Width, config.Height, strings.Join(regions, ",")), nil
+}
+
+// escapeStructValue escapes s for use as a value in exiftool's serialized
+// structure syntax. Newlines are replaced with spaces, since exiftool reads
+// one argument per line.
+func escapeStructValue(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	replacer := strings.NewReplacer(
+		"|", "||",
+		",", "|,",
+		"[", "|[",
+		"]", "|]",
+		"{", "|{",
+		"}", "|}",
+	)
+	return replacer.Replace(s)
+}
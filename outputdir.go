@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// lowFreeSpace is the free space in the output directory below which a
+// warning is printed before exporting. Flickr doesn't report file sizes when
+// listing photos, so the size of an export isn't known in advance; this is
+// enough for a few hundred original photos.
+const lowFreeSpace = 1 << 30
+
+// checkOutputDir creates dir if it doesn't exist and checks that files can be
+// written to it, so that an unusable output directory fails the export before
+// any API calls are made.
+func checkOutputDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	probe, err := os.CreateTemp(dir, ".flickr-exporter-probe-*")
+	if err != nil {
+		return fmt.Errorf("output directory %s isn't writable: %w", dir, err)
+	}
+	probe.Close()
+	if err := os.Remove(probe.Name()); err != nil {
+		return fmt.Errorf("output directory %s isn't writable: %w", dir, err)
+	}
+	return nil
+}
+
+// warnIfLowOnSpace warns if the filesystem holding the output directory has
+// less than lowFreeSpace available.
+func (fe *FlickrExporter) warnIfLowOnSpace() {
+	free, ok := freeSpace(fe.outputDir)
+	if ok && free < lowFreeSpace {
+		fe.warnf("Warning: Only %d MB is free in %s\n", free>>20, fe.outputDir)
+	}
+}
+
+// checkFreeSpace estimates the size of the photos that will be downloaded, those
+// for which exists returns false, by asking Flickr's servers for the size of
+// each original, and returns an error if the output directory doesn't have
+// room for them. Photos whose original isn't available aren't counted.
+func (fe *FlickrExporter) checkFreeSpace(photos []Photo, exists func(Photo) bool) error {
+	free, ok := freeSpace(fe.outputDir)
+	if !ok {
+		fe.warnf("Warning: Can't check free space on this platform\n")
+		return nil
+	}
+
+	var pending []Photo
+	for _, photo := range photos {
+		if photo.OriginalURL != "" && !exists(photo) {
+			pending = append(pending, photo)
+		}
+	}
+	fe.logf("Checking the size of %d photos to download...\n", len(pending))
+
+	var needed, unknown atomic.Int64
+	indexes := make(chan int, len(pending))
+	for i := range pending {
+		indexes <- i
+	}
+	close(indexes)
+
+	var wg sync.WaitGroup
+	for i := 0; i < fe.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				size, err := fe.downloadSize(pending[i].OriginalURL)
+				if err != nil {
+					if fe.verbose {
+						fe.logf("  Failed to get the size of %s: %v\n", pending[i].Filename, err)
+					}
+					unknown.Add(1)
+					continue
+				}
+				needed.Add(size)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := unknown.Load(); n > 0 {
+		fe.warnf("Warning: Couldn't get the size of %d photos; they aren't counted\n", n)
+	}
+
+	total := needed.Load()
+	fe.logf("About %.1f GB will be downloaded; %.1f GB is free\n", float64(total)/1e9, float64(free)/1e9)
+	if uint64(total) > free {
+		return fmt.Errorf("not enough free space in %s: the export needs about %.1f GB, but only %.1f GB is free", fe.outputDir, float64(total)/1e9, float64(free)/1e9)
+	}
+	// The estimate is low: metadata makes files slightly larger than their
+	// originals, and photos in several albums are only counted once.
+	if float64(total) > 0.9*float64(free) {
+		fe.warnf("Warning: The export needs about %.1f GB, leaving little of the %.1f GB free in %s\n", float64(total)/1e9, float64(free)/1e9, fe.outputDir)
+	}
+	return nil
+}
+
+// checkFreeSpaceForAll runs checkFreeSpace for every photo in the account,
+// or every new photo with --since. The album folders photos will be saved to
+// aren't known until each album is listed, so a photo counts as downloaded
+// if a file with its name is anywhere in the output directory.
+func (fe *FlickrExporter) checkFreeSpaceForAll() error {
+	photos, err := fe.getAllPhotos()
+	if err != nil {
+		return fmt.Errorf("failed to list photos to check free space: %w", err)
+	}
+	existing := existingFilenames(fe.outputDir)
+	return fe.checkFreeSpace(photos, func(photo Photo) bool {
+		return existing[photo.Filename] && !fe.overwrite
+	})
+}
+
+// downloadSize returns the size of the file at url, from a HEAD request.
+// These requests go to Flickr's static file servers, not its API.
+func (fe *FlickrExporter) downloadSize(url string) (int64, error) {
+	var size int64
+	err := fe.withRetry("getting the size of "+url, func() error {
+		resp, err := fe.httpClient.Head(url)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+		}
+		if resp.ContentLength < 0 {
+			return fmt.Errorf("size not reported")
+		}
+		size = resp.ContentLength
+		return nil
+	})
+	return size, err
+}
+
+// existingFilenames returns the names of the files anywhere in dir, to tell
+// which photos have been downloaded before the folders of the albums they
+// belong to are known.
+func existingFilenames(dir string) map[string]bool {
+	names := make(map[string]bool)
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			names[d.Name()] = true
+		}
+		return nil
+	})
+	return names
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadPathMap reads a YAML file mapping album IDs to folders relative to the
+// output directory, e.g.:
+//
+//	72157694563874100: Travel/2018 Iceland
+//	72157712345678901: Family/Reunions
+func loadPathMap(filename string) (map[string]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read path map: %w", err)
+	}
+
+	var pathMap map[string]string
+	if err := yaml.Unmarshal(data, &pathMap); err != nil {
+		return nil, fmt.Errorf("failed to parse path map: %w", err)
+	}
+
+	return pathMap, nil
+}
+
+// validatePathMap checks that every mapped path is inside the output
+// directory.
+func validatePathMap(pathMap map[string]string) error {
+	for albumID, path := range pathMap {
+		if !isLocalPath(path) {
+			return fmt.Errorf("path map entry for album %s must be a relative path inside the output directory: %q", albumID, path)
+		}
+	}
+	return nil
+}
+
+// isLocalPath reports whether path is relative and doesn't refer to anything
+// outside the directory it's relative to.
+func isLocalPath(path string) bool {
+	if path == "" || filepath.IsAbs(path) || filepath.VolumeName(path) != "" {
+		return false
+	}
+	clean := filepath.Clean(path)
+	return clean != "." && clean != ".." && !strings.HasPrefix(clean, ".."+string(filepath.Separator))
+}
+
+// albumDir returns the folder for album, relative to the output directory:
+// its entry in the path map if it has one, or its FolderDate or creation
+// date, formatted with --date-format, followed by its title, inside
+// album.Folder, otherwise. Albums without a creation date, such as search
+// results, are named after their title alone, and albums without a title
+// are named after their ID.
+func (fe *FlickrExporter) albumDir(album Album) string {
+	if path, ok := fe.pathMap[album.ID]; ok {
+		return filepath.Clean(path)
+	}
+
+	// Leading and trailing spaces are trimmed, since some filesystems
+	// reject or mangle them. A title of "." or ".." would name the folder
+	// the album is in, or the one above it.
+	name := strings.TrimSpace(fe.folderName(album.Title))
+	if name == "" || name == "." || name == ".." {
+		name = strings.TrimSpace(fe.folderName("Untitled " + album.ID))
+	}
+	date := album.DateCreated
+	if !album.FolderDate.IsZero() {
+		date = album.FolderDate
+	}
+	if !date.IsZero() {
+		name = fe.withoutSpaces(date.Format(fe.dateFormat)+fe.pathSeparator) + name
+	}
+	return filepath.Join(album.Folder, truncateName(name, fe.maxFolderNameLength))
+}
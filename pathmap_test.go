@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAlbumDirUntitled(t *testing.T) {
+	created := time.Date(2019, 7, 4, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		fe      FlickrExporter
+		title   string
+		created time.Time
+		want    string
+	}{
+		{"titled", FlickrExporter{}, "Beach", created, "2019-07-04 Beach"},
+		{"empty", FlickrExporter{}, "", created, "2019-07-04 Untitled 72157600000000001"},
+		{"whitespace", FlickrExporter{}, " \t\n ", created, "2019-07-04 Untitled 72157600000000001"},
+		{"trimmed", FlickrExporter{}, "  Beach  ", created, "2019-07-04 Beach"},
+		{"undated", FlickrExporter{}, "", time.Time{}, "Untitled 72157600000000001"},
+		{"current folder", FlickrExporter{}, ".", time.Time{}, "Untitled 72157600000000001"},
+		{"parent folder", FlickrExporter{}, "..", time.Time{}, "Untitled 72157600000000001"},
+		{"spaces replaced to nothing", FlickrExporter{replaceSpaces: "_"}, "   ", created, "2019-07-04_Untitled_72157600000000001"},
+		{"emoji with ASCII filenames", FlickrExporter{asciiFilenames: true}, "🌅", created, "2019-07-04 _"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fe := tt.fe
+			fe.dateFormat = defaultDateFormat
+			fe.pathSeparator = " "
+			album := Album{ID: "72157600000000001", Title: tt.title, DateCreated: tt.created}
+			if got := fe.albumDir(album); got != tt.want {
+				t.Errorf("albumDir(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlbumDirInFolder(t *testing.T) {
+	fe := &FlickrExporter{dateFormat: defaultDateFormat, pathSeparator: " "}
+	album := Album{ID: "1", Title: "..", Folder: filepath.Join("Travel", "Europe")}
+	if got, want := fe.albumDir(album), filepath.Join("Travel", "Europe", "Untitled 1"); got != want {
+		t.Errorf("albumDir = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/masci/flickr.v3"
+	"gopkg.in/masci/flickr.v3/photosets"
+)
+
+// photoInfoExtras are the extras requested when listing photos for their
+// info, so that it doesn't have to be fetched for each photo with
+// flickr.photos.getInfo.
+const photoInfoExtras = "description,license,date_upload,date_taken,owner_name,tags,machine_tags,views"
+
+// listedInfo is a photo's info, from the photoInfoExtras of a listing.
+type listedInfo struct {
+	Owner       string `xml:"owner,attr"`
+	OwnerName   string `xml:"ownername,attr"`
+	Description string `xml:"description"`
+	License     string `xml:"license,attr"`
+	DateUpload  int64  `xml:"dateupload,attr"`
+	DateTaken   string `xml:"datetaken,attr"`
+	Tags        string `xml:"tags,attr"`
+	MachineTags string `xml:"machine_tags,attr"`
+	Views       int    `xml:"views,attr"`
+}
+
+// AlbumPhotosResponse represents the response from flickr.photosets.getPhotos,
+// with the extras photosets.PhotosListResponse leaves out.
+type AlbumPhotosResponse struct {
+	flickr.BasicResponse
+	Photoset struct {
+		Owner   string           `xml:"owner,attr"`
+		Page    int              `xml:"page,attr"`
+		Pages   int              `xml:"pages,attr"`
+		Perpage int              `xml:"perpage,attr"`
+		Total   int              `xml:"total,attr"`
+		Photos  []AlbumPhotoItem `xml:"photo"`
+	} `xml:"photoset"`
+}
+
+type AlbumPhotoItem struct {
+	photosets.Photo
+	listedInfo
+}
+
+// listingExtras returns extras, the extras a listing needs for its own
+// sake, plus photoInfoExtras if the listed photos' info is needed and can
+// come from the listing. Notes and safety levels are only given by
+// flickr.photos.getInfo, so the extras would be wasted if they're needed.
+func (fe *FlickrExporter) listingExtras(extras string) string {
+	if fe.noMetadata || fe.includeNotes || fe.filtersSafety() {
+		return extras
+	}
+	return extras + "," + photoInfoExtras
+}
+
+// setListedInfo fills in photo's info from its listing, if it was listed
+// with photoInfoExtras. ownerID is the owner's NSID, for listings that give
+// it once for all their photos rather than for each.
+func (fe *FlickrExporter) setListedInfo(photo *Photo, info listedInfo, ownerID string) {
+	if info.Owner != "" {
+		ownerID = info.Owner
+	}
+	// Flickr always gives the upload date of photos listed with it
+	if info.DateUpload == 0 || ownerID == "" {
+		return
+	}
+
+	photo.OwnerID = ownerID
+	photo.Owner = info.OwnerName
+	photo.Description = info.Description
+	photo.DateUploaded = time.Unix(info.DateUpload, 0)
+	if info.DateTaken != "" {
+		if parsed, err := time.Parse("2006-01-02 15:04:05", info.DateTaken); err == nil {
+			photo.DateTaken = parsed
+		}
+	}
+	photo.License, _ = lookupLicense(info.License)
+	photo.Views = info.Views
+	// Listings only give tags normalized, e.g. "newyork" for "New York", so
+	// photos with tags need their info fetched for the tags as entered,
+	// unless the normalized tags will do.
+	if fe.listedTags {
+		photo.MachineTags = strings.Fields(info.MachineTags)
+		photo.Tags = nil
+		for _, tag := range strings.Fields(info.Tags) {
+			// Machine tags may be listed among the tags too.
+			if !isMachineTag(tag) && !slices.Contains(photo.MachineTags, tag) {
+				photo.Tags = append(photo.Tags, tag)
+			}
+		}
+		photo.InfoListed = true
+	} else {
+		photo.InfoListed = info.Tags == "" && info.MachineTags == ""
+	}
+}
+
+// needsPhotoInfo reports whether photo's info must be fetched with
+// flickr.photos.getInfo, because its listing didn't give everything that's
+// needed.
+func (fe *FlickrExporter) needsPhotoInfo(photo Photo) bool {
+	return !photo.InfoListed || photo.NoOriginal || fe.includeNotes || fe.filtersSafety()
+}
+
+// listedPhotoInfo returns photo's info as given by its listing, like
+// getPhotoInfo. The owner's real name is looked up once per owner, since
+// listings only give their username.
+func (fe *FlickrExporter) listedPhotoInfo(photo Photo) Photo {
+	info := Photo{
+		ID:           photo.ID,
+		PageURL:      photoPageURL(photo.OwnerID, photo.ID),
+		Owner:        photo.Owner,
+		Description:  photo.Description,
+		Tags:         photo.Tags,
+		MachineTags:  photo.MachineTags,
+		DateTaken:    photo.DateTaken,
+		DateUploaded: photo.DateUploaded,
+		License:      photo.License,
+		Views:        photo.Views,
+	}
+	if name, err := fe.ownerName(photo.OwnerID); err == nil {
+		info.Owner = name
+	} else if fe.verbose {
+		fe.logf("  Could not look up the name of user %s, using their username: %v\n", photo.OwnerID, err)
+	}
+	return info
+}
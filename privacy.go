@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Privacy levels accepted by --privacy.
+const (
+	privacyAny     = "any"
+	privacyPublic  = "public"
+	privacyPrivate = "private"
+	privacyFriends = "friends"
+	privacyFamily  = "family"
+)
+
+// Visibility describes who can see a photo on Flickr.
+type Visibility struct {
+	IsPublic bool
+	IsFriend bool
+	IsFamily bool
+}
+
+// Level returns a short description of who can see the photo, used when
+// reporting how many photos were exported at each privacy level.
+func (v Visibility) Level() string {
+	switch {
+	case v.IsPublic:
+		return "public"
+	case v.IsFriend && v.IsFamily:
+		return "friends & family"
+	case v.IsFriend:
+		return "friends"
+	case v.IsFamily:
+		return "family"
+	default:
+		return "private"
+	}
+}
+
+func validatePrivacy(privacy string) error {
+	switch privacy {
+	case privacyAny, privacyPublic, privacyPrivate, privacyFriends, privacyFamily:
+		return nil
+	default:
+		return fmt.Errorf("invalid privacy level %q (must be one of: any, public, private, friends, family)", privacy)
+	}
+}
+
+// matchesPrivacy reports whether a photo with visibility v should be exported
+// under the given --privacy level. "friends" and "family" match non-public
+// photos visible to friends or family respectively.
+func matchesPrivacy(v Visibility, privacy string) bool {
+	switch privacy {
+	case privacyPublic:
+		return v.IsPublic
+	case privacyPrivate:
+		return !v.IsPublic && !v.IsFriend && !v.IsFamily
+	case privacyFriends:
+		return !v.IsPublic && v.IsFriend
+	case privacyFamily:
+		return !v.IsPublic && v.IsFamily
+	default:
+		return true
+	}
+}
+
+// privacyFilterParam returns the value of the privacy_filter API parameter
+// that selects photos at the given privacy level, or "" if the level can't be
+// expressed as a single filter.
+func privacyFilterParam(privacy string) string {
+	switch privacy {
+	case privacyPublic:
+		return "1"
+	case privacyPrivate:
+		return "5"
+	default:
+		return ""
+	}
+}
+
+// privacyTally counts exported photos by privacy level. It is safe for
+// concurrent use.
+type privacyTally struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (t *privacyTally) add(v Visibility) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.counts == nil {
+		t.counts = make(map[string]int)
+	}
+	t.counts[v.Level()]++
+}
+
+func (t *privacyTally) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var levels []string
+	for level := range t.counts {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+
+	var parts []string
+	for _, level := range levels {
+		parts = append(parts, fmt.Sprintf("%s: %d", level, t.counts[level]))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+	"golang.org/x/term"
+)
+
+// progressReporter renders a live progress bar covering every photo in the
+// export. Its methods are safe for concurrent use, and are no-ops on a nil
+// *progressReporter so callers needn't check whether progress is enabled.
+type progressReporter struct {
+	mu      sync.Mutex
+	bar     *progressbar.ProgressBar
+	total   int
+	album   string
+	bytes   int64
+	started time.Time
+	done    bool
+	// timeLeft is the estimated time left, or zero if there's no
+	// estimate.
+	timeLeft time.Duration
+}
+
+// newProgressReporter returns a progress reporter, or nil if stdout isn't a
+// terminal and so can't display one.
+func newProgressReporter() *progressReporter {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return nil
+	}
+
+	return &progressReporter{
+		bar: progressbar.NewOptions(0,
+			progressbar.OptionSetWriter(os.Stdout),
+			progressbar.OptionShowCount(),
+			progressbar.OptionShowIts(),
+			progressbar.OptionSetItsString("photos"),
+			progressbar.OptionSetPredictTime(false),
+			progressbar.OptionFullWidth(),
+			progressbar.OptionThrottle(100*time.Millisecond),
+		),
+		started: time.Now(),
+	}
+}
+
+// addTotal adds n photos to the number the bar counts toward.
+func (p *progressReporter) addTotal(n int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total += n
+	p.bar.ChangeMax(p.total)
+	p.done = false
+}
+
+// setAlbum shows title as the album currently being exported.
+func (p *progressReporter) setAlbum(title string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.album = title
+	p.describe()
+}
+
+// setTimeLeft shows d as the estimated time left, or hides the estimate if d
+// is zero.
+func (p *progressReporter) setTimeLeft(d time.Duration) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.timeLeft = d
+	p.describe()
+}
+
+// addBytes records n bytes downloaded, for the transfer rate display.
+func (p *progressReporter) addBytes(n int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bytes += n
+}
+
+// photoDone advances the bar by one photo, whether it was downloaded,
+// skipped, or failed.
+func (p *progressReporter) photoDone() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.describe()
+	_ = p.bar.Add(1)
+}
+
+// fprintf prints a message to w above the bar without garbling it.
+func (p *progressReporter) fprintf(w io.Writer, format string, args ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done {
+		fmt.Fprintf(w, format, args...)
+		return
+	}
+	_ = p.bar.Clear()
+	fmt.Fprintf(w, format, args...)
+	_ = p.bar.RenderBlank()
+}
+
+func (p *progressReporter) finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done {
+		return
+	}
+	p.done = true
+	_ = p.bar.Finish()
+	fmt.Println()
+}
+
+// describe updates the bar's description; p.mu must be held.
+func (p *progressReporter) describe() {
+	rate := float64(p.bytes) / time.Since(p.started).Seconds()
+	if p.timeLeft > 0 {
+		p.bar.Describe(fmt.Sprintf("%s (%.1f MB/s, about %s left)", p.album, rate/1e6, p.timeLeft))
+		return
+	}
+	p.bar.Describe(fmt.Sprintf("%s (%.1f MB/s)", p.album, rate/1e6))
+}
+
+// progressInterval is how often overall progress is logged during an export,
+// if the progress bar isn't shown.
+const progressInterval = 30 * time.Second
+
+// rateSampleInterval is how often the rate photos are finished at is
+// sampled, for estimating the time left.
+const rateSampleInterval = 5 * time.Second
+
+// rateWindow is the time constant of the moving average of that rate: the
+// estimate mostly reflects the photos finished in the last minute or so.
+const rateWindow = time.Minute
+
+// photoTally counts the photos finished out of all those known to be in the
+// export, and the rate they're finished at, for reporting overall progress.
+// It is shared with workers.
+type photoTally struct {
+	mu    sync.Mutex
+	total int
+	done  int
+	// rate is an exponential moving average of photos finished per second,
+	// updated by sample. It's negative until two samples have been taken.
+	rate        float64
+	sampled     time.Time
+	sampledDone int
+}
+
+func newPhotoTally() *photoTally {
+	return &photoTally{rate: -1}
+}
+
+func (t *photoTally) addTotal(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.total += n
+}
+
+func (t *photoTally) photoDone() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done++
+}
+
+// sample updates the moving average rate with the photos finished since the
+// previous sample.
+func (t *photoTally) sample(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.sampled.IsZero() {
+		elapsed := now.Sub(t.sampled)
+		if elapsed <= 0 {
+			return
+		}
+		rate := float64(t.done-t.sampledDone) / elapsed.Seconds()
+		if t.rate < 0 {
+			t.rate = rate
+		} else {
+			weight := 1 - math.Exp(-elapsed.Seconds()/rateWindow.Seconds())
+			t.rate += weight * (rate - t.rate)
+		}
+	}
+	t.sampled = now
+	t.sampledDone = t.done
+}
+
+// timeLeft estimates how long the remaining photos will take at the recent
+// rate. It returns false if there's no estimate yet, or nothing is left.
+func (t *photoTally) timeLeft() (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timeLeftLocked()
+}
+
+// timeLeftLocked is timeLeft; t.mu must be held.
+func (t *photoTally) timeLeftLocked() (time.Duration, bool) {
+	left := t.total - t.done
+	if t.rate <= 0 || left <= 0 {
+		return 0, false
+	}
+	return time.Duration(float64(left) / t.rate * float64(time.Second)).Round(time.Second), true
+}
+
+// String describes the progress so far, e.g. "120/3400 photos (3%), about
+// 1h2m0s left".
+func (t *photoTally) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// The total can fall behind while albums are being listed.
+	total := max(t.total, t.done)
+	if total == 0 {
+		return "0 photos"
+	}
+	s := fmt.Sprintf("%d/%d photos (%d%%)", t.done, total, t.done*100/total)
+	if left, ok := t.timeLeftLocked(); ok {
+		s += fmt.Sprintf(", about %s left", left)
+	}
+	return s
+}
+
+// addToTotal adds n photos to the number the export is expected to finish.
+// n may be negative, to correct an earlier estimate.
+func (fe *FlickrExporter) addToTotal(n int) {
+	if n == 0 {
+		return
+	}
+	fe.progress.addTotal(n)
+	fe.tally.addTotal(n)
+}
+
+// photoDone records that a photo has been finished, whether it was
+// downloaded, skipped, or failed.
+func (fe *FlickrExporter) photoDone() {
+	fe.progress.photoDone()
+	fe.tally.photoDone()
+}
+
+// reportProgress tracks the rate photos are finished at, and logs the
+// overall progress every interval, until the returned function is called.
+// While the progress bar is shown, which has the same counts, the estimated
+// time left is shown on it instead. Nothing is reported in quiet mode.
+func (fe *FlickrExporter) reportProgress(interval time.Duration) (stop func()) {
+	if fe.quiet {
+		return func() {}
+	}
+
+	fe.tally.sample(time.Now())
+	ticker := time.NewTicker(rateSampleInterval)
+	done := make(chan struct{})
+	go func() {
+		lastLogged := time.Now()
+		for {
+			select {
+			case now := <-ticker.C:
+				fe.tally.sample(now)
+				if fe.progress != nil {
+					left, _ := fe.tally.timeLeft()
+					fe.progress.setTimeLeft(left)
+				} else if now.Sub(lastLogged) >= interval {
+					fe.logf("Progress: %s\n", fe.tally)
+					lastLogged = now
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// logf prints an informational message. These are suppressed while the
+// progress bar is shown, and in quiet mode, but still written to the run log.
+func (fe *FlickrExporter) logf(format string, args ...any) {
+	if fe.progress != nil || fe.quiet {
+		fe.runLog.printf(format, args...)
+		return
+	}
+	fmt.Fprintf(fe.logOutput, format, args...)
+}
+
+// warnf prints a warning or error message, which is always shown. It's
+// written to stderr, so that it isn't lost when stdout is redirected.
+func (fe *FlickrExporter) warnf(format string, args ...any) {
+	fe.runLog.printf(format, args...)
+	if fe.progress != nil {
+		fe.progress.fprintf(os.Stderr, format, args...)
+		return
+	}
+	fmt.Fprintf(os.Stderr, format, args...)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// prunableExtensions are the extensions of files that pruning considers:
+// the photo and video formats Flickr stores, and temporary files left by an
+// interrupted copy. Anything else in an album folder is left alone.
+var prunableExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".tif": true,
+	".tiff": true, ".heic": true, ".webp": true, ".mp4": true, ".mov": true,
+	".m4v": true, ".avi": true, ".3gp": true, ".mpg": true, ".wmv": true,
+	".tmp": true,
+}
+
+// exportedFiles tracks the album folders written to during an export and the
+// photos in them, so that files in those folders which are no longer on
+// Flickr can be found. It is safe for concurrent use, and its methods are
+// no-ops on a nil *exportedFiles.
+type exportedFiles struct {
+	mu    sync.Mutex
+	dirs  map[string]bool
+	files map[string]bool
+}
+
+func newExportedFiles() *exportedFiles {
+	return &exportedFiles{
+		dirs:  make(map[string]bool),
+		files: make(map[string]bool),
+	}
+}
+
+func (e *exportedFiles) addDir(dir string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.dirs[filepath.Clean(dir)] = true
+}
+
+func (e *exportedFiles) addFile(path string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.files[filepath.Clean(path)] = true
+}
+
+// OrphanedFiles returns the photo files in the album folders written to by
+// the last export that don't belong to any photo in it, such as photos that
+// have since been removed from their album on Flickr. Folders of albums that
+// weren't exported, including albums deleted from Flickr, aren't checked.
+func (fe *FlickrExporter) OrphanedFiles() ([]string, error) {
+	e := fe.exported
+	if e == nil {
+		return nil, fmt.Errorf("orphaned files are only tracked if pruning is enabled")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var orphans []string
+	for dir := range e.dirs {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			// Removed after being archived
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") ||
+				!prunableExtensions[strings.ToLower(filepath.Ext(name))] {
+				continue
+			}
+			path := filepath.Join(dir, name)
+			if !e.files[path] {
+				orphans = append(orphans, path)
+			}
+		}
+	}
+
+	sort.Strings(orphans)
+	return orphans, nil
+}
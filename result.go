@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// resultSchemaVersion is the version of the --json result's schema. It's
+// increased when a field is removed or renamed, or its meaning changes; new
+// fields can be added without changing it.
+const resultSchemaVersion = 1
+
+// Statuses of the --json result, matching the exit code.
+const (
+	resultOK      = "ok"
+	resultPartial = "partial"
+	resultFailed  = "failed"
+)
+
+// runResult is the single JSON object printed to stdout at the end of an
+// export with --json, summarizing the run.
+type runResult struct {
+	SchemaVersion int       `json:"schema_version"`
+	Command       string    `json:"command"`
+	Status        string    `json:"status"`
+	ExitCode      int       `json:"exit_code"`
+	Started       time.Time `json:"started"`
+	Finished      time.Time `json:"finished"`
+	Duration      float64   `json:"duration_seconds"`
+	// BytesDownloaded counts the photo files downloaded, before their
+	// metadata was written.
+	BytesDownloaded int64 `json:"bytes_downloaded"`
+	eventCounts
+	Albums   []albumResult  `json:"albums"`
+	Failures []photoFailure `json:"failures"`
+	// Errors are the errors reported for each album, collection, or
+	// export as a whole, including those that stopped it before any
+	// photos were exported.
+	Errors []string `json:"errors"`
+}
+
+// albumResult is the outcome of exporting one album, or the photos that
+// aren't in any album.
+type albumResult struct {
+	ID    string `json:"id,omitempty"`
+	Title string `json:"title"`
+	Path  string `json:"path"`
+	eventCounts
+}
+
+// photoFailure is a photo that couldn't be exported.
+type photoFailure struct {
+	AlbumID string `json:"album_id,omitempty"`
+	Album   string `json:"album"`
+	PhotoID string `json:"photo_id"`
+	Path    string `json:"path"`
+	Error   string `json:"error"`
+}
+
+// result returns the result of the run so far. The lists are never nil, so
+// they're written as empty arrays rather than null.
+func (l *eventLog) result() runResult {
+	r := runResult{
+		SchemaVersion: resultSchemaVersion,
+		Albums:        []albumResult{},
+		Failures:      []photoFailure{},
+		Errors:        []string{},
+		Finished:      time.Now().UTC(),
+	}
+	if l == nil {
+		r.Started = r.Finished
+		return r
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r.Started = l.started.UTC()
+	r.Duration = r.Finished.Sub(l.started).Seconds()
+	r.BytesDownloaded = l.bytes
+	r.eventCounts = l.total
+	r.Albums = append(r.Albums, l.finished...)
+	r.Failures = append(r.Failures, l.failures...)
+	return r
+}
+
+// printResult prints the --json result of command, which is about to exit
+// with code after the given errors.
+func printResult(exporter *FlickrExporter, command string, code int, errs []error) {
+	r := exporter.events.result()
+	r.Command = command
+	r.ExitCode = code
+	switch code {
+	case exitOK:
+		r.Status = resultOK
+	case exitPartial:
+		r.Status = resultPartial
+	default:
+		r.Status = resultFailed
+	}
+	for _, err := range errs {
+		r.Errors = append(r.Errors, err.Error())
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		errorf("Error writing the JSON result: %v\n", err)
+	}
+}
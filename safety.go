@@ -0,0 +1,58 @@
+package main
+
+import "fmt"
+
+// Safety levels accepted by --safety-level, from least to most restricted.
+const (
+	safetySafe       = "safe"
+	safetyModerate   = "moderate"
+	safetyRestricted = "restricted"
+)
+
+// safetyLevels maps each safety level name to the value of the safety_level
+// attribute Flickr returns for photos at that level.
+var safetyLevels = map[string]int{
+	safetySafe:       0,
+	safetyModerate:   1,
+	safetyRestricted: 2,
+}
+
+func validateSafetyLevel(level string) error {
+	if _, ok := safetyLevels[level]; !ok {
+		return fmt.Errorf("invalid safety level %q (must be one of: safe, moderate, restricted)", level)
+	}
+	return nil
+}
+
+// safeSearchParam returns the value of the safe_search API parameter that
+// limits results to photos at or below the given safety level, or "" if no
+// photos are excluded.
+func safeSearchParam(level string) string {
+	switch level {
+	case safetySafe:
+		return "1"
+	case safetyModerate:
+		return "2"
+	default:
+		return ""
+	}
+}
+
+// filtersSafety reports whether any photos are excluded by --safety-level.
+func (fe *FlickrExporter) filtersSafety() bool {
+	return fe.safetyLevel != safetyRestricted
+}
+
+// allowsSafety reports whether photo is at or below the --safety-level
+// limit. photo.SafetyLevel is only known once its info has been fetched. If
+// the photo is excluded, it's counted for the end-of-export report.
+func (fe *FlickrExporter) allowsSafety(photo Photo) bool {
+	if photo.SafetyLevel <= safetyLevels[fe.safetyLevel] {
+		return true
+	}
+	fe.safetyExcluded.Add(1)
+	if fe.verbose {
+		fe.logf("  Skipping (above safety level %s): %s\n", fe.safetyLevel, photo.Filename)
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Searches export the authenticated user's photos matching a
+// flickr.photos.search query, into a folder named after the query.
+
+// Tag modes accepted by --tag-mode.
+const (
+	tagModeAny = "any"
+	tagModeAll = "all"
+)
+
+// searchAlbumPrefix starts the title of the folder search results are
+// exported to.
+const searchAlbumPrefix = "Search - "
+
+// SearchQuery holds the criteria passed to flickr.photos.search. Empty fields
+// don't limit the search.
+type SearchQuery struct {
+	// Text matches photo titles, descriptions, and tags.
+	Text string
+	// Tags matches photos with any of these tags, or with all of them if
+	// TagMode is "all".
+	Tags    []string
+	TagMode string
+	// MachineTags matches photos with any of these machine tags, such as
+	// "geo:locality=paris" or "camera:make=".
+	MachineTags []string
+	// MinTaken and MaxTaken bound when photos were taken, and MinUploaded
+	// and MaxUploaded when they were uploaded. All are inclusive.
+	MinTaken    time.Time
+	MaxTaken    time.Time
+	MinUploaded time.Time
+	MaxUploaded time.Time
+}
+
+// IsEmpty reports whether the query has no criteria, and so would match
+// every photo.
+func (q SearchQuery) IsEmpty() bool {
+	return q.Text == "" && len(q.Tags) == 0 && len(q.MachineTags) == 0 &&
+		q.MinTaken.IsZero() && q.MaxTaken.IsZero() &&
+		q.MinUploaded.IsZero() && q.MaxUploaded.IsZero()
+}
+
+// String describes the query, e.g. `beach, tags sunset+sea, taken 2020-01-01
+// to 2020-12-31`. It names the folder the search is exported to.
+func (q SearchQuery) String() string {
+	var parts []string
+	if q.Text != "" {
+		parts = append(parts, q.Text)
+	}
+	if len(q.Tags) > 0 {
+		sep := ","
+		if q.TagMode == tagModeAll {
+			sep = "+"
+		}
+		parts = append(parts, "tags "+strings.Join(q.Tags, sep))
+	}
+	if len(q.MachineTags) > 0 {
+		parts = append(parts, "machine tags "+strings.Join(q.MachineTags, ","))
+	}
+	if r := dateRange(q.MinTaken, q.MaxTaken); r != "" {
+		parts = append(parts, "taken "+r)
+	}
+	if r := dateRange(q.MinUploaded, q.MaxUploaded); r != "" {
+		parts = append(parts, "uploaded "+r)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// dateRange describes the dates between min and max, either of which may be
+// zero, or returns "" if both are.
+func dateRange(min, max time.Time) string {
+	const layout = "2006-01-02"
+	switch {
+	case !min.IsZero() && !max.IsZero():
+		return min.Format(layout) + " to " + max.Format(layout)
+	case !min.IsZero():
+		return "from " + min.Format(layout)
+	case !max.IsZero():
+		return "until " + max.Format(layout)
+	default:
+		return ""
+	}
+}
+
+// setArgs sets the flickr.photos.search arguments for the query's criteria.
+func (q SearchQuery) setArgs(args url.Values) {
+	// Taken dates are compared with the photo's EXIF date, which has no
+	// time zone, so they're given as MySQL datetimes. Upload dates are Unix
+	// timestamps.
+	const takenLayout = "2006-01-02 15:04:05"
+
+	if q.Text != "" {
+		args.Set("text", q.Text)
+	}
+	if len(q.Tags) > 0 {
+		args.Set("tags", strings.Join(q.Tags, ","))
+		if q.TagMode == tagModeAll {
+			args.Set("tag_mode", "all")
+		}
+	}
+	if len(q.MachineTags) > 0 {
+		args.Set("machine_tags", strings.Join(q.MachineTags, ","))
+	}
+	if !q.MinTaken.IsZero() {
+		args.Set("min_taken_date", q.MinTaken.Format(takenLayout))
+	}
+	if !q.MaxTaken.IsZero() {
+		args.Set("max_taken_date", q.MaxTaken.Format(takenLayout))
+	}
+	if !q.MinUploaded.IsZero() {
+		args.Set("min_upload_date", fmt.Sprintf("%d", q.MinUploaded.Unix()))
+	}
+	if !q.MaxUploaded.IsZero() {
+		args.Set("max_upload_date", fmt.Sprintf("%d", q.MaxUploaded.Unix()))
+	}
+}
+
+func validateTagMode(mode string) error {
+	switch mode {
+	case tagModeAny, tagModeAll:
+		return nil
+	default:
+		return fmt.Errorf("invalid tag mode %q (must be one of: any, all)", mode)
+	}
+}
+
+// parseSearchDate interprets the value of a search date flag: a date
+// (YYYY-MM-DD, in local time) or an RFC 3339 timestamp. A date given as the
+// end of a range means the end of that day, so that the range includes it.
+func parseSearchDate(flag, value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1).Add(-time.Second)
+		}
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --%s value %q (must be a date like 2024-01-31 or an RFC 3339 timestamp)", flag, value)
+}
+
+// ExportSearch exports the user's photos matching query into a
+// folder named after it.
+func (fe *FlickrExporter) ExportSearch(query SearchQuery) error {
+	defer fe.Close()
+
+	if query.IsEmpty() {
+		return fmt.Errorf("a search needs at least one criterion")
+	}
+	if query.TagMode == "" {
+		query.TagMode = tagModeAny
+	}
+	if err := validateTagMode(query.TagMode); err != nil {
+		return err
+	}
+
+	photos, err := fe.searchPhotos(query)
+	if err != nil {
+		return fmt.Errorf("failed to search photos: %w", err)
+	}
+	if len(photos) == 0 {
+		fe.logf("No photos match the search\n")
+		return nil
+	}
+
+	// Search results have no creation date to prefix the folder with, so
+	// the folder keeps the same name each time the search is exported.
+	album := Album{Title: searchAlbumPrefix + query.String(), Photos: photos}
+	if errors := fe.runExport([]Album{album}, false); len(errors) > 0 {
+		return errors[0]
+	}
+	return nil
+}
+
+// searchPhotos returns the user's photos matching query.
+func (fe *FlickrExporter) searchPhotos(query SearchQuery) ([]Photo, error) {
+	args := url.Values{}
+	args.Set("user_id", fe.userID)
+	query.setArgs(args)
+	if safeSearch := safeSearchParam(fe.safetyLevel); safeSearch != "" {
+		args.Set("safe_search", safeSearch)
+	}
+
+	photos, err := fe.listPhotos("flickr.photos.search", args)
+	if err != nil {
+		return nil, err
+	}
+
+	fe.logf("Found %d photos matching %s\n", len(photos), query)
+	return photos, nil
+}
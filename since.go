@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// lastRunFilename names the file in the output directory recording when the
+// last successful export of all photos started.
+const lastRunFilename = ".flickr-exporter-last-run"
+
+// parseSince interprets a --since value: a date (YYYY-MM-DD, in local time),
+// an RFC 3339 timestamp, or "last-run" to use the time recorded by the
+// previous successful export to outputDir. It returns the zero time if
+// "last-run" is given but no run has been recorded yet.
+func parseSince(value, outputDir string) (time.Time, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return time.Time{}, nil
+	case "last-run", "last run", "lastrun":
+		if outputDir == streamOutput {
+			return time.Time{}, fmt.Errorf("--since last-run can't be used when streaming the export to stdout (--output -), since runs are recorded in the output directory")
+		}
+		return readLastRun(outputDir)
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since value %q (must be a date like 2024-01-31, an RFC 3339 timestamp, or \"last-run\")", value)
+}
+
+// readLastRun returns the time recorded in outputDir by writeLastRun, or the
+// zero time if there is none.
+func readLastRun(outputDir string) (time.Time, error) {
+	data, err := os.ReadFile(filepath.Join(outputDir, lastRunFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read last run time: %w", err)
+	}
+
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid last run time in %s: %w", lastRunFilename, err)
+	}
+	return t, nil
+}
+
+// writeLastRun records t in outputDir for a later --since last-run.
+func writeLastRun(outputDir string, t time.Time) error {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outputDir, lastRunFilename), []byte(t.Format(time.RFC3339)+"\n"), 0644)
+}
+
+// isNewPhoto reports whether photo was uploaded since the --since time, and
+// so should be downloaded. Every photo is new if --since wasn't given.
+func (fe *FlickrExporter) isNewPhoto(photo Photo) bool {
+	return fe.newPhotoIDs == nil || fe.newPhotoIDs[photo.ID]
+}
+
+// hasNewPhotos reports whether any of photos should be downloaded.
+func (fe *FlickrExporter) hasNewPhotos(photos []Photo) bool {
+	for _, photo := range photos {
+		if fe.isNewPhoto(photo) {
+			return true
+		}
+	}
+	return false
+}
+
+// saveLastRun records started as the time of the last successful export, so
+// the next run can use --since last-run.
+func (fe *FlickrExporter) saveLastRun(started time.Time) {
+	if err := writeLastRun(fe.outputDir, started); err != nil {
+		fe.warnf("Warning: Failed to record last run time: %v\n", err)
+	}
+}
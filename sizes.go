@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/masci/flickr.v3"
+)
+
+// Photo sizes accepted by --size.
+const (
+	sizeOriginal  = "original"
+	sizeLarge2048 = "large2048"
+	sizeLarge1600 = "large1600"
+	sizeLarge1024 = "large1024"
+	sizeMedium800 = "medium800"
+	sizeMedium640 = "medium640"
+	sizeMedium500 = "medium500"
+)
+
+// sizeLabels maps each size other than the original to its label in
+// flickr.photos.getSizes responses.
+var sizeLabels = map[string]string{
+	sizeLarge2048: "Large 2048",
+	sizeLarge1600: "Large 1600",
+	sizeLarge1024: "Large",
+	sizeMedium800: "Medium 800",
+	sizeMedium640: "Medium 640",
+	sizeMedium500: "Medium",
+}
+
+func validateSize(size string) error {
+	if _, ok := sizeLabels[size]; ok || size == sizeOriginal {
+		return nil
+	}
+	return fmt.Errorf("invalid size %q (must be one of: original, large2048, large1600, large1024, medium800, medium640, medium500)", size)
+}
+
+// PhotoSizesResponse represents the response from flickr.photos.getSizes
+type PhotoSizesResponse struct {
+	flickr.BasicResponse
+	Sizes []PhotoSize `xml:"sizes>size"`
+}
+
+type PhotoSize struct {
+	Label  string `xml:"label,attr"`
+	Source string `xml:"source,attr"`
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
+}
+
+// sizedFilename returns the name to save a photo under, given the name of its
+// original file, e.g. "123_abc_o.png" becomes "123_abc_large2048.jpg". Sizes
+// other than the original are always JPEGs.
+func (fe *FlickrExporter) sizedFilename(filename string) string {
+	if fe.size == sizeOriginal || filename == "" {
+		return filename
+	}
+	stem := strings.TrimSuffix(filename, filepath.Ext(filename))
+	stem = strings.TrimSuffix(stem, "_o")
+	stem = strings.TrimSuffix(stem, "_largest")
+	return fmt.Sprintf("%s_%s.jpg", stem, fe.size)
+}
+
+// sizedPhoto returns the URL and dimensions of photo at the selected size. If
+// the photo isn't available at that size, because the original is smaller or
+// can't be downloaded, the largest size other than the original is used, so
+// that the file is still a JPEG.
+func (fe *FlickrExporter) sizedPhoto(photo Photo) (PhotoSize, error) {
+	if fe.size == sizeOriginal && !photo.NoOriginal {
+		return PhotoSize{Source: photo.OriginalURL, Width: photo.Width, Height: photo.Height}, nil
+	}
+
+	response := &PhotoSizesResponse{}
+	err := fe.withRetry("getting sizes for "+photo.ID, func() error {
+		response = &PhotoSizesResponse{}
+		return fe.api.Get("flickr.photos.getSizes", url.Values{"photo_id": {photo.ID}}, true, response)
+	})
+	if err != nil {
+		return PhotoSize{}, fmt.Errorf("failed to get sizes for %s: %w", photo.ID, err)
+	}
+
+	// Sizes are listed from smallest to largest.
+	var largest PhotoSize
+	for _, size := range response.Sizes {
+		if size.Label == sizeLabels[fe.size] {
+			return size, nil
+		}
+		if size.Label != "Original" {
+			largest = size
+		}
+	}
+	if largest.Source == "" {
+		return PhotoSize{}, fmt.Errorf("no downloadable size is available for %s", photo.ID)
+	}
+
+	if fe.verbose && !photo.NoOriginal {
+		fe.logf("  %s is smaller than %s; using the largest available size\n", photo.Filename, fe.size)
+	}
+	return largest, nil
+}
+
+// isDownloadable reports whether photo, as listed from an album or search,
+// can be exported. Photos listed without an original are looked up with
+// findOriginal. Photos whose original can't be downloaded, because their
+// owner has disabled downloads, are recorded to be reported at the end of the
+// export, and are only exported if the largest available size is wanted.
+func (fe *FlickrExporter) isDownloadable(photo *Photo) bool {
+	if !photo.NoOriginal || fe.findOriginal(photo) {
+		return true
+	}
+	fe.noOriginal.add(photo.ID, fe.largestAvailable)
+	return fe.largestAvailable
+}
+
+// findOriginal looks up the info of photo, listed without an original, since
+// the original can sometimes be downloaded anyway. If it can, photo is named
+// after it, and findOriginal returns true. The info is fetched once per run
+// either way, so this doesn't cost an extra call for photos downloaded later.
+func (fe *FlickrExporter) findOriginal(photo *Photo) bool {
+	if err := fe.fetchPhotoMetadata(photo); err != nil {
+		if fe.verbose {
+			fe.logf("  Could not look for the original of %s: %v\n", photo.ID, err)
+		}
+		return false
+	}
+	if photo.NoOriginal {
+		return false
+	}
+
+	parts := strings.Split(photo.OriginalURL, "/")
+	photo.Filename = fe.photoFilename(parts[len(parts)-1], photo.Title)
+	return true
+}
+
+// noOriginalFilename marks photo as having no downloadable original, and
+// names it after sizeURL, the URL of a smaller size from its listing, e.g.
+// ".../123_abc_c.jpg" becomes "123_abc_largest.jpg". The largest available
+// size is looked up when it's downloaded.
+func (fe *FlickrExporter) noOriginalFilename(photo *Photo, sizeURL string) {
+	photo.NoOriginal = true
+	if sizeURL == "" {
+		// Not even a smaller size is available to name it after
+		photo.Filename = fe.photoFilename(photo.ID+"_largest.jpg", photo.Title)
+		return
+	}
+
+	parts := strings.Split(sizeURL, "/")
+	name := parts[len(parts)-1]
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	if i := strings.LastIndex(stem, "_"); i > 0 && strings.Count(stem, "_") > 1 {
+		stem = stem[:i]
+	}
+	photo.Filename = fe.photoFilename(stem+"_largest"+ext, photo.Title)
+}
+
+// noOriginalPhotos records the IDs of photos whose original can't be
+// downloaded, and whether a smaller size was downloaded instead, to report at
+// the end of the export. It is safe for concurrent use.
+type noOriginalPhotos struct {
+	mu     sync.Mutex
+	photos map[string]bool
+}
+
+func (n *noOriginalPhotos) add(id string, substituted bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.photos == nil {
+		n.photos = make(map[string]bool)
+	}
+	n.photos[id] = substituted
+}
+
+// ids returns the sorted IDs of the photos recorded with substituted.
+func (n *noOriginalPhotos) ids(substituted bool) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var ids []string
+	for id, s := range n.photos {
+		if s == substituted {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
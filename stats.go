@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/masci/flickr.v3"
+)
+
+// flickrXMPNamespace is the URI of the XMP-flickr namespace that photo stats
+// and machine tags are written to. ExifTool only knows about it from the
+// config file written by useFlickrXMPConfig.
+const flickrXMPNamespace = "https://github.com/cdzombak/flickr-exporter/ns/1.0/"
+
+// flickrXMPConfig is an ExifTool config file defining the XMP-flickr tags.
+// %s is replaced with the path of the user's own config file, which is
+// loaded first so that it still applies.
+const flickrXMPConfig = `# Written by flickr-exporter; changes will be overwritten.
+my $userConfig = %s;
+do $userConfig if $userConfig ne '' and -e $userConfig;
+
+%%Image::ExifTool::UserDefined::flickr = (
+    GROUPS    => { 0 => 'XMP', 1 => 'XMP-flickr', 2 => 'Image' },
+    NAMESPACE => { 'flickr' => '%s' },
+    WRITABLE  => 'string',
+    Views     => { Writable => 'integer' },
+    Favorites => { Writable => 'integer' },
+    MachineTags => { List => 'Bag' },
+);
+$Image::ExifTool::UserDefined{'Image::ExifTool::XMP::Main'}{flickr} = {
+    SubDirectory => { TagTable => 'Image::ExifTool::UserDefined::flickr' },
+};
+1;
+`
+
+var flickrXMPConfigOnce sync.Once
+var flickrXMPConfigErr error
+
+// useFlickrXMPConfig makes exiftool processes started afterward able to write
+// the XMP-flickr tags. go-exiftool can't pass exiftool a config file, so it's
+// written to the user's cache directory and found through $EXIFTOOL_HOME.
+func useFlickrXMPConfig() error {
+	flickrXMPConfigOnce.Do(func() {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			flickrXMPConfigErr = fmt.Errorf("failed to find a directory for the ExifTool config: %w", err)
+			return
+		}
+		dir := filepath.Join(cacheDir, "flickr-exporter", "exiftool")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			flickrXMPConfigErr = fmt.Errorf("failed to create a directory for the ExifTool config: %w", err)
+			return
+		}
+
+		// ExifTool looks for .ExifTool_config in $EXIFTOOL_HOME, or else
+		// in the home directory.
+		var userConfig string
+		if home := os.Getenv("EXIFTOOL_HOME"); home != "" {
+			userConfig = filepath.Join(home, ".ExifTool_config")
+		} else if home, err := os.UserHomeDir(); err == nil {
+			userConfig = filepath.Join(home, ".ExifTool_config")
+		}
+
+		config := fmt.Sprintf(flickrXMPConfig, perlQuote(userConfig), flickrXMPNamespace)
+		if err := os.WriteFile(filepath.Join(dir, ".ExifTool_config"), []byte(config), 0644); err != nil {
+			flickrXMPConfigErr = fmt.Errorf("failed to write the ExifTool config: %w", err)
+			return
+		}
+		flickrXMPConfigErr = os.Setenv("EXIFTOOL_HOME", dir)
+	})
+	return flickrXMPConfigErr
+}
+
+// perlQuote returns s as a single-quoted Perl string.
+func perlQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
+
+// PhotoFavoritesResponse represents the response from
+// flickr.photos.getFavorites
+type PhotoFavoritesResponse struct {
+	flickr.BasicResponse
+	Photo struct {
+		Total int `xml:"total,attr"`
+	} `xml:"photo"`
+}
+
+// getFavoritesCount returns the number of people who have faved a photo.
+func (fe *FlickrExporter) getFavoritesCount(photoID string) (int, error) {
+	response := &PhotoFavoritesResponse{}
+	err := fe.withRetry("getting favorites for "+photoID, func() error {
+		args := url.Values{}
+		args.Set("photo_id", photoID)
+		args.Set("per_page", "1")
+
+		response = &PhotoFavoritesResponse{}
+		return fe.api.Get("flickr.photos.getFavorites", args, true, response)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get favorites for %s: %w", photoID, err)
+	}
+	return response.Photo.Total, nil
+}
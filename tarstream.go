@@ -0,0 +1,131 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// streamOutput is the --output value that streams the export to stdout as a
+// tar archive instead of writing it to a directory.
+const streamOutput = "-"
+
+// tarStream writes exported photos to a tar archive as soon as each has been
+// downloaded and had its metadata written, removing it from the directory it
+// was staged in. It is safe for concurrent use, and a nil *tarStream writes
+// nothing.
+type tarStream struct {
+	mu       sync.Mutex
+	tw       *tar.Writer
+	stageDir string
+}
+
+// add writes the file at path to the archive, named by its path relative to
+// the staging directory, then removes it.
+func (s *tarStream) add(path string) error {
+	if s == nil {
+		return nil
+	}
+	name, err := filepath.Rel(s.stageDir, path)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write to the tar stream: %w", err)
+	}
+	if _, err := io.Copy(s.tw, f); err != nil {
+		return fmt.Errorf("failed to write to the tar stream: %w", err)
+	}
+	// Flushed so that a reader, such as rclone rcat, gets each photo
+	// whole as soon as it's ready.
+	if err := s.tw.Flush(); err != nil {
+		return fmt.Errorf("failed to write to the tar stream: %w", err)
+	}
+	f.Close()
+	return os.Remove(path)
+}
+
+// validateStreamOptions returns an error if opts enables a feature that
+// needs the export to stay on disk, or writes to stdout, which can't be used
+// while streaming it.
+func validateStreamOptions(opts ExporterOptions) error {
+	conflicts := []struct {
+		set  bool
+		flag string
+	}{
+		{opts.HTML, "--html"},
+		{opts.Zip, "--zip"},
+		{len(opts.Catalog) > 0, "--catalog"},
+		{opts.DedupHardlink, "--dedup-hardlink"},
+		{opts.TrackExportedFiles, "--prune"},
+		{opts.CheckSpace, "--check-space"},
+		{opts.KeepOnMetadataError, "--keep-on-metadata-error"},
+		{opts.ReportDuplicates, "--report-duplicates"},
+		{opts.Progress, "--progress"},
+		{opts.OutputFormat == outputFormatJSON, "--output-format json"},
+	}
+	for _, conflict := range conflicts {
+		if conflict.set {
+			return fmt.Errorf("%s can't be used when streaming the export to stdout (--output -)", conflict.flag)
+		}
+	}
+	return nil
+}
+
+// The tar stream and staging directory for --output -, which exit finishes
+// and removes.
+var (
+	stream         *tar.Writer
+	streamStageDir string
+)
+
+// startStream starts streaming the export to stdout, and returns the
+// temporary directory to stage photos in.
+func startStream() (*tar.Writer, string, error) {
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		return nil, "", fmt.Errorf("refusing to write a tar archive to a terminal; redirect or pipe stdout, e.g. to rclone rcat")
+	}
+	dir, err := os.MkdirTemp("", "flickr-exporter-stream-*")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create a directory to stage photos in: %w", err)
+	}
+	stream = tar.NewWriter(os.Stdout)
+	streamStageDir = dir
+	return stream, dir, nil
+}
+
+// exit finishes the tar stream, if the export is being streamed to stdout,
+// then exits with code.
+func exit(code int) {
+	if stream != nil {
+		if err := stream.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error finishing the tar stream: %v\n", err)
+			code = exitFatal
+		}
+		os.RemoveAll(streamStageDir)
+	}
+	os.Exit(code)
+}
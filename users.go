@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/masci/flickr.v3"
+	"gopkg.in/masci/flickr.v3/people"
+)
+
+// currentUser is the user_id Flickr API methods take to mean the
+// authenticated user.
+const currentUser = "me"
+
+// flickrErrUserNotFound is the error code flickr.people.findByUsername and
+// flickr.urls.lookupUser return for users that don't exist.
+const flickrErrUserNotFound = 1
+
+// nsidPattern matches a Flickr user ID (NSID), such as "12345678@N02".
+var nsidPattern = regexp.MustCompile(`^[0-9]+@N[0-9]+$`)
+
+// LookupUserResponse represents the response from flickr.urls.lookupUser
+type LookupUserResponse struct {
+	flickr.BasicResponse
+	User struct {
+		ID string `xml:"id,attr"`
+	} `xml:"user"`
+}
+
+// PersonInfoResponse represents the response from flickr.people.getInfo
+type PersonInfoResponse struct {
+	flickr.BasicResponse
+	Person struct {
+		NSID     string `xml:"nsid,attr"`
+		Username string `xml:"username"`
+		RealName string `xml:"realname"`
+	} `xml:"person"`
+}
+
+// userCache remembers the NSIDs users have been resolved to, and the names
+// of photo owners, so that each is only looked up once per run. A nil
+// *userCache caches nothing.
+type userCache struct {
+	mu    sync.Mutex
+	nsids map[string]string
+	names map[string]string
+}
+
+func newUserCache() *userCache {
+	return &userCache{nsids: make(map[string]string), names: make(map[string]string)}
+}
+
+func (c *userCache) get(identifier string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	nsid, ok := c.nsids[identifier]
+	return nsid, ok
+}
+
+func (c *userCache) put(identifier, nsid string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nsids[identifier] = nsid
+}
+
+func (c *userCache) name(nsid string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name, ok := c.names[nsid]
+	return name, ok
+}
+
+func (c *userCache) putName(nsid, name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.names[nsid] = name
+}
+
+// isUserURL reports whether identifier is the URL of a user's photostream
+// or profile, rather than a username.
+func isUserURL(identifier string) bool {
+	return strings.HasPrefix(identifier, "http://") || strings.HasPrefix(identifier, "https://") ||
+		strings.HasPrefix(identifier, "flickr.com/") || strings.HasPrefix(identifier, "www.flickr.com/")
+}
+
+// resolveUser returns the NSID of the user identified by identifier: an
+// NSID already, currentUser, the URL of their photostream or profile, or
+// their username (screen name).
+func (fe *FlickrExporter) resolveUser(identifier string) (string, error) {
+	if identifier == currentUser || nsidPattern.MatchString(identifier) {
+		return identifier, nil
+	}
+	if nsid, ok := fe.users.get(identifier); ok {
+		return nsid, nil
+	}
+
+	var nsid string
+	var err error
+	if isUserURL(identifier) {
+		nsid, err = fe.lookUpUserURL(identifier)
+	} else {
+		nsid, err = fe.findByUsername(identifier)
+	}
+	var apiErr *FlickrAPIError
+	if errors.As(err, &apiErr) && apiErr.Code == flickrErrUserNotFound {
+		return "", fmt.Errorf("no Flickr user %q was found; give their NSID (like 12345678@N02), username, or photostream URL", identifier)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up Flickr user %q: %w", identifier, err)
+	}
+
+	fe.users.put(identifier, nsid)
+	return nsid, nil
+}
+
+// findByUsername returns the NSID of the user with the given username.
+func (fe *FlickrExporter) findByUsername(username string) (string, error) {
+	response := &people.FindByUsernameResponse{}
+	err := fe.withRetry("looking up user "+username, func() error {
+		response = &people.FindByUsernameResponse{}
+		return fe.api.Get("flickr.people.findByUsername", url.Values{"username": {username}}, true, response)
+	})
+	if err != nil {
+		return "", err
+	}
+	return response.User.Nsid, nil
+}
+
+// lookUpUserURL returns the NSID of the user whose photostream or profile
+// is at userURL.
+func (fe *FlickrExporter) lookUpUserURL(userURL string) (string, error) {
+	if !strings.Contains(userURL, "://") {
+		userURL = "https://" + userURL
+	}
+
+	response := &LookupUserResponse{}
+	err := fe.withRetry("looking up user "+userURL, func() error {
+		response = &LookupUserResponse{}
+		return fe.api.Get("flickr.urls.lookupUser", url.Values{"url": {userURL}}, true, response)
+	})
+	if err != nil {
+		return "", err
+	}
+	return response.User.ID, nil
+}
+
+// ownerName returns the name of the user with the given NSID, like
+// PhotoInfoOwner.name.
+func (fe *FlickrExporter) ownerName(nsid string) (string, error) {
+	if name, ok := fe.users.name(nsid); ok {
+		return name, nil
+	}
+
+	response := &PersonInfoResponse{}
+	err := fe.withRetry("getting info for user "+nsid, func() error {
+		response = &PersonInfoResponse{}
+		return fe.api.Get("flickr.people.getInfo", url.Values{"user_id": {nsid}}, true, response)
+	})
+	if err != nil {
+		return "", err
+	}
+	owner := PhotoInfoOwner{NSID: nsid, Username: response.Person.Username, RealName: response.Person.RealName}
+	fe.users.putName(nsid, owner.name())
+	return owner.name(), nil
+}
+
+// isCurrentUser reports whether the export is of the authenticated user's
+// own photos.
+func (fe *FlickrExporter) isCurrentUser() bool {
+	return fe.userID == currentUser
+}
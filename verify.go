@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// verifiableExtensions are the image formats whose dimensions can be
+// checked by checkDimensions.
+var verifiableExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+}
+
+// dimensionMismatchError means a downloaded image isn't the size Flickr
+// reported, such as when a proxy serves a resized image or an error page in
+// place of the original. The download is retried.
+type dimensionMismatchError struct {
+	filename                      string
+	expectedWidth, expectedHeight int
+	actualWidth, actualHeight     int
+}
+
+func (e *dimensionMismatchError) Error() string {
+	if e.actualWidth == 0 && e.actualHeight == 0 {
+		return fmt.Sprintf("downloaded %s isn't a valid image; Flickr reports a %dx%d image", e.filename, e.expectedWidth, e.expectedHeight)
+	}
+	return fmt.Sprintf("downloaded %s is %dx%d, but Flickr reports %dx%d", e.filename, e.actualWidth, e.actualHeight, e.expectedWidth, e.expectedHeight)
+}
+
+// checkDimensions checks that the image downloaded to path has the
+// dimensions Flickr reported for it, removing it if not. Dimensions are
+// accepted either way round, in case only one of them accounts for the
+// photo's rotation. Files in other formats than verifiableExtensions, and
+// photos whose dimensions Flickr didn't report, aren't checked; a file that
+// can't be decoded as an image counts as a mismatch.
+func (fe *FlickrExporter) checkDimensions(path, filename string, width, height int) error {
+	if width == 0 || height == 0 || !verifiableExtensions[strings.ToLower(filepath.Ext(filename))] {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	config, _, err := image.DecodeConfig(file)
+	file.Close()
+
+	matches := err == nil &&
+		(config.Width == width && config.Height == height ||
+			config.Width == height && config.Height == width)
+	if matches {
+		return nil
+	}
+
+	mismatch := &dimensionMismatchError{
+		filename:       filename,
+		expectedWidth:  width,
+		expectedHeight: height,
+		actualWidth:    config.Width,
+		actualHeight:   config.Height,
+	}
+	fe.warnf("  Warning: %v\n", mismatch)
+	if err := os.Remove(path); err != nil {
+		fe.warnf("  Warning: Failed to remove %s: %v\n", filename, err)
+	}
+	return mismatch
+}
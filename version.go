@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/spf13/cobra"
+)
+
+// Build info, set at build time via -ldflags "-X main.version=...". When
+// they aren't set, e.g. for go install, they're filled in from the build
+// info Go embeds in the binary where possible.
+var (
+	version   = "<dev>"
+	commit    = ""
+	buildDate = ""
+)
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print version and build information",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Printf("flickr-exporter %s\n", version)
+		fmt.Printf("  commit:   %s\n", valueOr(commit, "unknown"))
+		fmt.Printf("  built:    %s\n", valueOr(buildDate, "unknown"))
+		fmt.Printf("  go:       %s\n", runtime.Version())
+		fmt.Printf("  platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	},
+}
+
+// fillBuildInfo fills in any build info not set via -ldflags from the module
+// version and VCS info recorded by the Go toolchain.
+func fillBuildInfo() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	if version == "<dev>" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		version = info.Main.Version
+	}
+
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		case "vcs.time":
+			if buildDate == "" {
+				// The commit time is the best available approximation
+				buildDate = setting.Value + " (commit time)"
+			}
+		}
+	}
+	if commit == "" && revision != "" {
+		commit = revision
+		if modified == "true" {
+			commit += "-dirty"
+		}
+	}
+}
+
+// versionString returns the version and commit, for --version. It fills in
+// the build info, so it must be called before the other fields are used.
+func versionString() string {
+	fillBuildInfo()
+	if commit == "" {
+		return version
+	}
+	return fmt.Sprintf("%s (%s)", version, commit)
+}
+
+func valueOr(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}